@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wagnojunior/booking/internal/models"
+	"github.com/wagnojunior/booking/internal/repository"
+)
+
+// The environment variables with the email and password of the first admin. The database has no admin of its own, so
+// that no site has a known login
+const (
+	adminEmailEnv    = "BOOKING_ADMIN_EMAIL"
+	adminPasswordEnv = "BOOKING_ADMIN_PASSWORD"
+)
+
+// minAdminPasswordLength is the length below which the password of the first admin is refused
+const minAdminPasswordLength = 12
+
+// errNoAdmin tells that the database has no admin, and that none was created as the environment has none either.
+// The site still works for the guests
+var errNoAdmin = errors.New("there is no admin yet: set " + adminEmailEnv + " and " + adminPasswordEnv + " to create one")
+
+// createFirstAdmin creates the admin with <email> and <password> when the database has no admin yet, and tells if it
+// did. Once there is an admin, the email and password are ignored
+func createFirstAdmin(db repository.DatabaseRepo, email, password string, now time.Time) (bool, error) {
+	hasAdmin, err := db.HasAdmin()
+	if err != nil || hasAdmin {
+		return false, err
+	}
+
+	if email == "" || password == "" {
+		return false, errNoAdmin
+	}
+
+	if !strings.Contains(email, "@") {
+		return false, errors.New(adminEmailEnv + " is not an email address")
+	}
+
+	// bcrypt ignores what follows 72 bytes
+	if len(password) < minAdminPasswordLength || len(password) > 72 {
+		return false, fmt.Errorf("%s must be %d to 72 characters long", adminPasswordEnv, minAdminPasswordLength)
+	}
+
+	_, err = db.InsertUser(models.User{
+		FirstName:       "Admin",
+		LastName:        "User",
+		Email:           email,
+		AccessLevel:     models.AccessAdmin,
+		EmailVerifiedAt: now,
+	}, password)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
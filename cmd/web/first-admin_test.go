@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/wagnojunior/booking/internal/config"
+	"github.com/wagnojunior/booking/internal/models"
+	"github.com/wagnojunior/booking/internal/repository"
+	"github.com/wagnojunior/booking/internal/repository/dbrepo"
+)
+
+// emptyUsersRepo is a database without users, which keeps the one that is inserted
+type emptyUsersRepo struct {
+	repository.DatabaseRepo
+	inserted []models.User
+}
+
+func (r *emptyUsersRepo) HasAdmin() (bool, error) {
+	return len(r.inserted) > 0, nil
+}
+
+func (r *emptyUsersRepo) InsertUser(u models.User, password string) (int, error) {
+	r.inserted = append(r.inserted, u)
+	return len(r.inserted), nil
+}
+
+func TestCreateFirstAdmin(t *testing.T) {
+	now := time.Date(2022, 12, 6, 0, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		name            string
+		email           string
+		password        string
+		expectedCreated bool
+		expectedErr     bool
+	}{
+		{"created", "owner@panpanzinho.com", "a long secret phrase", true, false},
+		{"no environment", "", "", false, true},
+		{"short password", "owner@panpanzinho.com", "password", false, true},
+		{"invalid email", "owner", "a long secret phrase", false, true},
+	}
+
+	for _, e := range tests {
+		db := &emptyUsersRepo{}
+
+		created, err := createFirstAdmin(db, e.email, e.password, now)
+		if created != e.expectedCreated || (err != nil) != e.expectedErr {
+			t.Errorf("For %s, expected created %t and an error %t but got %t and %v", e.name, e.expectedCreated, e.expectedErr, created, err)
+		}
+
+		if created && (db.inserted[0].AccessLevel != models.AccessAdmin || !db.inserted[0].EmailVerifiedAt.Equal(now)) {
+			t.Errorf("For %s, expected a verified admin but got %+v", e.name, db.inserted[0])
+		}
+
+		// Without the environment the site still starts, for the guests
+		if e.email == "" && !errors.Is(err, errNoAdmin) {
+			t.Errorf("For %s, expected errNoAdmin but got %v", e.name, err)
+		}
+	}
+
+	// Once there is an admin, the environment is ignored
+	created, err := createFirstAdmin(dbrepo.NewTestingPostgresRepo(&config.AppConfig{}), "owner@panpanzinho.com", "a long secret phrase", now)
+	if created || err != nil {
+		t.Errorf("expected nothing to be created when there is an admin but got %t and %v", created, err)
+	}
+}
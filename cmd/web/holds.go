@@ -0,0 +1,24 @@
+package main
+
+import (
+	"time"
+
+	"github.com/wagnojunior/booking/internal/handlers"
+)
+
+// holdExpiryInterval is how often the rooms held for the unpaid reservations are released
+const holdExpiryInterval = time.Minute
+
+// expireHolds cancels, in the background, the pending reservations that were not paid in time right away and then
+// every <interval>
+func expireHolds(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			handlers.Repo.ExpireHolds()
+			<-ticker.C
+		}
+	}()
+}
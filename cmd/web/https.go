@@ -0,0 +1,256 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// serverOptions say how the site is served, and the settings of the property. They are set by the command line flags
+type serverOptions struct {
+	addr           string // Address of the site
+	httpAddr       string // Address that redirects HTTP to HTTPS, when the site serves TLS itself
+	certFile       string // Certificate and key of the site, to serve TLS with them
+	keyFile        string
+	autocertHosts  string // Comma separated host names whose certificates are obtained from Let's Encrypt
+	autocertCache  string // Directory where the obtained certificates are kept
+	behindHTTPS    bool   // The site is reached over HTTPS through a reverse proxy that terminates TLS
+	trustedProxies string // Comma separated IP addresses or networks of the reverse proxies
+	domain         string // Host name, and port if not the default, under which the site is reached
+	timeZone       string // Time zone of the property, e.g. Asia/Seoul
+	checkIn        string // Times of the check-in, the check-out and the same-day cutoff, written as 15:04
+	checkOut       string
+	sameDayCutoff  string
+}
+
+// serverOpts are the options of the server. By default, the site is served over plain HTTP
+var serverOpts = serverOptions{
+	addr:          portNumber,
+	domain:        defaultDomain,
+	timeZone:      defaultTimeZone,
+	checkIn:       defaultCheckIn,
+	checkOut:      defaultCheckOut,
+	sameDayCutoff: defaultSameDayCutoff,
+}
+
+// parseFlags reads the server options from the command line arguments <args>
+func parseFlags(args []string) (serverOptions, error) {
+	opts := serverOptions{}
+
+	fs := flag.NewFlagSet("booking", flag.ContinueOnError)
+	fs.StringVar(&opts.addr, "addr", portNumber, "address of the site")
+	fs.StringVar(&opts.httpAddr, "http-addr", "", "address that redirects HTTP to HTTPS when TLS is served, e.g. :80")
+	fs.StringVar(&opts.certFile, "tls-cert", "", "certificate file, to serve TLS")
+	fs.StringVar(&opts.keyFile, "tls-key", "", "key file of the certificate")
+	fs.StringVar(&opts.autocertHosts, "autocert", "", "comma separated host names whose certificates are obtained from Let's Encrypt")
+	fs.StringVar(&opts.autocertCache, "autocert-cache", "./certs", "directory of the certificates obtained from Let's Encrypt")
+	fs.BoolVar(&opts.behindHTTPS, "https", false, "the site is reached over HTTPS through a reverse proxy")
+	fs.StringVar(&opts.trustedProxies, "trusted-proxies", "", "comma separated IP addresses or networks of the reverse proxies")
+	fs.StringVar(&opts.domain, "domain", defaultDomain, "host name under which the site is reached, used in the links sent by email, e.g. localhost:8080")
+	fs.StringVar(&opts.timeZone, "timezone", defaultTimeZone, "time zone of the property, which decides when its days begin")
+	fs.StringVar(&opts.checkIn, "check-in", defaultCheckIn, "time from which the guests can arrive, written as HH:MM")
+	fs.StringVar(&opts.checkOut, "check-out", defaultCheckOut, "time until which the guests can stay on their departure day, written as HH:MM")
+	fs.StringVar(&opts.sameDayCutoff, "same-day-cutoff", defaultSameDayCutoff, "latest time at which a stay arriving the same day can be booked, empty for none")
+
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+
+	if (opts.certFile == "") != (opts.keyFile == "") {
+		return opts, errors.New("-tls-cert and -tls-key go together")
+	}
+
+	if opts.certFile != "" && opts.autocertHosts != "" {
+		return opts, errors.New("-tls-cert and -autocert cannot be used together")
+	}
+
+	if _, err := opts.propertySettings(); err != nil {
+		return opts, err
+	}
+
+	return opts, nil
+}
+
+// servesTLS checks if the site serves HTTPS itself
+func (o serverOptions) servesTLS() bool {
+	return o.certFile != "" || o.autocertHosts != ""
+}
+
+// https checks if the site is reached over HTTPS
+func (o serverOptions) https() bool {
+	return o.servesTLS() || o.behindHTTPS
+}
+
+// tlsConfig returns the TLS configuration of the site, and the handler of the plain HTTP address, which redirects
+// to HTTPS. With -autocert, the handler also answers the challenges of Let's Encrypt. Local host names cannot be
+// validated by Let's Encrypt, so they get a self-signed certificate instead, which stands in for it in development
+func (o serverOptions) tlsConfig() (*tls.Config, http.Handler, error) {
+	redirect := redirectToHTTPS(o.addr)
+
+	if o.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.certFile, o.keyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, redirect, nil
+	}
+
+	hosts := splitList(o.autocertHosts)
+
+	if allLocal(hosts) {
+		cert, err := selfSignedCertificate(hosts, time.Now())
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, redirect, nil
+	}
+
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(hosts...),
+		Cache:      autocert.DirCache(o.autocertCache),
+	}
+
+	config := m.TLSConfig()
+	config.MinVersion = tls.VersionTLS12
+
+	return config, m.HTTPHandler(redirect), nil
+}
+
+// redirectToHTTPS returns a handler that redirects every request to the same URL over HTTPS, on the port of <addr>
+func redirectToHTTPS(addr string) http.Handler {
+	_, port, _ := net.SplitHostPort(addr)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, httpsURL(r, port), http.StatusPermanentRedirect)
+	})
+}
+
+// httpsURL returns the URL of the request <r> over HTTPS on the port <port>. The default port is left out
+func httpsURL(r *http.Request, port string) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		host = h
+	}
+
+	if port != "" && port != "443" {
+		host = net.JoinHostPort(host, port)
+	}
+
+	return "https://" + host + r.URL.RequestURI()
+}
+
+// allLocal checks if every host of <hosts> is the local machine
+func allLocal(hosts []string) bool {
+	for _, host := range hosts {
+		if host != "localhost" && !strings.HasSuffix(host, ".localhost") && !isLoopback(host) {
+			return false
+		}
+	}
+
+	return len(hosts) > 0
+}
+
+// isLoopback checks if <host> is a loopback IP address
+func isLoopback(host string) bool {
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// selfSignedCertificate returns a certificate for <hosts>, signed by its own key, valid for a year from <now>
+func selfSignedCertificate(hosts []string, now time.Time) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"Booking development"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// parseTrustedProxies parses the comma separated IP addresses and CIDR networks of <list>.
+// An IP address is a network of one address
+func parseTrustedProxies(list string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+
+	for _, entry := range splitList(list) {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// splitList returns the trimmed, non-empty entries of the comma separated <list>
+func splitList(list string) []string {
+	var entries []string
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
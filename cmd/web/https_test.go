@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	opts, err := parseFlags(nil)
+	if err != nil || opts.addr != portNumber || opts.https() {
+		t.Errorf("expected plain HTTP on %s by default but got %+v: %v", portNumber, opts, err)
+	}
+
+	opts, err = parseFlags([]string{"-addr", ":443", "-tls-cert", "cert.pem", "-tls-key", "key.pem"})
+	if err != nil || !opts.servesTLS() || !opts.https() {
+		t.Errorf("expected TLS to be served but got %+v: %v", opts, err)
+	}
+
+	opts, err = parseFlags([]string{"-https", "-trusted-proxies", "10.0.0.1"})
+	if err != nil || opts.servesTLS() || !opts.https() {
+		t.Errorf("expected HTTPS through a proxy but got %+v: %v", opts, err)
+	}
+
+	if _, err := parseFlags([]string{"-tls-cert", "cert.pem"}); err == nil {
+		t.Error("expected an error for a certificate without key")
+	}
+
+	if _, err := parseFlags([]string{"-timezone", "Mars/Olympus"}); err == nil {
+		t.Error("expected an error for an unknown time zone")
+	}
+
+	if _, err := parseFlags([]string{"-check-in", "2pm"}); err == nil {
+		t.Error("expected an error for a check-in that is not written as HH:MM")
+	}
+}
+
+func TestServerOptions_PropertySettings(t *testing.T) {
+	opts, err := parseFlags([]string{"-same-day-cutoff", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := opts.propertySettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The property is in Suwon, South Korea
+	if s.Location().String() != "Asia/Seoul" || s.CheckIn.String() != "14:00" || s.CheckOut.String() != "11:00" || !s.SameDayCutoff.IsZero() {
+		t.Errorf("expected the settings of the property in Seoul without cutoff but got %+v", s)
+	}
+}
+
+func TestServerOptions_TLSConfig(t *testing.T) {
+	// Local host names get a self-signed certificate instead of one from Let's Encrypt
+	opts := serverOptions{addr: ":8443", autocertHosts: "localhost,127.0.0.1"}
+
+	config, redirect, err := opts.tlsConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	srv.TLS = config
+	srv.StartTLS()
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.TLS == nil || resp.TLS.PeerCertificates[0].DNSNames[0] != "localhost" {
+		t.Error("expected the site to be served with the certificate of localhost")
+	}
+
+	// Plain HTTP is redirected to the port of the site
+	req := httptest.NewRequest("GET", "http://localhost/about", nil)
+	rr := httptest.NewRecorder()
+	redirect.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusPermanentRedirect || rr.Header().Get("Location") != "https://localhost:8443/about" {
+		t.Errorf("expected a redirect to HTTPS but got %d to %s", rr.Code, rr.Header().Get("Location"))
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	networks, err := parseTrustedProxies("10.0.0.1, 192.168.0.0/16, ::1")
+	if err != nil || len(networks) != 3 {
+		t.Fatalf("expected 3 networks but got %v: %v", networks, err)
+	}
+
+	if _, err := parseTrustedProxies("proxy.local"); err == nil {
+		t.Error("expected an error for a host name")
+	}
+}
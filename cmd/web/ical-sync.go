@@ -0,0 +1,23 @@
+package main
+
+import (
+	"time"
+
+	"github.com/wagnojunior/booking/internal/handlers"
+)
+
+// calendarSyncInterval is how often the calendars of the other channels are imported
+const calendarSyncInterval = 15 * time.Minute
+
+// syncCalendars imports, in the background, the calendars of the other channels right away and then every <interval>
+func syncCalendars(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			handlers.Repo.SyncICalImports()
+			<-ticker.C
+		}
+	}()
+}
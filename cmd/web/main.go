@@ -2,24 +2,29 @@ package main
 
 import (
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"time"
+	_ "time/tzdata" // The time zone of the property is known even where the system has no time zone database
 
+	"github.com/wagnojunior/booking/internal/clock"
 	"github.com/wagnojunior/booking/internal/config"
 	"github.com/wagnojunior/booking/internal/driver"
 	"github.com/wagnojunior/booking/internal/handlers"
 	"github.com/wagnojunior/booking/internal/helpers"
 	"github.com/wagnojunior/booking/internal/models"
+	"github.com/wagnojunior/booking/internal/payments"
 	"github.com/wagnojunior/booking/internal/render"
 
 	"github.com/alexedwards/scs/v2"
 )
 
 // Constants
-const portNumber = ":8080" // port number
+const portNumber = ":8080"              // port number
+const defaultDomain = "panpanzinho.com" // domain of the property
 
 // Package-level variables
 var app config.AppConfig
@@ -28,22 +33,71 @@ var infoLog *log.Logger
 var errorLog *log.Logger
 
 func main() {
+	opts, err := parseFlags(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	serverOpts = opts
+
 	db, err := run()
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer db.SQL.Close()
 
-	fmt.Println(fmt.Sprintf("Staring application on port %s", portNumber))
+	// Emails are sent in the background
+	defer close(app.MailChan)
+	fmt.Println("Starting mail listener...")
+	listenForMail()
+
+	// The bookings made on other channels are imported from their calendars in the background
+	fmt.Println("Starting calendar synchronisation...")
+	syncCalendars(calendarSyncInterval)
+
+	// The events are posted to the webhook endpoints in the background, so that a slow endpoint does not slow the site
+	fmt.Println("Starting webhook deliveries...")
+	deliverWebhooks(webhookDeliveryInterval)
+
+	// The rooms held for the reservations that are not paid in time are released in the background
+	fmt.Println("Starting the release of unpaid holds...")
+	expireHolds(holdExpiryInterval)
+
+	// In development, the templates are parsed again as soon as they change
+	if !app.UseCache {
+		fmt.Println("Watching the templates...")
+		watchTemplates(templateWatchInterval)
+	}
+
+	fmt.Println(fmt.Sprintf("Staring application on %s", serverOpts.addr))
 
 	// Initializes a server
 	srv := &http.Server{
-		Addr:    portNumber,
+		Addr:    serverOpts.addr,
 		Handler: routes(&app), // Instead of writing the handlers one by one for every webpage, pass the routes function
 	}
 
-	// Start the server
-	err = srv.ListenAndServe()
+	if !serverOpts.servesTLS() {
+		// Start the server
+		err = srv.ListenAndServe()
+		log.Fatal(err)
+	}
+
+	// The site serves HTTPS itself, and plain HTTP is redirected to it
+	tlsConfig, redirect, err := serverOpts.tlsConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv.TLSConfig = tlsConfig
+
+	if serverOpts.httpAddr != "" {
+		fmt.Println(fmt.Sprintf("Redirecting HTTP on %s to HTTPS", serverOpts.httpAddr))
+		go func() {
+			log.Fatal(http.ListenAndServe(serverOpts.httpAddr, redirect))
+		}()
+	}
+
+	// The certificates are in the TLS configuration
+	err = srv.ListenAndServeTLS("", "")
 	log.Fatal(err)
 }
 
@@ -57,6 +111,39 @@ func run() (*driver.DB, error) {
 	// Set the in development mode
 	app.InProduction = false
 
+	// HTTPS, served here or by a reverse proxy, and the reverse proxies whose forwarded headers are believed
+	app.HTTPS = serverOpts.https()
+	trustedProxies, err := parseTrustedProxies(serverOpts.trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	app.TrustedProxies = trustedProxies
+
+	// Everything that depends on the time asks the clock of the system
+	app.Clock = clock.Real{}
+
+	// Set the name of the property and the currency of the room prices
+	app.PropertyName = "Panpanzinho's Bed and Breakfast"
+	app.Domain = serverOpts.domain
+	app.Currency = "USD"
+
+	// The time zone of the property, and the times at which its guests arrive and leave
+	app.Property, err = serverOpts.propertySettings()
+	if err != nil {
+		return nil, err
+	}
+
+	// Creates the channel through which the handlers send emails. It is buffered, so that the handlers do not wait
+	// for the mail server
+	mailChan := make(chan models.MailData, mailQueueSize)
+	app.MailChan = mailChan
+	app.MailFrom = "bookings@panpanzinho.com"
+
+	// Payments go through the fake gateway until a real provider is configured
+	app.PaymentGateway = payments.NewFakeGateway("development-webhook-secret")
+
+	app.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+
 	// Creates the infoLog. Write to the standard output (terminal),
 	// prefixed by the tag INFO, and flagged by the date and time
 	infoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
@@ -70,7 +157,7 @@ func run() (*driver.DB, error) {
 	session.Lifetime = 24 * time.Hour              // Defines for how long the session will persist
 	session.Cookie.Persist = true                  // Cookies will persist after the browser is closed by the end-user
 	session.Cookie.SameSite = http.SameSiteLaxMode //
-	session.Cookie.Secure = app.InProduction
+	session.Cookie.Secure = app.InProduction || app.HTTPS
 
 	// Set the <Session> field in the <AppConfig>, thus exposing this variable to all packages that import <config.go>
 	app.Session = session
@@ -86,7 +173,7 @@ func run() (*driver.DB, error) {
 	// Creates the template cache
 	tc, err := render.CreateTemplateCache()
 	if err != nil {
-		log.Fatal("cannot create template cache")
+		log.Fatal("cannot create template cache: ", err)
 		return nil, err
 	}
 
@@ -100,6 +187,16 @@ func run() (*driver.DB, error) {
 	// Sends the local variable <repo> to <handlers.go> to initialize the variable <Repo> there
 	handlers.NewHandlers(repo)
 
+	// The database has no admin of its own. The first one is created from the environment
+	created, err := createFirstAdmin(repo.DB, os.Getenv(adminEmailEnv), os.Getenv(adminPasswordEnv), app.Clock.Now())
+	if errors.Is(err, errNoAdmin) {
+		errorLog.Println(err)
+	} else if err != nil {
+		return nil, err
+	} else if created {
+		infoLog.Println("Created the admin", os.Getenv(adminEmailEnv))
+	}
+
 	// Initialized the variable <app> of type <*AppConfig> in <render.go>
 	render.NewRenderer(&app)
 
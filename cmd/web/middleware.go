@@ -1,9 +1,17 @@
 package main
 
 import (
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/justinas/nosurf"
+	"github.com/wagnojunior/booking/internal/csp"
+	"github.com/wagnojunior/booking/internal/helpers"
+	"github.com/wagnojunior/booking/internal/i18n"
+	"github.com/wagnojunior/booking/internal/ratelimit"
 )
 
 // In case a middleware does not come out of the box from the router, it is necessary to build our own middleware
@@ -16,10 +24,13 @@ func NoSurf(next http.Handler) http.Handler {
 	csrfHandler.SetBaseCookie(http.Cookie{
 		HttpOnly: true,
 		Path:     "/", // Applies to the entire website
-		Secure:   app.InProduction,
+		Secure:   app.InProduction || app.HTTPS,
 		SameSite: http.SameSiteLaxMode,
 	})
 
+	// The payment provider cannot send a CSRF token. Its calls are verified by their signature instead
+	csrfHandler.ExemptPath("/payments/webhook")
+
 	return csrfHandler
 }
 
@@ -28,3 +39,176 @@ func NoSurf(next http.Handler) http.Handler {
 func SessionLoad(next http.Handler) http.Handler {
 	return session.LoadAndSave(next)
 }
+
+// Auth protects the routes that require a logged in user, redirecting anyone else to the login page
+func Auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !helpers.IsAuthenticated(r) {
+			session.Put(r.Context(), "error", "Log in first!")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Admin protects the routes of the staff from the guests with an account. It must run after Auth
+func Admin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !helpers.IsAdmin(r) {
+			helpers.ClientError(w, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RateLimit returns a middleware that refuses, with 429 and a Retry-After header, the requests of a client IP address
+// beyond <perIP> and of a session beyond <perSession>. Every route that uses it gets its own buckets. It must run after
+// SessionLoad; the requests of a client without a session yet are only limited by IP address
+func RateLimit(perIP, perSession ratelimit.Limit) func(http.Handler) http.Handler {
+	ips := ratelimit.New(perIP)
+	sessions := ratelimit.New(perSession)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			now := app.Clock.Now()
+
+			ok, retryAfter := ips.Allow(clientIP(r), now)
+			if token := session.Token(r.Context()); ok && token != "" {
+				ok, retryAfter = sessions.Allow(token, now)
+			}
+
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SecureHeaders sends the security headers with every response. The inline scripts of the templates carry a new
+// nonce per request, which the Content-Security-Policy lets run. HSTS is only sent over HTTPS, as browsers require
+func SecureHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce, err := csp.NewNonce()
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		h := w.Header()
+		h.Set("Content-Security-Policy", csp.Policy(nonce))
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+		h.Set("Permissions-Policy", "camera=(), microphone=(), geolocation=(), payment=(), usb=()")
+
+		if isHTTPS(r) {
+			h.Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+		}
+
+		next.ServeHTTP(w, r.WithContext(csp.WithNonce(r.Context(), nonce)))
+	})
+}
+
+// Locale stores in the context of the request the locale of the visitor: the one chosen with the language menu,
+// or else the best match of the languages of the browser
+func Locale(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(i18n.WithLocale(r.Context(), i18n.Negotiate(r))))
+	})
+}
+
+// StaticCache lets browsers keep the static files whose path carries the fingerprint of their content, which changes
+// with the content, for a year
+func StaticCache(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("v") != "" {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RedirectHTTPS redirects the plain HTTP requests to HTTPS when the site is reached over HTTPS
+func RedirectHTTPS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.HTTPS && !isHTTPS(r) {
+			http.Redirect(w, r, httpsURL(r, ""), http.StatusPermanentRedirect)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isHTTPS checks if the request <r> was made over HTTPS, to the site or to a trusted reverse proxy
+func isHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+
+	return fromTrustedProxy(r) && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// fromTrustedProxy checks if the request <r> comes from one of the trusted reverse proxies
+func fromTrustedProxy(r *http.Request) bool {
+	return isTrustedProxy(remoteIP(r))
+}
+
+// isTrustedProxy checks if the IP address <addr> is one of the trusted reverse proxies
+func isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range app.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// remoteIP returns the IP address of the peer of the request <r>
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// clientIP returns the IP address the request <r> comes from. Behind trusted reverse proxies, it is the last address
+// of X-Forwarded-For that is not a trusted proxy, since a client can put anything at the start of the header
+func clientIP(r *http.Request) string {
+	ip := remoteIP(r)
+	if !isTrustedProxy(ip) {
+		return ip
+	}
+
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(forwarded[i])
+		if addr == "" {
+			continue
+		}
+
+		if !isTrustedProxy(addr) {
+			return addr
+		}
+		ip = addr
+	}
+
+	return ip
+}
@@ -2,7 +2,14 @@ package main
 
 import (
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/wagnojunior/booking/internal/csp"
+	"github.com/wagnojunior/booking/internal/i18n"
+	"github.com/wagnojunior/booking/internal/ratelimit"
 )
 
 // In order to test <NoSurf()> we need a <http.Handler> as an argument
@@ -34,3 +41,201 @@ func TestSessionLoad(t *testing.T) {
 		t.Errorf("Type %t is not <http.Handler>", v)
 	}
 }
+
+// In order to test <Auth()> we need a <http.Handler> as an argument
+func TestAuth(t *testing.T) {
+	// Creates a variable of type <http.Handler>
+	var myH myHandler
+
+	h := Auth(&myH)
+
+	switch v := h.(type) {
+	case http.Handler:
+		// do nothing
+	default:
+		t.Errorf("Type %t is not <http.Handler>", v)
+	}
+}
+
+// In order to test <Admin()> we need a <http.Handler> as an argument
+func TestAdmin(t *testing.T) {
+	var myH myHandler
+
+	h := Admin(&myH)
+
+	switch v := h.(type) {
+	case http.Handler:
+		// do nothing
+	default:
+		t.Errorf("Type %t is not <http.Handler>", v)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	var myH myHandler
+
+	// 2 requests per IP address at once, then one per minute
+	h := SessionLoad(RateLimit(ratelimit.Every(1, time.Minute, 2), ratelimit.Every(1, time.Minute, 2))(&myH))
+
+	for i, expected := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest("POST", "/search-availability", nil)
+		req.RemoteAddr = "1.2.3.4:5678"
+		rr := httptest.NewRecorder()
+
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != expected {
+			t.Errorf("request %d: expected %d but got %d", i+1, expected, rr.Code)
+		}
+
+		if expected == http.StatusTooManyRequests && rr.Header().Get("Retry-After") != "60" {
+			t.Errorf("expected to retry after 60 seconds but got %q", rr.Header().Get("Retry-After"))
+		}
+	}
+
+	// Another IP address has its own limit
+	req := httptest.NewRequest("POST", "/search-availability", nil)
+	req.RemoteAddr = "5.6.7.8:5678"
+	rr := httptest.NewRecorder()
+
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected another IP address to be allowed but got %d", rr.Code)
+	}
+}
+
+func TestSecureHeaders(t *testing.T) {
+	var nonce string
+	h := SecureHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce = csp.Nonce(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if nonce == "" || !strings.Contains(rr.Header().Get("Content-Security-Policy"), "'nonce-"+nonce+"'") {
+		t.Errorf("expected the policy to allow the nonce %q of the request but got %s", nonce, rr.Header().Get("Content-Security-Policy"))
+	}
+
+	for _, header := range []string{"X-Frame-Options", "Referrer-Policy", "Permissions-Policy"} {
+		if rr.Header().Get(header) == "" {
+			t.Errorf("expected the header %s", header)
+		}
+	}
+
+	if rr.Header().Get("Strict-Transport-Security") != "" {
+		t.Error("expected no HSTS over plain HTTP")
+	}
+
+	// HSTS is sent over HTTPS
+	req = httptest.NewRequest("GET", "https://localhost/", nil)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Header().Get("Strict-Transport-Security") == "" {
+		t.Error("expected HSTS over HTTPS")
+	}
+}
+
+func TestRedirectHTTPS(t *testing.T) {
+	var myH myHandler
+	h := RedirectHTTPS(&myH)
+
+	app.HTTPS = true
+	app.TrustedProxies, _ = parseTrustedProxies("10.0.0.1")
+	defer func() {
+		app.HTTPS = false
+		app.TrustedProxies = nil
+	}()
+
+	var tests = []struct {
+		name         string
+		remoteAddr   string
+		proto        string
+		expectedCode int
+	}{
+		{"plain-http", "1.2.3.4:5678", "", http.StatusPermanentRedirect},
+		{"https-through-the-proxy", "10.0.0.1:5678", "https", http.StatusOK},
+		{"http-through-the-proxy", "10.0.0.1:5678", "http", http.StatusPermanentRedirect},
+		{"untrusted-forwarded-proto", "1.2.3.4:5678", "https", http.StatusPermanentRedirect},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "http://example.com/about?x=1", nil)
+		req.RemoteAddr = e.remoteAddr
+		req.Header.Set("X-Forwarded-Proto", e.proto)
+		rr := httptest.NewRecorder()
+
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("For %s, expected %d but got %d", e.name, e.expectedCode, rr.Code)
+		}
+
+		if e.expectedCode == http.StatusPermanentRedirect && rr.Header().Get("Location") != "https://example.com/about?x=1" {
+			t.Errorf("For %s, expected a redirect to HTTPS but got %s", e.name, rr.Header().Get("Location"))
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	app.TrustedProxies, _ = parseTrustedProxies("10.0.0.0/8")
+	defer func() {
+		app.TrustedProxies = nil
+	}()
+
+	var tests = []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		expected   string
+	}{
+		{"direct", "1.2.3.4:5678", "", "1.2.3.4"},
+		{"untrusted-forwarded-for", "1.2.3.4:5678", "5.6.7.8", "1.2.3.4"},
+		{"through-the-proxies", "10.0.0.1:5678", "9.9.9.9, 5.6.7.8, 10.0.0.2", "5.6.7.8"},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = e.remoteAddr
+		req.Header.Set("X-Forwarded-For", e.forwarded)
+
+		if ip := clientIP(req); ip != e.expected {
+			t.Errorf("For %s, expected %s but got %s", e.name, e.expected, ip)
+		}
+	}
+}
+
+func TestLocale(t *testing.T) {
+	var locale string
+	h := Locale(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		locale = i18n.FromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Language", "ja-JP,en;q=0.8")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if locale != "ja" {
+		t.Errorf("expected the locale of the browser but got %s", locale)
+	}
+}
+
+func TestStaticCache(t *testing.T) {
+	var myH myHandler
+	h := StaticCache(&myH)
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/css/styles.css?v=abc123", nil))
+	if !strings.Contains(rr.Header().Get("Cache-Control"), "immutable") {
+		t.Errorf("expected a fingerprinted file to be cached but got %q", rr.Header().Get("Cache-Control"))
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/css/styles.css", nil))
+	if rr.Header().Get("Cache-Control") != "" {
+		t.Errorf("expected a plain path not to be cached but got %q", rr.Header().Get("Cache-Control"))
+	}
+}
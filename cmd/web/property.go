@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/wagnojunior/booking/internal/property"
+)
+
+// Default settings of the property, in Suwon, South Korea. Stays arriving today can be booked until the evening
+const (
+	defaultTimeZone      = "Asia/Seoul"
+	defaultCheckIn       = "14:00"
+	defaultCheckOut      = "11:00"
+	defaultSameDayCutoff = "20:00"
+)
+
+// propertySettings returns the settings of the property given by the options. The days of the property begin in its
+// own time zone, whatever the time zone of the server. An empty same-day cutoff means that there is none
+func (o serverOptions) propertySettings() (property.Settings, error) {
+	var s property.Settings
+
+	if o.timeZone == "" {
+		return s, fmt.Errorf("-timezone is required, e.g. %s", defaultTimeZone)
+	}
+
+	timeZone, err := time.LoadLocation(o.timeZone)
+	if err != nil {
+		return s, fmt.Errorf("-timezone: %w", err)
+	}
+	s.TimeZone = timeZone
+
+	s.CheckIn, err = property.ParseTimeOfDay(o.checkIn)
+	if err != nil {
+		return s, fmt.Errorf("-check-in: %w", err)
+	}
+
+	s.CheckOut, err = property.ParseTimeOfDay(o.checkOut)
+	if err != nil {
+		return s, fmt.Errorf("-check-out: %w", err)
+	}
+
+	if o.sameDayCutoff != "" {
+		s.SameDayCutoff, err = property.ParseTimeOfDay(o.sameDayCutoff)
+		if err != nil {
+			return s, fmt.Errorf("-same-day-cutoff: %w", err)
+		}
+	}
+
+	return s, nil
+}
@@ -2,14 +2,29 @@ package main
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/wagnojunior/booking/internal/config"
 	"github.com/wagnojunior/booking/internal/handlers"
+	"github.com/wagnojunior/booking/internal/models"
+	"github.com/wagnojunior/booking/internal/ratelimit"
+	"github.com/wagnojunior/booking/internal/render"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
+// namedRoutes are the routes that the templates link to with urlFor, by name
+var namedRoutes = map[string]string{
+	"choose-room":               "/choose-room/{id}",
+	"language":                  "/language/{locale}",
+	"admin-promo-code":          "/admin/promo-codes/{id}",
+	"admin-api-key":             "/admin/api-keys/{id}",
+	"admin-webhook":             "/admin/webhooks/{id}",
+	"admin-reservation":         "/admin/reservations/{id}",
+	"admin-reservation-invoice": "/admin/reservations/{id}/invoice",
+}
+
 // Instead of routing every page of the web application in the <main.go> files, it is a good practice to do it in separate file.
 // For reference, the routing was done in the following manner:
 // http.HandleFunc("/", handlers.Repo.Home)
@@ -17,34 +32,116 @@ import (
 func routes(app *config.AppConfig) http.Handler {
 	// A http handlers is often times called a mux or a multiplexor
 
+	// The templates build the URLs of the named routes
+	render.NewRoutes(namedRoutes)
+
 	// Create a new mux
 	mux := chi.NewRouter()
 
 	// Middleware allows you to process a web request as it comes and perform an action
 	mux.Use(middleware.Recoverer) // Gracefully absorb panics and prints the stack trace
-	mux.Use(NoSurf)               // Our own middleware which was created in <middleware.go> using the third-party package <nosurf>
-	mux.Use(SessionLoad)
-
-	// Get the http requests
-	mux.Get("/", handlers.Repo.Home)
-	mux.Get("/about", handlers.Repo.About)
-	mux.Get("/panda-suite", handlers.Repo.PandaSuite)
-	mux.Get("/bamboo-dorm", handlers.Repo.BambooDorm)
-	mux.Get("/search-availability", handlers.Repo.SearchAvailability)
-	mux.Get("/contact", handlers.Repo.Contact)
-	mux.Get("/make-reservation", handlers.Repo.MakeReservation)
-	mux.Get("/reservation-summary", handlers.Repo.ReservationSummary)
-	mux.Get("/choose-room/{id}", handlers.Repo.ChooseRoom)
-	mux.Get("/book-room", handlers.Repo.BookRoom)
-
-	// Post the http requests
-	mux.Post("/search-availability", handlers.Repo.PostSearchAvailability) // Catch requests that POST to this url and send it to the specified handler
-	mux.Post("/search-availability-json", handlers.Repo.AvailabilityJSON)
-	mux.Post("/make-reservation", handlers.Repo.PostMakeReservation)
+	mux.Use(RedirectHTTPS)        // Over HTTPS only, when the site is reached over HTTPS
+	mux.Use(SecureHeaders)        // Content-Security-Policy, HSTS, etc.
+
+	// The description of the JSON API is public, so that the partners can generate clients
+	mux.Get("/api/openapi.json", handlers.Repo.OpenAPI)
+
+	// The JSON API is used by other programs, so it has neither sessions nor CSRF tokens. The partners authenticate
+	// with API keys, whose scopes decide which endpoints they can use
+	mux.Route("/api/v1", func(mux chi.Router) {
+		mux.Use(handlers.Repo.APIAuth)
+
+		mux.With(handlers.Repo.RequireScope(models.ScopeReadAvailability)).Get("/rooms", handlers.Repo.APIRooms)
+		mux.With(handlers.Repo.RequireScope(models.ScopeReadAvailability)).Get("/availability", handlers.Repo.APIAvailability)
+		mux.With(handlers.Repo.RequireScope(models.ScopeCreateReservation)).Post("/reservations", handlers.Repo.APIPostReservation)
+		mux.With(handlers.Repo.RequireScope(models.ScopeManageReservations)).Get("/reservations/{code}", handlers.Repo.APIReservation)
+		mux.With(handlers.Repo.RequireScope(models.ScopeManageReservations)).Post("/reservations/{code}/cancel", handlers.Repo.APICancelReservation)
+	})
+
+	// Bots hammer the availability searches and make junk reservations, so the public forms are rate limited per
+	// client IP address and per session. The room pages check their availability on every change of the dates
+	searchLimit := RateLimit(ratelimit.Every(30, time.Minute, 10), ratelimit.Every(20, time.Minute, 10))
+	availabilityLimit := RateLimit(ratelimit.Every(60, time.Minute, 20), ratelimit.Every(60, time.Minute, 20))
+	reservationLimit := RateLimit(ratelimit.Every(10, time.Hour, 5), ratelimit.Every(5, time.Hour, 3))
+
+	// The pages of the web site
+	mux.Group(func(mux chi.Router) {
+		mux.Use(NoSurf) // Our own middleware which was created in <middleware.go> using the third-party package <nosurf>
+		mux.Use(SessionLoad)
+		mux.Use(Locale)
+
+		// Get the http requests
+		mux.Get("/", handlers.Repo.Home)
+		mux.Get("/about", handlers.Repo.About)
+		mux.Get("/panda-suite", handlers.Repo.PandaSuite)
+		mux.Get("/bamboo-dorm", handlers.Repo.BambooDorm)
+		mux.Get("/search-availability", handlers.Repo.SearchAvailability)
+		mux.Get("/contact", handlers.Repo.Contact)
+		mux.Get("/language/{locale}", handlers.Repo.ChangeLanguage)
+		mux.Get("/make-reservation", handlers.Repo.MakeReservation)
+		mux.Get("/reservation-summary", handlers.Repo.ReservationSummary)
+		mux.Get("/reservation-summary/invoice", handlers.Repo.ReservationInvoice)
+		mux.Get("/choose-room/{id}", handlers.Repo.ChooseRoom)
+		mux.Get("/book-room", handlers.Repo.BookRoom)
+		mux.Get("/checkout", handlers.Repo.Checkout)
+		mux.Get("/ical/{room}/{token}.ics", handlers.Repo.RoomCalendar)
+		mux.Get("/user/login", handlers.Repo.ShowLogin)
+		mux.Get("/user/logout", handlers.Repo.Logout)
+		mux.Get("/user/register", handlers.Repo.ShowRegister)
+		mux.Get("/user/verify/{token}", handlers.Repo.VerifyEmail)
+
+		// Post the http requests
+		mux.With(searchLimit).Post("/search-availability", handlers.Repo.PostSearchAvailability) // Catch requests that POST to this url and send it to the specified handler
+		mux.With(availabilityLimit).Post("/search-availability-json", handlers.Repo.AvailabilityJSON)
+		mux.With(reservationLimit).Post("/make-reservation", handlers.Repo.PostMakeReservation)
+		mux.Post("/checkout", handlers.Repo.PostCheckout)
+		mux.Post("/payments/webhook", handlers.Repo.PaymentWebhook)
+		mux.Post("/user/login", handlers.Repo.PostShowLogin)
+		mux.With(reservationLimit).Post("/user/register", handlers.Repo.PostRegister)
+
+		// The guests with an account see their bookings
+		mux.Route("/account", func(mux chi.Router) {
+			mux.Use(Auth)
+
+			mux.Get("/bookings", handlers.Repo.MyBookings)
+		})
+
+		// The admin area is only available to the staff
+		mux.Route("/admin", func(mux chi.Router) {
+			mux.Use(Auth)
+			mux.Use(Admin)
+
+			mux.Get("/promo-codes", handlers.Repo.AdminPromoCodes)
+			mux.Get("/promo-codes/{id}", handlers.Repo.AdminShowPromoCode)
+			mux.Post("/promo-codes/{id}", handlers.Repo.AdminPostPromoCode)
+			mux.Post("/promo-codes/{id}/delete", handlers.Repo.AdminDeletePromoCode)
+
+			mux.Get("/rooms", handlers.Repo.AdminRooms)
+			mux.Post("/rooms/{id}/ical-imports", handlers.Repo.AdminPostICalImport)
+			mux.Post("/ical-imports/{id}/sync", handlers.Repo.AdminSyncICalImport)
+			mux.Post("/ical-imports/{id}/delete", handlers.Repo.AdminDeleteICalImport)
+
+			mux.Get("/api-keys", handlers.Repo.AdminAPIKeys)
+			mux.Post("/api-keys", handlers.Repo.AdminPostAPIKey)
+			mux.Get("/api-keys/{id}", handlers.Repo.AdminShowAPIKey)
+			mux.Post("/api-keys/{id}/delete", handlers.Repo.AdminDeleteAPIKey)
+
+			mux.Get("/webhooks", handlers.Repo.AdminWebhooks)
+			mux.Post("/webhooks", handlers.Repo.AdminPostWebhook)
+			mux.Get("/webhooks/{id}", handlers.Repo.AdminShowWebhook)
+			mux.Post("/webhooks/{id}/delete", handlers.Repo.AdminDeleteWebhook)
+			mux.Post("/webhook-deliveries/{id}/retry", handlers.Repo.AdminRetryWebhookDelivery)
+
+			mux.Get("/reservations", handlers.Repo.AdminReservations)
+			mux.Get("/reservations/{id}", handlers.Repo.AdminShowReservation)
+			mux.Get("/reservations/{id}/invoice", handlers.Repo.AdminReservationInvoice)
+			mux.Post("/reservations/{id}/cancel", handlers.Repo.AdminCancelReservation)
+		})
+	})
 
 	// Creates a file server from which static files are retrieved
 	fileServer := http.FileServer(http.Dir("./static/"))
-	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
+	mux.Handle("/static/*", http.StripPrefix("/static", StaticCache(fileServer)))
 
 	return mux
 }
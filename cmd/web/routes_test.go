@@ -1,10 +1,13 @@
 package main
 
 import (
+	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/wagnojunior/booking/internal/config"
+	"github.com/wagnojunior/booking/internal/handlers"
 )
 
 func TestRoutes(t *testing.T) {
@@ -19,3 +22,73 @@ func TestRoutes(t *testing.T) {
 		t.Errorf("Type %t is not <*chi.Mux>", v)
 	}
 }
+
+// webJSONRoutes are the routes of the web site, outside /api, that answer with JSON, by method
+var webJSONRoutes = map[string]bool{
+	"POST /search-availability-json": true,
+	"GET /search-availability":       true,
+	"POST /search-availability":      true,
+	"GET /make-reservation":          true,
+	"POST /make-reservation":         true,
+	"GET /checkout":                  true,
+	"POST /checkout":                 true,
+	"GET /reservation-summary":       true,
+}
+
+func TestRoutes_OpenAPI(t *testing.T) {
+	var app config.AppConfig
+
+	mux := routes(&app).(*chi.Mux)
+	doc := handlers.APIDocument()
+
+	// Every JSON route must be described
+	routed := make(map[string]bool)
+	err := chi.Walk(mux, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		if !strings.HasPrefix(route, "/api/") && !webJSONRoutes[method+" "+route] {
+			return nil
+		}
+
+		routed[method+" "+route] = true
+		if !doc.Has(method, route) {
+			t.Errorf("%s %s has no entry in the OpenAPI document", method, route)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every description must match a route
+	for path, item := range doc.Paths {
+		for method := range item {
+			if !routed[strings.ToUpper(method)+" "+path] {
+				t.Errorf("the OpenAPI document describes %s %s, which is not routed", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+func TestRoutes_Named(t *testing.T) {
+	var app config.AppConfig
+
+	mux := routes(&app).(*chi.Mux)
+
+	routed := make(map[string]bool)
+	err := chi.Walk(mux, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		if method == "GET" {
+			routed[route] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The templates link to the named routes, which must exist
+	for name, pattern := range namedRoutes {
+		if !routed[pattern] {
+			t.Errorf("the named route %s is %s, which is not routed", name, pattern)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/wagnojunior/booking/internal/models"
+)
+
+// mailServer is the address of the SMTP server, e.g. MailHog in development
+const mailServer = "localhost:1025"
+
+const (
+	mailQueueSize = 100              // Emails that the handlers can queue before they wait for the senders
+	mailSenders   = 4                // Emails sent at once
+	mailTimeout   = 30 * time.Second // Time given to the mail server to take an email, from the connection to the end
+)
+
+// listenForMail sends, in the background, every email that arrives in the mail channel. Several senders share the
+// channel, so that a slow mail server does not hold up the other emails, nor the handlers that queue them
+func listenForMail() {
+	for i := 0; i < mailSenders; i++ {
+		go func() {
+			for msg := range app.MailChan {
+				sendMsg(msg)
+			}
+		}()
+	}
+}
+
+// sendMsg sends an HTML email through the mail server
+func sendMsg(m models.MailData) {
+	err := sendMail(mailServer, mailTimeout, m.From, m.To, buildMsg(m))
+	if err != nil {
+		errorLog.Println(err)
+	}
+}
+
+// buildMsg returns the HTML email <m> with its headers. Attachments are sent as a multipart message
+func buildMsg(m models.MailData) []byte {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "From: %s\r\n", m.From)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", m.Subject)
+	b.WriteString("MIME-Version: 1.0\r\n")
+
+	if len(m.Attachments) == 0 {
+		b.WriteString("Content-Type: text/html; charset=\"UTF-8\"\r\n")
+		b.WriteString("\r\n")
+		b.WriteString(m.Content)
+	} else {
+		mw := multipart.NewWriter(&b)
+		fmt.Fprintf(&b, "Content-Type: multipart/mixed; boundary=%q\r\n", mw.Boundary())
+		b.WriteString("\r\n")
+
+		part, _ := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {"text/html; charset=\"UTF-8\""},
+		})
+		part.Write([]byte(m.Content))
+
+		for _, a := range m.Attachments {
+			part, _ = mw.CreatePart(textproto.MIMEHeader{
+				"Content-Type":              {a.ContentType},
+				"Content-Transfer-Encoding": {"base64"},
+				"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", a.Name)},
+			})
+
+			// Lines of a message must not be longer than 76 characters
+			encoded := base64.StdEncoding.EncodeToString(a.Data)
+			for len(encoded) > 76 {
+				part.Write([]byte(encoded[:76] + "\r\n"))
+				encoded = encoded[76:]
+			}
+			part.Write([]byte(encoded + "\r\n"))
+		}
+
+		mw.Close()
+	}
+
+	return []byte(b.String())
+}
+
+// sendMail sends the message <msg> from <from> to <to> through the SMTP server at <addr>, like smtp.SendMail, but gives
+// up when the server has not taken it within <timeout>
+func sendMail(addr string, timeout time.Duration, from, to string, msg []byte) error {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err = conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+
+	if err = c.Mail(from); err != nil {
+		return err
+	}
+
+	if err = c.Rcpt(to); err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
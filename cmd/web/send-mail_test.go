@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wagnojunior/booking/internal/models"
+)
+
+// fakeMailServer answers one SMTP conversation on a local address, and sends the message it received to <received>
+func fakeMailServer(t *testing.T, received chan<- string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		tp := textproto.NewConn(conn)
+		tp.PrintfLine("220 localhost ESMTP")
+
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+
+			switch {
+			case strings.HasPrefix(line, "EHLO"), strings.HasPrefix(line, "HELO"),
+				strings.HasPrefix(line, "MAIL"), strings.HasPrefix(line, "RCPT"):
+				tp.PrintfLine("250 OK")
+			case line == "DATA":
+				tp.PrintfLine("354 Go ahead")
+				data, _ := tp.ReadDotBytes()
+				received <- string(data)
+				tp.PrintfLine("250 OK")
+			case line == "QUIT":
+				tp.PrintfLine("221 Bye")
+				return
+			default:
+				tp.PrintfLine("502 Not implemented")
+			}
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func TestSendMail(t *testing.T) {
+	received := make(chan string, 1)
+	addr := fakeMailServer(t, received)
+
+	msg := buildMsg(models.MailData{
+		To:      "john@smith.com",
+		From:    "bookings@panpanzinho.com",
+		Subject: "Reservation confirmation",
+		Content: "<strong>Reservation Confirmation</strong>",
+		Attachments: []models.MailAttachment{
+			{Name: "invoice.pdf", ContentType: "application/pdf", Data: []byte("%PDF-1.4")},
+		},
+	})
+
+	if err := sendMail(addr, time.Second, "bookings@panpanzinho.com", "john@smith.com", msg); err != nil {
+		t.Fatal(err)
+	}
+
+	data := <-received
+	if !strings.Contains(data, "Subject: Reservation confirmation") || !strings.Contains(data, `filename="invoice.pdf"`) {
+		t.Errorf("the mail server received an unexpected message:\n%s", data)
+	}
+}
+
+func TestSendMail_Timeout(t *testing.T) {
+	// The server takes the connection but never answers
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(5 * time.Second)
+		}
+	}()
+
+	start := time.Now()
+	err = sendMail(l.Addr().String(), 100*time.Millisecond, "bookings@panpanzinho.com", "john@smith.com", []byte("Subject: Hi\r\n\r\nHi"))
+	if err == nil {
+		t.Fatal("expected the silent mail server to time out")
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected to give up after the timeout but waited %s", elapsed)
+	}
+}
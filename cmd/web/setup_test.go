@@ -6,10 +6,15 @@ import (
 	"net/http"
 	"os"
 	"testing"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/wagnojunior/booking/internal/clock"
 )
 
 func TestMain(m *testing.M) {
 	// Place to setup the test environment
+	session = scs.New()
+	app.Clock = clock.Real{}
 
 	// <m.Run()> runs all other tests, then exit
 	os.Exit(m.Run())
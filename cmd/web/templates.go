@@ -0,0 +1,24 @@
+package main
+
+import (
+	"time"
+
+	"github.com/wagnojunior/booking/internal/render"
+)
+
+// templateWatchInterval is how often the template files are checked for changes in development
+const templateWatchInterval = time.Second
+
+// watchTemplates parses the templates, in the background, right away and then whenever they change, checking
+// every <interval>
+func watchTemplates(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			render.ReloadTemplates()
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"time"
+
+	"github.com/wagnojunior/booking/internal/handlers"
+)
+
+// webhookDeliveryInterval is how often the due webhook deliveries are sent
+const webhookDeliveryInterval = 30 * time.Second
+
+// deliverWebhooks sends, in the background, the due webhook deliveries right away and then every <interval>
+func deliverWebhooks(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			handlers.Repo.DeliverWebhooks()
+			<-ticker.C
+		}
+	}()
+}
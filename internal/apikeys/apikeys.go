@@ -0,0 +1,52 @@
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+)
+
+// keyPrefix starts every API key, so that leaked keys are easy to recognise
+const keyPrefix = "bk_"
+
+// Generate returns a new API key, the prefix that identifies it and the hash under which it is stored.
+// Keys have the form bk_<prefix>_<secret>
+func Generate() (key, prefix, hash string, err error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+
+	s := hex.EncodeToString(b)
+	prefix = s[:8]
+	key = keyPrefix + prefix + "_" + s[8:]
+
+	return key, prefix, Hash(key), nil
+}
+
+// Prefix returns the prefix that identifies the API key <key>, and false when <key> is not an API key
+func Prefix(key string) (string, bool) {
+	if !strings.HasPrefix(key, keyPrefix) {
+		return "", false
+	}
+
+	prefix, secret, ok := strings.Cut(key[len(keyPrefix):], "_")
+	if !ok || prefix == "" || secret == "" {
+		return "", false
+	}
+
+	return prefix, true
+}
+
+// Hash returns the hash under which the API key <key> is stored
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify checks in constant time that <hash> is the hash of the API key <key>
+func Verify(key, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(Hash(key)), []byte(hash)) == 1
+}
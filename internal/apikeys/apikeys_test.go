@@ -0,0 +1,36 @@
+package apikeys
+
+import "testing"
+
+func TestGenerate(t *testing.T) {
+	key, prefix, hash, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, ok := Prefix(key)
+	if !ok || p != prefix {
+		t.Errorf("expected the prefix %s but got %s", prefix, p)
+	}
+
+	if !Verify(key, hash) {
+		t.Error("expected the key to match its hash")
+	}
+
+	if Verify(key+"x", hash) {
+		t.Error("expected another key not to match the hash")
+	}
+
+	other, _, _, _ := Generate()
+	if other == key {
+		t.Error("expected two keys to differ")
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	for _, key := range []string{"", "abc", "bk_", "bk_abc", "bk__secret", "bk_abc_", "xx_abc_secret"} {
+		if _, ok := Prefix(key); ok {
+			t.Errorf("expected %q not to be an API key", key)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package cancellation
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/wagnojunior/booking/internal/models"
+	"github.com/wagnojunior/booking/internal/stayrules"
+)
+
+// Flexible is the policy of the rooms without a cancellation policy: free cancellation until the arrival day
+var Flexible = models.CancellationPolicy{
+	Name:           "Flexible",
+	PenaltyPercent: 100,
+}
+
+// Select returns the policy of the <policies> that applies to the priced reservation <res>.
+// A policy for the room and the rate of the arrival night wins over a policy for the rate, which wins over a
+// policy for the room, which wins over a policy for every room. Flexible is returned when none applies
+func Select(policies []models.CancellationPolicy, res models.Reservation) models.CancellationPolicy {
+	rateName := ""
+	if len(res.Price.Nights) > 0 {
+		rateName = res.Price.Nights[0].RateName
+	}
+
+	best := Flexible
+	bestScore := -1
+
+	for _, policy := range policies {
+		if policy.RoomID != 0 && policy.RoomID != res.RoomID {
+			continue
+		}
+
+		if policy.RateName != "" && policy.RateName != rateName {
+			continue
+		}
+
+		score := 0
+		if policy.RateName != "" {
+			score += 2
+		}
+		if policy.RoomID != 0 {
+			score++
+		}
+
+		if score > bestScore {
+			best = policy
+			bestScore = score
+		}
+	}
+
+	return best
+}
+
+// Refund returns how much of the amount <paid> is given back when a reservation arriving on <arrival> under the
+// <policy> is cancelled on <today>
+func Refund(policy models.CancellationPolicy, paid int, arrival, today time.Time) int {
+	if policy.NonRefundable || paid <= 0 {
+		return 0
+	}
+
+	if stayrules.Nights(today, arrival) >= policy.FreeUntilDays {
+		return paid
+	}
+
+	penalty := int(math.Round(float64(paid*policy.PenaltyPercent) / 100))
+	if penalty > paid {
+		penalty = paid
+	}
+
+	return paid - penalty
+}
+
+// Summary explains the <policy> to a guest arriving on <arrival>, e.g.
+// "Free cancellation until 2022-03-05. After that, 50% of the amount paid is charged."
+func Summary(policy models.CancellationPolicy, arrival time.Time) string {
+	if policy.NonRefundable {
+		return "This reservation is non-refundable."
+	}
+
+	s := fmt.Sprintf("Free cancellation until %s.", Deadline(policy, arrival).Format("2006-01-02"))
+
+	switch {
+	case policy.PenaltyPercent >= 100:
+		s += " After that, the reservation is non-refundable."
+	case policy.PenaltyPercent > 0:
+		s += fmt.Sprintf(" After that, %d%% of the amount paid is charged.", policy.PenaltyPercent)
+	}
+
+	return s
+}
+
+// Deadline returns the last day a reservation arriving on <arrival> can be cancelled for free under the <policy>
+func Deadline(policy models.CancellationPolicy, arrival time.Time) time.Time {
+	return arrival.AddDate(0, 0, -policy.FreeUntilDays)
+}
@@ -0,0 +1,93 @@
+package cancellation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wagnojunior/booking/internal/models"
+)
+
+func date(s string) time.Time {
+	d, _ := time.Parse("2006-01-02", s)
+	return d
+}
+
+var policies = []models.CancellationPolicy{
+	{Name: "Moderate", FreeUntilDays: 7, PenaltyPercent: 50},
+	{Name: "Strict", RoomID: 1, FreeUntilDays: 14, PenaltyPercent: 100},
+	{Name: "Weekend", RateName: "Weekend", NonRefundable: true},
+	{Name: "Panda weekend", RoomID: 1, RateName: "Weekend", FreeUntilDays: 3, PenaltyPercent: 20},
+}
+
+var selectTests = []struct {
+	name     string
+	roomID   int
+	rateName string
+	policies []models.CancellationPolicy
+	expected string
+}{
+	{"no policy", 2, "Base", nil, "Flexible"},
+	{"every room", 2, "Base", policies, "Moderate"},
+	{"room wins over every room", 1, "Base", policies, "Strict"},
+	{"rate wins over room", 2, "Weekend", policies, "Weekend"},
+	{"room and rate wins over rate", 1, "Weekend", policies, "Panda weekend"},
+}
+
+func TestSelect(t *testing.T) {
+	for _, e := range selectTests {
+		res := models.Reservation{
+			RoomID: e.roomID,
+			Price: models.PriceQuote{
+				Nights: []models.NightlyPrice{{RateName: e.rateName}},
+			},
+		}
+
+		if policy := Select(e.policies, res); policy.Name != e.expected {
+			t.Errorf("For %s, expected %s but got %s", e.name, e.expected, policy.Name)
+		}
+	}
+}
+
+var refundTests = []struct {
+	name     string
+	policy   models.CancellationPolicy
+	today    string
+	expected int
+}{
+	{"free", policies[0], "2022-03-01", 10000},
+	{"last free day", policies[0], "2022-03-03", 10000},
+	{"penalty", policies[0], "2022-03-04", 5000},
+	{"after arrival", Flexible, "2022-03-11", 0},
+	{"arrival day is free", Flexible, "2022-03-10", 10000},
+	{"non-refundable", policies[2], "2022-01-01", 0},
+}
+
+func TestRefund(t *testing.T) {
+	arrival := date("2022-03-10")
+
+	for _, e := range refundTests {
+		if refund := Refund(e.policy, 10000, arrival, date(e.today)); refund != e.expected {
+			t.Errorf("For %s, expected a refund of %d but got %d", e.name, e.expected, refund)
+		}
+	}
+}
+
+func TestSummary(t *testing.T) {
+	arrival := date("2022-03-10")
+
+	var summaryTests = []struct {
+		policy   models.CancellationPolicy
+		expected string
+	}{
+		{policies[0], "Free cancellation until 2022-03-03. After that, 50% of the amount paid is charged."},
+		{Flexible, "Free cancellation until 2022-03-10. After that, the reservation is non-refundable."},
+		{models.CancellationPolicy{FreeUntilDays: 1}, "Free cancellation until 2022-03-09."},
+		{policies[2], "This reservation is non-refundable."},
+	}
+
+	for _, e := range summaryTests {
+		if s := Summary(e.policy, arrival); s != e.expected {
+			t.Errorf("expected %q but got %q", e.expected, s)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2050, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := NewFake(start)
+
+	if !c.Now().Equal(start) || !c.Now().Equal(c.Now()) {
+		t.Errorf("expected the clock to stay at %v but got %v", start, c.Now())
+	}
+
+	c.Advance(36 * time.Hour)
+	if !c.Now().Equal(start.Add(36 * time.Hour)) {
+		t.Errorf("expected the clock to be advanced by 36 hours but got %v", c.Now())
+	}
+
+	c.Set(start)
+	if !c.Now().Equal(start) {
+		t.Errorf("expected the clock to be set back to %v but got %v", start, c.Now())
+	}
+}
+
+func TestReal(t *testing.T) {
+	var c Clock = Real{}
+
+	before := time.Now()
+	now := c.Now()
+	if now.Before(before) || now.After(time.Now()) {
+		t.Errorf("expected the current time but got %v", now)
+	}
+}
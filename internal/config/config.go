@@ -3,8 +3,14 @@ package config
 import (
 	"html/template"
 	"log"
+	"net"
+	"net/http"
 
 	"github.com/alexedwards/scs/v2"
+	"github.com/wagnojunior/booking/internal/clock"
+	"github.com/wagnojunior/booking/internal/models"
+	"github.com/wagnojunior/booking/internal/payments"
+	"github.com/wagnojunior/booking/internal/property"
 )
 
 // AppConfig holds the application configuration, which is accessible to every package that imports the <config>
@@ -19,4 +25,38 @@ type AppConfig struct {
 	ErrorLog      *log.Logger
 	InProduction  bool
 	Session       *scs.SessionManager
+
+	// HTTPS is set when the site is reached over HTTPS, either served here or through a reverse proxy.
+	// The cookies are then only sent over HTTPS, and the plain HTTP requests are redirected
+	HTTPS bool
+
+	// TrustedProxies are the networks of the reverse proxies whose X-Forwarded-Proto and X-Forwarded-For
+	// headers are believed. The headers of any other client are ignored
+	TrustedProxies []*net.IPNet
+
+	// PropertyName is the name of the property, as printed on the invoices
+	PropertyName string
+
+	// Domain is the internet domain of the property, which makes the UIDs of the calendar events unique. The
+	// absolute links of the site, such as those sent by email, point to it
+	Domain string
+
+	// Clock tells the time, to everything that depends on it. The tests use a fake clock
+	Clock clock.Clock
+
+	// Property holds the time zone of the property and its check-in, check-out and same-day booking times
+	Property property.Settings
+
+	// Currency is the ISO 4217 code in which room prices are stored and displayed
+	Currency string
+
+	// MailChan queues the emails that are sent in the background by the mail listener
+	MailChan chan models.MailData
+	MailFrom string
+
+	// PaymentGateway is the provider through which the reservations are paid
+	PaymentGateway payments.PaymentGateway
+
+	// HTTPClient makes the requests to other services, such as the calendars of other channels
+	HTTPClient *http.Client
 }
@@ -0,0 +1,55 @@
+package csp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+)
+
+// cdns serve the stylesheets and scripts of the templates (Bootstrap, the date picker, notie and SweetAlert)
+var cdns = []string{"https://cdn.jsdelivr.net", "https://unpkg.com"}
+
+// Policy returns the Content-Security-Policy of a page whose inline scripts carry <nonce>. Scripts only run from the
+// site, the CDNs and the inline scripts with the nonce. Inline styles are allowed because the alerts and the date
+// picker style the elements they create
+func Policy(nonce string) string {
+	directives := []string{
+		"default-src 'self'",
+		"script-src 'self' 'nonce-" + nonce + "' " + strings.Join(cdns, " "),
+		"style-src 'self' 'unsafe-inline' " + strings.Join(cdns, " "),
+		"img-src 'self' data:",
+		"font-src 'self' " + strings.Join(cdns, " "),
+		"connect-src 'self'",
+		"object-src 'none'",
+		"base-uri 'self'",
+		"form-action 'self'",
+		"frame-ancestors 'none'",
+	}
+
+	return strings.Join(directives, "; ")
+}
+
+// NewNonce returns a random nonce for the inline scripts of a response
+func NewNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// contextKey is the type of the key of the nonce in the context of a request
+type contextKey struct{}
+
+// WithNonce returns a copy of <ctx> that carries the nonce <nonce>
+func WithNonce(ctx context.Context, nonce string) context.Context {
+	return context.WithValue(ctx, contextKey{}, nonce)
+}
+
+// Nonce returns the nonce carried by <ctx>, or "" when there is none
+func Nonce(ctx context.Context) string {
+	nonce, _ := ctx.Value(contextKey{}).(string)
+	return nonce
+}
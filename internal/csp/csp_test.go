@@ -0,0 +1,40 @@
+package csp
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	policy := Policy("abc123")
+
+	for _, directive := range []string{"script-src 'self' 'nonce-abc123'", "frame-ancestors 'none'", "object-src 'none'"} {
+		if !strings.Contains(policy, directive) {
+			t.Errorf("expected the policy to contain %q but got %s", directive, policy)
+		}
+	}
+
+	for _, directive := range strings.Split(policy, "; ") {
+		if strings.HasPrefix(directive, "script-src") && strings.Contains(directive, "'unsafe-inline'") {
+			t.Error("expected the inline scripts to need the nonce")
+		}
+	}
+}
+
+func TestNonce(t *testing.T) {
+	a, err := NewNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NewNonce()
+
+	if a == "" || a == b {
+		t.Errorf("expected different nonces but got %q and %q", a, b)
+	}
+
+	ctx := WithNonce(context.Background(), a)
+	if Nonce(ctx) != a || Nonce(context.Background()) != "" {
+		t.Error("expected the nonce to be carried by the context only")
+	}
+}
@@ -0,0 +1,331 @@
+package forms
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDateLayout is the layout of the dates of a form, unless the field has a layout tag
+const DefaultDateLayout = "2006-01-02"
+
+// Rule is a custom validation rule. It checks the field <field> of the form <f> with the parameter <param> of the
+// rule (e.g. "3" in min=3, empty when there is none), adds the error of the field when it is not valid and reports
+// whether it is
+type Rule func(f *Form, field, param string) bool
+
+// customRules are the rules added with RegisterRule, by name
+var customRules = struct {
+	sync.RWMutex
+	rules map[string]Rule
+}{rules: map[string]Rule{}}
+
+// RegisterRule adds the custom rule <rule>, which the validate tags use as <name> or <name>=<param>
+func RegisterRule(name string, rule Rule) {
+	customRules.Lock()
+	defer customRules.Unlock()
+
+	customRules.rules[name] = rule
+}
+
+// patterns holds the compiled regular expressions of the regexp rules, by expression
+var patterns sync.Map
+
+// Bind copies the values of the form into the fields of the struct that <dst> points to, and checks them against
+// their rules. A field is bound to the form value named by its form tag, and its rules are the comma separated
+// validate tag, e.g.
+//
+//	FirstName string    `form:"first_name" validate:"required,min=3"`
+//	Arrival   time.Time `form:"start_date" layout:"2006-01-02" validate:"required"`
+//	Departure time.Time `form:"end_date" validate:"required,after=start_date"`
+//
+// The rules are
+//
+//	required        the value is not blank
+//	min=n, max=n    the length of a string, or the value of a number, is at least / at most n
+//	email           an email address
+//	phone           a phone number in the international E.164 format, e.g. +14155550123
+//	after=field     a date after the date of another field, which has the same layout
+//	eqfield=field   the same value as another field
+//	regexp=expr     the value matches the regular expression. It must be the last rule, as expr may hold commas
+//
+// and the rules added with RegisterRule. The rules other than required let empty values through, so that the fields
+// are optional unless they are required. The first rule that fails gives the error of the field.
+//
+// Strings, numbers, booleans, dates (time.Time, with the layout of the layout tag or DefaultDateLayout, or in ISO 8601,
+// in the time zone of the form) and slices of strings can be bound. A value that cannot be converted to its field is an error of the field. The returned error
+// is only about <dst> and its tags, which are programming errors, and not about the values
+func (f *Form) Bind(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("forms: Bind needs a pointer to a struct, not %T", dst)
+	}
+
+	return f.bind(v.Elem())
+}
+
+// bind binds the values of the form into the fields of the struct <v>
+func (f *Form) bind(v reflect.Value) error {
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+
+		// The fields of an embedded struct are bound as if they were fields of the outer struct
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct && sf.Type != timeType && sf.Tag.Get("form") == "" {
+			if err := f.bind(v.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := sf.Tag.Get("form")
+		if name == "" || name == "-" || !sf.IsExported() {
+			continue
+		}
+
+		layout := sf.Tag.Get("layout")
+		if layout == "" {
+			layout = DefaultDateLayout
+		}
+
+		if err := f.validate(name, sf.Tag.Get("validate"), v.Field(i).Kind(), layout); err != nil {
+			return fmt.Errorf("forms: field %s: %w", sf.Name, err)
+		}
+
+		if err := f.set(v.Field(i), name, layout); err != nil {
+			return fmt.Errorf("forms: field %s: %w", sf.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// validate checks the value <field> against the rules of the validate tag <tag>. <kind> is the kind of the struct
+// field, which decides if min and max are about the length or the value, and <layout> is the layout of its dates
+func (f *Form) validate(field, tag string, kind reflect.Kind, layout string) error {
+	for tag != "" {
+		var rule string
+		if strings.HasPrefix(tag, "regexp=") {
+			rule, tag = tag, ""
+		} else {
+			rule, tag, _ = strings.Cut(tag, ",")
+		}
+
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+
+		if name != "required" && strings.TrimSpace(f.Get(field)) == "" {
+			continue
+		}
+
+		ok, err := f.check(field, name, param, kind, layout)
+		if err != nil {
+			return err
+		}
+
+		// Only the first error of a field is shown
+		if !ok {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// check checks the value <field> against the rule <name> with the parameter <param>
+func (f *Form) check(field, name, param string, kind reflect.Kind, layout string) (bool, error) {
+	switch name {
+	case "required":
+		if strings.TrimSpace(f.Get(field)) == "" {
+			f.Errors.Add(field, "form.required")
+			return false, nil
+		}
+		return true, nil
+
+	case "min", "max":
+		n, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return false, fmt.Errorf("invalid %s=%s", name, param)
+		}
+
+		if isNumber(kind) {
+			if name == "min" {
+				return f.Min(field, n), nil
+			}
+			return f.Max(field, n), nil
+		}
+
+		if name == "min" {
+			return f.MinLength(field, int(n)), nil
+		}
+		return f.MaxLength(field, int(n)), nil
+
+	case "email":
+		return f.IsEmail(field), nil
+
+	case "phone":
+		return f.IsPhone(field), nil
+
+	case "after":
+		return f.DateAfter(field, param, layout), nil
+
+	case "eqfield":
+		return f.Equal(field, param), nil
+
+	case "regexp":
+		re, err := pattern(param)
+		if err != nil {
+			return false, err
+		}
+		return f.Matches(field, re), nil
+	}
+
+	customRules.RLock()
+	rule, ok := customRules.rules[name]
+	customRules.RUnlock()
+
+	if !ok {
+		return false, fmt.Errorf("unknown rule %q", name)
+	}
+
+	return rule(f, field, param), nil
+}
+
+// pattern returns the compiled regular expression <expr>
+func pattern(expr string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(expr, re)
+
+	return re, nil
+}
+
+// isNumber checks if <kind> is a kind of number
+func isNumber(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+
+	return false
+}
+
+// timeType is the type of the date fields
+var timeType = reflect.TypeOf(time.Time{})
+
+// set converts the value <field> of the form to the type of the struct field <v> and sets it. An empty value leaves
+// the zero value. A value that cannot be converted adds an error to the field, unless it already has one
+func (f *Form) set(v reflect.Value, field, layout string) error {
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String {
+		v.Set(reflect.ValueOf(append([]string(nil), f.Values[field]...)).Convert(v.Type()))
+		return nil
+	}
+
+	raw := f.Get(field)
+	value := strings.TrimSpace(raw)
+	if value == "" {
+		return nil
+	}
+
+	invalid := func(key string, args ...interface{}) {
+		if len(f.Errors[field]) == 0 {
+			f.Errors.Add(field, key, args...)
+		}
+	}
+
+	switch {
+	case v.Type() == timeType:
+		date, err := ParseDate(value, layout, f.Location)
+		if err != nil {
+			invalid("form.invalid_date", displayLayout(layout))
+			return nil
+		}
+		v.Set(reflect.ValueOf(date))
+
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+
+	case v.Kind() == reflect.Bool:
+		// A checked checkbox posts "on"
+		b, err := strconv.ParseBool(value)
+		if value == "on" {
+			b, err = true, nil
+		}
+		if err != nil {
+			invalid("form.invalid_format")
+			return nil
+		}
+		v.SetBool(b)
+
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			invalid("form.invalid_number")
+			return nil
+		}
+		v.SetInt(n)
+
+	case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			invalid("form.invalid_number")
+			return nil
+		}
+		v.SetUint(n)
+
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		n, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			invalid("form.invalid_number")
+			return nil
+		}
+		v.SetFloat(n)
+
+	default:
+		return fmt.Errorf("cannot bind to a %s", v.Type())
+	}
+
+	return nil
+}
+
+// BindJSON binds the JSON object <body> into the struct that <dst> points to, like Bind does with the values of a
+// form: the keys of the object are the names of the form tags. It returns the form, with the errors of the fields,
+// and an error when the body is not a JSON object or <dst> cannot be bound
+func BindJSON(body io.Reader, dst interface{}) (*Form, error) {
+	var object map[string]interface{}
+
+	dec := json.NewDecoder(body)
+	dec.UseNumber()
+	if err := dec.Decode(&object); err != nil {
+		return New(url.Values{}), err
+	}
+
+	values := url.Values{}
+	for key, value := range object {
+		switch value := value.(type) {
+		case nil:
+		case []interface{}:
+			for _, x := range value {
+				values.Add(key, fmt.Sprint(x))
+			}
+		default:
+			values.Set(key, fmt.Sprint(value))
+		}
+	}
+
+	form := New(values)
+	return form, form.Bind(dst)
+}
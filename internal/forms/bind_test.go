@@ -0,0 +1,189 @@
+package forms
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type address struct {
+	City string `form:"city" validate:"required"`
+}
+
+type signup struct {
+	address
+	Name     string    `form:"name" validate:"required,min=3,max=10"`
+	Email    string    `form:"email" validate:"email"`
+	Phone    string    `form:"phone" validate:"phone"`
+	Age      int       `form:"age" validate:"min=18,max=120"`
+	Code     string    `form:"code" validate:"regexp=^[A-Z]{2,3}$"`
+	Password string    `form:"password"`
+	Confirm  string    `form:"confirm" validate:"eqfield=password"`
+	Arrival  time.Time `form:"arrival" validate:"required"`
+	Leave    time.Time `form:"leave" validate:"after=arrival"`
+	Birthday time.Time `form:"birthday" layout:"02/01/2006"`
+	Agree    bool      `form:"agree"`
+	Tags     []string  `form:"tags"`
+	ignored  string
+}
+
+func TestForm_Bind(t *testing.T) {
+	values := url.Values{
+		"city":     {"Lisbon"},
+		"name":     {"Jürgen"},
+		"email":    {"j@example.com"},
+		"phone":    {"+351912345678"},
+		"age":      {"30"},
+		"code":     {"PT"},
+		"password": {"secret"},
+		"confirm":  {"secret"},
+		"arrival":  {"2050-03-01"},
+		"birthday": {"25/12/1990"},
+		"agree":    {"on"},
+		"tags":     {"a", "b"},
+	}
+
+	var s signup
+	form := New(values)
+	if err := form.Bind(&s); err != nil {
+		t.Fatal(err)
+	}
+
+	if !form.Valid() {
+		t.Fatalf("expected the form to be valid but got %v", form.Errors.Messages("en"))
+	}
+
+	if s.City != "Lisbon" || s.Name != "Jürgen" || s.Age != 30 || !s.Agree || len(s.Tags) != 2 {
+		t.Errorf("the values were not bound: %+v", s)
+	}
+
+	if !s.Arrival.Equal(time.Date(2050, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the arrival to be 2050-03-01 but got %v", s.Arrival)
+	}
+
+	if !s.Birthday.Equal(time.Date(1990, 12, 25, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the birthday to be parsed with its layout but got %v", s.Birthday)
+	}
+
+	if !s.Leave.IsZero() {
+		t.Errorf("expected an empty optional date to be left zero but got %v", s.Leave)
+	}
+}
+
+func TestForm_BindErrors(t *testing.T) {
+	tests := []struct {
+		field string
+		value string
+		key   string
+	}{
+		{"city", "", "form.required"},
+		{"name", "Jo", "form.min_length"},
+		{"name", "Johnathan Smith", "form.max_length"},
+		{"email", "me", "form.invalid_email"},
+		{"phone", "555-1234", "form.invalid_phone"},
+		{"age", "12", "form.min_value"},
+		{"age", "200", "form.max_value"},
+		{"age", "thirty", "form.invalid_number"},
+		{"code", "P,T", "form.invalid_format"},
+		{"confirm", "other", "form.not_equal"},
+		{"arrival", "March 1st", "form.invalid_date"},
+		{"leave", "2050-02-01", "form.after"},
+		{"birthday", "12/25/1990", "form.invalid_date"},
+		{"agree", "maybe", "form.invalid_format"},
+	}
+
+	for _, test := range tests {
+		values := url.Values{
+			"city":     {"Lisbon"},
+			"name":     {"John"},
+			"password": {"secret"},
+			"confirm":  {"secret"},
+			"arrival":  {"2050-03-01"},
+		}
+		values.Set(test.field, test.value)
+
+		var s signup
+		form := New(values)
+		if err := form.Bind(&s); err != nil {
+			t.Fatal(err)
+		}
+
+		es := form.Errors[test.field]
+		if len(es) != 1 || es[0].key != test.key {
+			t.Errorf("%s=%q: expected the error %s but got %v", test.field, test.value, test.key, es)
+		}
+	}
+}
+
+func TestForm_BindProgrammingErrors(t *testing.T) {
+	form := New(url.Values{"a": {"1"}})
+
+	var s signup
+	if err := form.Bind(s); err == nil {
+		t.Error("expected an error for a struct that is not a pointer")
+	}
+
+	var unknown struct {
+		A string `form:"a" validate:"nope"`
+	}
+	if err := form.Bind(&unknown); err == nil || !strings.Contains(err.Error(), "nope") {
+		t.Errorf("expected an error for the unknown rule but got %v", err)
+	}
+
+	var unsupported struct {
+		A map[string]string `form:"a"`
+	}
+	if err := form.Bind(&unsupported); err == nil {
+		t.Error("expected an error for a field that cannot be bound")
+	}
+}
+
+func TestRegisterRule(t *testing.T) {
+	RegisterRule("prefix", func(f *Form, field, param string) bool {
+		if !strings.HasPrefix(f.Get(field), param) {
+			f.Errors.Add(field, "form.invalid_format")
+			return false
+		}
+		return true
+	})
+
+	var s struct {
+		Key string `form:"key" validate:"required,prefix=bk_"`
+	}
+
+	form := New(url.Values{"key": {"bk_123"}})
+	if err := form.Bind(&s); err != nil || !form.Valid() {
+		t.Errorf("expected the key to be valid but got %v, %v", err, form.Errors.Messages("en"))
+	}
+
+	form = New(url.Values{"key": {"123"}})
+	if err := form.Bind(&s); err != nil || form.Valid() {
+		t.Errorf("expected the key to be invalid but got %v", err)
+	}
+}
+
+func TestBindJSON(t *testing.T) {
+	var s struct {
+		Name   string   `form:"name" validate:"required"`
+		Guests int      `form:"guests" validate:"min=1"`
+		Tags   []string `form:"tags"`
+	}
+
+	form, err := BindJSON(strings.NewReader(`{"name": "John", "guests": 0, "tags": ["a", "b"]}`), &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Name != "John" || len(s.Tags) != 2 {
+		t.Errorf("the values were not bound: %+v", s)
+	}
+
+	if form.Errors.Get("guests") == "" {
+		t.Error("expected an error for guests")
+	}
+
+	if _, err := BindJSON(strings.NewReader(`[1, 2]`), &s); err == nil {
+		t.Error("expected an error for a body that is not an object")
+	}
+}
@@ -0,0 +1,115 @@
+package forms
+
+import (
+	"strings"
+	"time"
+)
+
+// isoLayouts are the ISO 8601 layouts that every date field accepts, besides its own layout
+var isoLayouts = []string{"2006-01-02", time.RFC3339}
+
+// ParseDate parses the date <value>, written with the layout <layout> or in ISO 8601, e.g. 2050-03-01 or
+// 2050-03-01T15:00:00+09:00. The date is the calendar day in the time zone <loc> (UTC when nil), at midnight UTC
+// like the dates of the database
+func ParseDate(value, layout string, loc *time.Location) (time.Time, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	value = strings.TrimSpace(value)
+
+	t, err := time.ParseInLocation(layout, value, loc)
+	for _, iso := range isoLayouts {
+		if err == nil {
+			break
+		}
+		t, err = time.ParseInLocation(iso, value, loc)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// A time with its own offset, e.g. in RFC 3339, is on the day it is at the property
+	t = t.In(loc)
+
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+}
+
+// IsDate checks that the field is a date with the layout <layout>, e.g. 2006-01-02, or in ISO 8601
+func (f *Form) IsDate(field, layout string) bool {
+	_, ok := f.date(field, layout)
+	return ok
+}
+
+// DateAfter checks that the date of the field is after the date of the field <other>, both with the layout <layout>.
+// It is used for the ranges of dates, e.g. the departure after the arrival. An invalid <other> date is left to
+// the checks of that field
+func (f *Form) DateAfter(field, other, layout string) bool {
+	date, ok := f.date(field, layout)
+	if !ok {
+		return false
+	}
+
+	otherDate, err := ParseDate(f.Get(other), layout, f.Location)
+	if err == nil && !date.After(otherDate) {
+		f.Errors.Add(field, "form.after", strings.TrimSpace(f.Get(other)))
+		return false
+	}
+	return true
+}
+
+// NotInPast checks that the date of the field, with the layout <layout>, is not before the day of <now> in the time
+// zone of the form. Today is allowed
+func (f *Form) NotInPast(field, layout string, now time.Time) bool {
+	date, ok := f.date(field, layout)
+	if !ok {
+		return false
+	}
+
+	loc := f.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	now = now.In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	if date.Before(today) {
+		f.Errors.Add(field, "form.in_past")
+		return false
+	}
+	return true
+}
+
+// MaxRange checks that the date of the field <end> is at most <days> days after the date of the field <start>,
+// both with the layout <layout>. Invalid dates are left to the checks of their fields
+func (f *Form) MaxRange(start, end, layout string, days int) bool {
+	startDate, err := ParseDate(f.Get(start), layout, f.Location)
+	if err != nil {
+		return true
+	}
+
+	endDate, err := ParseDate(f.Get(end), layout, f.Location)
+	if err != nil {
+		return true
+	}
+
+	if endDate.After(startDate.AddDate(0, 0, days)) {
+		f.Errors.Add(end, "form.max_range", days)
+		return false
+	}
+	return true
+}
+
+// date returns the field as a date with the layout <layout>, or adds an error when it is not one
+func (f *Form) date(field, layout string) (time.Time, bool) {
+	date, err := ParseDate(f.Get(field), layout, f.Location)
+	if err != nil {
+		f.Errors.Add(field, "form.invalid_date", displayLayout(layout))
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// displayLayout returns the date layout <layout> the way people read it, e.g. YYYY-MM-DD for 2006-01-02
+func displayLayout(layout string) string {
+	return strings.NewReplacer("2006", "YYYY", "01", "MM", "02", "DD").Replace(layout)
+}
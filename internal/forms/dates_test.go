@@ -0,0 +1,72 @@
+package forms
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+
+	tests := []struct {
+		value    string
+		loc      *time.Location
+		expected time.Time
+	}{
+		{"2050/03/01", nil, time.Date(2050, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"2050-03-01", nil, time.Date(2050, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"2050/03/01", tokyo, time.Date(2050, 3, 1, 0, 0, 0, 0, time.UTC)},
+		// 20:00 in UTC is already the next day in Tokyo
+		{"2050-03-01T20:00:00Z", tokyo, time.Date(2050, 3, 2, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		date, err := ParseDate(test.value, "2006/01/02", test.loc)
+		if err != nil {
+			t.Errorf("%s: %v", test.value, err)
+			continue
+		}
+
+		if !date.Equal(test.expected) || date.Location() != test.expected.Location() {
+			t.Errorf("%s: expected %v but got %v", test.value, test.expected, date)
+		}
+	}
+
+	if _, err := ParseDate("01/03/2050", "2006/01/02", nil); err == nil {
+		t.Error("expected an error for a date in another layout")
+	}
+}
+
+func TestForm_NotInPast(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+
+	// It is still the 1st of March in UTC, but already the 2nd in Tokyo
+	now := time.Date(2050, 3, 1, 20, 0, 0, 0, time.UTC)
+
+	form := New(url.Values{"start": {"2050/03/01"}})
+	if !form.NotInPast("start", "2006/01/02", now) {
+		t.Error("expected today to be allowed")
+	}
+
+	form.Location = tokyo
+	if form.NotInPast("start", "2006/01/02", now) || form.Errors.Get("start") == "" {
+		t.Error("expected yesterday in Tokyo to be in the past")
+	}
+}
+
+func TestForm_MaxRange(t *testing.T) {
+	form := New(url.Values{"start": {"2050/03/01"}, "end": {"2050/03/31"}, "bad": {"soon"}})
+
+	if !form.MaxRange("start", "end", "2006/01/02", 30) {
+		t.Error("expected 30 days to be allowed")
+	}
+
+	if form.MaxRange("start", "end", "2006/01/02", 29) || form.Errors.Get("end") == "" {
+		t.Error("expected 30 days to be longer than 29")
+	}
+
+	if !form.MaxRange("start", "bad", "2006/01/02", 1) || form.Errors.Get("bad") != "" {
+		t.Error("expected an invalid date to be left to the checks of its field")
+	}
+}
@@ -1,21 +1,47 @@
 package forms
 
-// errors is a custom type that maps a string to a slice of strings
+import "github.com/wagnojunior/booking/internal/i18n"
+
+// message is an error message: the key of the message in the catalogue, with the arguments it is formatted with.
+// A key that is not in the catalogue is shown as it is
+type message struct {
+	key  string
+	args []interface{}
+}
+
+// errors is a custom type that maps a string to a slice of messages
 // The map's key is a form field in <make-reservation.page.tmpl>
 // The map's value is a set of messages associated with a key
-type errors map[string][]string
+type errors map[string][]message
 
-// Add adds a message to a corresponding field in the variable e of type errors
-func (e errors) Add(field, message string) {
-	e[field] = append(e[field], message)
+// Add adds the message <key>, formatted with <args>, to a corresponding field in the variable e of type errors
+func (e errors) Add(field, key string, args ...interface{}) {
+	e[field] = append(e[field], message{key: key, args: args})
 }
 
-// Get gets a set of messages associated with a key and returns the first message
+// Get gets a set of messages associated with a key and returns the first message, in the default locale
 func (e errors) Get(field string) string {
+	return e.In(i18n.DefaultLocale, field)
+}
+
+// In returns the first message of <field> in <locale>
+func (e errors) In(locale, field string) string {
 	es := e[field]
 	if len(es) == 0 {
 		return ""
 	}
 
-	return es[0]
+	return i18n.T(locale, es[0].key, es[0].args...)
+}
+
+// Messages returns every message of every field in <locale>
+func (e errors) Messages(locale string) map[string][]string {
+	messages := make(map[string][]string, len(e))
+	for field, es := range e {
+		for _, m := range es {
+			messages[field] = append(messages[field], i18n.T(locale, m.key, m.args...))
+		}
+	}
+
+	return messages
 }
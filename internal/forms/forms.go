@@ -1,33 +1,48 @@
 package forms
 
 import (
-	"fmt"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/asaskevich/govalidator"
+	"github.com/wagnojunior/booking/internal/i18n"
 )
 
 // Form creates a custom form struct, embeds a url.Values object
 type Form struct {
 	url.Values
 	Errors errors
+	Locale string // Locale in which the errors are shown. It is set when the form is rendered
+
+	// Location is the time zone in which the dates of the form are interpreted, usually the one of the property.
+	// nil is UTC
+	Location *time.Location
 }
 
 // New initializes a form struct
 func New(data url.Values) *Form {
 	return &Form{
-		data,
-		errors(map[string][]string{}),
+		Values: data,
+		Errors: errors(map[string][]message{}),
+		Locale: i18n.DefaultLocale,
 	}
 }
 
+// Error returns the first error message of <field> in the locale of the form
+func (f *Form) Error(field string) string {
+	return f.Errors.In(f.Locale, field)
+}
+
 // Required checks for required fields in the form
 func (f *Form) Required(fields ...string) {
 	for _, field := range fields {
 		value := f.Get(field)
 		if strings.TrimSpace(value) == "" {
-			f.Errors.Add(field, "This field cannot be blank")
+			f.Errors.Add(field, "form.required")
 		}
 	}
 }
@@ -36,18 +51,89 @@ func (f *Form) Required(fields ...string) {
 func (f *Form) Has(field string) bool {
 	x := f.Get(field)
 	if x == "" {
-		f.Errors.Add(field, "This field cannot be blank")
+		f.Errors.Add(field, "form.required")
 		return false
 	}
 
 	return true
 }
 
-// MinLength checks for string minimum length
+// MinLength checks for string minimum length, in characters
 func (f *Form) MinLength(field string, length int) bool {
 	x := f.Get(field)
-	if len(x) < length {
-		f.Errors.Add(field, fmt.Sprintf("This field must be at least %d characters long", length))
+	if utf8.RuneCountInString(x) < length {
+		f.Errors.Add(field, "form.min_length", length)
+		return false
+	}
+	return true
+}
+
+// MaxLength checks for string maximum length, in characters
+func (f *Form) MaxLength(field string, length int) bool {
+	x := f.Get(field)
+	if utf8.RuneCountInString(x) > length {
+		f.Errors.Add(field, "form.max_length", length)
+		return false
+	}
+	return true
+}
+
+// Min checks that the field is a number that is at least <min>
+func (f *Form) Min(field string, min float64) bool {
+	x, ok := f.number(field)
+	if ok && x < min {
+		f.Errors.Add(field, "form.min_value", min)
+		return false
+	}
+	return ok
+}
+
+// Max checks that the field is a number that is at most <max>
+func (f *Form) Max(field string, max float64) bool {
+	x, ok := f.number(field)
+	if ok && x > max {
+		f.Errors.Add(field, "form.max_value", max)
+		return false
+	}
+	return ok
+}
+
+// number returns the field as a number, or adds an error when it is not one
+func (f *Form) number(field string) (float64, bool) {
+	x, err := strconv.ParseFloat(strings.TrimSpace(f.Get(field)), 64)
+	if err != nil {
+		f.Errors.Add(field, "form.invalid_number")
+		return 0, false
+	}
+	return x, true
+}
+
+// Matches checks that the field matches the regular expression <re>
+func (f *Form) Matches(field string, re *regexp.Regexp) bool {
+	if !re.MatchString(f.Get(field)) {
+		f.Errors.Add(field, "form.invalid_format")
+		return false
+	}
+	return true
+}
+
+// phoneNumber is a phone number in the international E.164 format: a plus sign, the country code and the number,
+// at most 15 digits in all
+var phoneNumber = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
+// IsPhone checks that the field is a phone number in the international E.164 format, e.g. +14155550123
+func (f *Form) IsPhone(field string) bool {
+	if !phoneNumber.MatchString(f.Get(field)) {
+		f.Errors.Add(field, "form.invalid_phone")
+		return false
+	}
+	return true
+}
+
+// Equal checks that the field has the same value as the field <other>, e.g. a password and its confirmation
+func (f *Form) Equal(field, other string) bool {
+	if f.Get(field) != f.Get(other) {
+		f.Errors.Add(field, "form.not_equal", other)
 		return false
 	}
 	return true
@@ -60,8 +146,10 @@ func (f *Form) Valid() bool {
 }
 
 // IsEmail checks for valid email address
-func (f *Form) IsEmail(field string) {
+func (f *Form) IsEmail(field string) bool {
 	if !govalidator.IsEmail(f.Get(field)) {
-		f.Errors.Add(field, "Invalid email address")
+		f.Errors.Add(field, "form.invalid_email")
+		return false
 	}
+	return true
 }
@@ -101,3 +101,57 @@ func TestForm_IsEmail(t *testing.T) {
 		t.Error("form shows invalid email adress when it should be valid")
 	}
 }
+
+func TestForm_ErrorTranslated(t *testing.T) {
+	form := New(url.Values{})
+	form.Required("a")
+
+	if msg := form.Error("a"); msg != "This field cannot be blank" {
+		t.Errorf("expected the message in English but got %q", msg)
+	}
+
+	form.Locale = "pt"
+	if msg := form.Error("a"); msg == "" || msg == form.Errors.Get("a") {
+		t.Errorf("expected the message in Portuguese but got %q", msg)
+	}
+}
+
+func TestForm_Checks(t *testing.T) {
+	form := New(url.Values{
+		"name":    {"Zoë"},
+		"number":  {"7"},
+		"phone":   {"+14155550123"},
+		"arrival": {"2050-03-01"},
+		"leave":   {"2050-03-03"},
+		"a":       {"x"},
+		"b":       {"x"},
+	})
+
+	if !form.MinLength("name", 3) || !form.MaxLength("name", 3) {
+		t.Error("expected the length to be counted in characters")
+	}
+
+	if !form.Min("number", 7) || !form.Max("number", 7) {
+		t.Error("expected the number to be within its bounds")
+	}
+
+	if !form.IsPhone("phone") || !form.IsDate("arrival", "2006-01-02") {
+		t.Error("expected a valid phone and date")
+	}
+
+	if !form.DateAfter("leave", "arrival", "2006-01-02") || !form.Equal("a", "b") {
+		t.Error("expected a valid range of dates and equal fields")
+	}
+
+	if !form.Valid() {
+		t.Errorf("expected no errors but got %v", form.Errors.Messages("en"))
+	}
+
+	if form.DateAfter("arrival", "leave", "2006-01-02") || form.Errors.Get("arrival") == "" {
+		t.Error("expected an error for a date that is not after the other")
+	}
+
+	if form.Min("name", 1) || form.Errors.Get("name") == "" {
+		t.Error("expected an error for a value that is not a number")
+	}
+}
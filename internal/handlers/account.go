@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wagnojunior/booking/internal/apikeys"
+	"github.com/wagnojunior/booking/internal/forms"
+	"github.com/wagnojunior/booking/internal/helpers"
+	"github.com/wagnojunior/booking/internal/models"
+	"github.com/wagnojunior/booking/internal/render"
+)
+
+// registrationForm is the form of register.page.tmpl
+type registrationForm struct {
+	FirstName            string `form:"first_name" validate:"required,min=3,max=100"`
+	LastName             string `form:"last_name" validate:"required,max=100"`
+	Email                string `form:"email" validate:"required,email,max=255"`
+	Password             string `form:"password" validate:"required,min=8,max=72"` // bcrypt ignores what follows 72 bytes
+	PasswordConfirmation string `form:"password_confirmation" validate:"required,eqfield=password"`
+}
+
+// ShowRegister shows the registration page of the guests
+func (m *Repository) ShowRegister(w http.ResponseWriter, r *http.Request) {
+	if err := render.Template(w, r, "register.page.tmpl", &models.TemplateData{
+		Form: forms.New(nil),
+	}); err != nil {
+		helpers.ServerError(w, err)
+	}
+}
+
+// PostRegister creates the account of a guest, emails the link that verifies its address and logs the guest in
+func (m *Repository) PostRegister(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+
+	var details registrationForm
+	if err := form.Bind(&details); err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// The email identifies the account, so it can only have one
+	if form.Errors.Get("email") == "" {
+		_, err := m.DB.GetUserByEmail(details.Email)
+		if err == nil {
+			form.Errors.Add("email", "form.email_taken")
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		if err := render.Template(w, r, "register.page.tmpl", &models.TemplateData{
+			Form: form,
+		}); err != nil {
+			helpers.ServerError(w, err)
+		}
+		return
+	}
+
+	// Only the hash of the token is stored, like the API keys, so a leaked database cannot verify an email
+	token, err := newVerificationToken()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	user := models.User{
+		FirstName:        details.FirstName,
+		LastName:         details.LastName,
+		Email:            details.Email,
+		AccessLevel:      models.AccessGuest,
+		VerificationHash: apikeys.Hash(token),
+	}
+
+	user.ID, err = m.DB.InsertUser(user, details.Password)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.MailChan <- models.MailData{
+		To:      user.Email,
+		From:    m.App.MailFrom,
+		Subject: "Verify your email",
+		Content: verificationEmail(user, m.siteURL("/user/verify/"+token)),
+	}
+
+	// Prevents session fixation attacks
+	_ = m.App.Session.RenewToken(r.Context())
+
+	m.App.Session.Put(r.Context(), "user_id", user.ID)
+	m.App.Session.Put(r.Context(), "access_level", user.AccessLevel)
+	m.App.Session.Put(r.Context(), "flash", "Account created. Check your email to verify your address")
+	http.Redirect(w, r, "/account/bookings", http.StatusSeeOther)
+}
+
+// newVerificationToken returns a random token for the link that verifies an email
+func newVerificationToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// siteURL returns the absolute URL of <path> on the site. It is built from the configuration, never from the Host
+// header of the request, which the client chooses: a link sent by email must lead to the site
+func (m *Repository) siteURL(path string) string {
+	scheme := "http"
+	if m.App.HTTPS {
+		scheme = "https"
+	}
+
+	return scheme + "://" + m.App.Domain + path
+}
+
+// verificationEmail returns the HTML content of the email that asks the user <u> to verify its address at <link>
+func verificationEmail(u models.User, link string) string {
+	return fmt.Sprintf("<strong>Welcome</strong><br>Dear %s,<br>"+
+		"Please verify your email by opening this link: <a href=\"%s\">%s</a><br>"+
+		"Once it is verified, the reservations you made with it will be shown with your bookings.<br>",
+		html.EscapeString(u.FirstName), html.EscapeString(link), html.EscapeString(link))
+}
+
+// VerifyEmail verifies the email of the user with the token of the link, and links the reservations made with it
+func (m *Repository) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	user, err := m.DB.VerifyUserEmail(apikeys.Hash(chi.URLParam(r, "token")))
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error", "The verification link is invalid or was already used")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	linked, err := m.DB.LinkReservationsByEmail(user.ID, user.Email)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Email verified, %d earlier reservation(s) added to your bookings", linked))
+
+	if !helpers.IsAuthenticated(r) {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, "/account/bookings", http.StatusSeeOther)
+}
+
+// MyBookings lists the reservations of the logged in guest
+func (m *Repository) MyBookings(w http.ResponseWriter, r *http.Request) {
+	user, err := m.DB.GetUserByID(m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	reservations, err := m.DB.GetReservationsByUserID(user.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["user"] = user
+	data["reservations"] = reservations
+
+	if err := render.Template(w, r, "my-bookings.page.tmpl", &models.TemplateData{
+		Data: data,
+	}); err != nil {
+		helpers.ServerError(w, err)
+	}
+}
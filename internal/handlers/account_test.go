@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wagnojunior/booking/internal/models"
+	"github.com/wagnojunior/booking/internal/repository/dbrepo"
+)
+
+func TestRepository_PostRegister(t *testing.T) {
+	var tests = []struct {
+		name             string
+		email            string
+		password         string
+		confirmation     string
+		expectedCode     int
+		expectedLocation string
+		expectedError    string
+	}{
+		{"valid", "new@guest.com", "secret123", "secret123", http.StatusSeeOther, "/account/bookings", ""},
+		{"email taken", "John@Smith.com", "secret123", "secret123", http.StatusOK, "", "An account with this email already exists"},
+		{"short password", "new@guest.com", "secret", "secret", http.StatusOK, "", "at least 8 characters"},
+		{"different confirmation", "new@guest.com", "secret123", "secret321", http.StatusOK, "", "This must match"},
+		{"database error", "fail@here.ca", "secret123", "secret123", http.StatusInternalServerError, "", ""},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("first_name", "Alice")
+		postedData.Add("last_name", "Jones")
+		postedData.Add("email", e.email)
+		postedData.Add("password", e.password)
+		postedData.Add("password_confirmation", e.confirmation)
+
+		req, _ := http.NewRequest("POST", "/user/register", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostRegister)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("For %s, expected %d but got %d", e.name, e.expectedCode, rr.Code)
+		}
+
+		if e.expectedLocation != "" {
+			if rr.Header().Get("Location") != e.expectedLocation {
+				t.Errorf("For %s, expected a redirect to %s but got %s", e.name, e.expectedLocation, rr.Header().Get("Location"))
+			}
+
+			// The guest is logged in, without access to the admin area
+			if session.GetInt(ctx, "user_id") != 4 || session.GetInt(ctx, "access_level") != models.AccessGuest {
+				t.Errorf("For %s, expected guest 4 to be logged in but got user %d with access level %d",
+					e.name, session.GetInt(ctx, "user_id"), session.GetInt(ctx, "access_level"))
+			}
+		}
+
+		if e.expectedError != "" && !strings.Contains(rr.Body.String(), e.expectedError) {
+			t.Errorf("For %s, expected the form to be shown again with the error %q", e.name, e.expectedError)
+		}
+	}
+}
+
+func TestRepository_VerifyEmail(t *testing.T) {
+	var tests = []struct {
+		name         string
+		token        string
+		loggedIn     bool
+		expectedURL  string
+		expectedMsg  string
+		expectedText string
+	}{
+		{"valid", dbrepo.TestVerificationToken, true, "/account/bookings", "flash", "1 earlier reservation"},
+		{"valid, logged out", dbrepo.TestVerificationToken, false, "/user/login", "flash", "1 earlier reservation"},
+		{"unknown", "not-a-token", true, "/user/login", "error", "invalid"},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/user/verify/"+e.token, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("token", e.token)
+		ctx := getCtx(req)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		rr := httptest.NewRecorder()
+
+		if e.loggedIn {
+			session.Put(ctx, "user_id", 3)
+		}
+
+		handler := http.HandlerFunc(Repo.VerifyEmail)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != e.expectedURL {
+			t.Errorf("For %s, expected a redirect to %s but got %d %s", e.name, e.expectedURL, rr.Code, rr.Header().Get("Location"))
+		}
+
+		if msg := session.GetString(ctx, e.expectedMsg); !strings.Contains(msg, e.expectedText) {
+			t.Errorf("For %s, expected a %s message with %q but got %q", e.name, e.expectedMsg, e.expectedText, msg)
+		}
+	}
+}
+
+func TestRepository_MyBookings(t *testing.T) {
+	var tests = []struct {
+		name         string
+		userID       int
+		expectedText string
+	}{
+		{"with bookings", 2, "TESTCOD1"},
+		{"unverified", 3, "jane@doe.ca"},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/account/bookings", nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		rr := httptest.NewRecorder()
+		session.Put(ctx, "user_id", e.userID)
+
+		handler := http.HandlerFunc(Repo.MyBookings)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("For %s, expected %d but got %d", e.name, http.StatusOK, rr.Code)
+		}
+
+		if !strings.Contains(rr.Body.String(), e.expectedText) {
+			t.Errorf("For %s, expected the page to show %q", e.name, e.expectedText)
+		}
+	}
+}
+
+func TestRepository_PostShowLoginAccessLevel(t *testing.T) {
+	var tests = []struct {
+		name                string
+		email               string
+		expectedLocation    string
+		expectedAccessLevel int
+	}{
+		{"admin", "me@here.ca", "/admin/promo-codes", models.AccessAdmin},
+		{"guest", "john@smith.com", "/account/bookings", models.AccessGuest},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("email", e.email)
+		postedData.Add("password", "password")
+
+		req, _ := http.NewRequest("POST", "/user/login", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostShowLogin)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != e.expectedLocation {
+			t.Errorf("For %s, expected a redirect to %s but got %d %s", e.name, e.expectedLocation, rr.Code, rr.Header().Get("Location"))
+		}
+
+		if session.GetInt(ctx, "access_level") != e.expectedAccessLevel {
+			t.Errorf("For %s, expected the access level %d but got %d", e.name, e.expectedAccessLevel, session.GetInt(ctx, "access_level"))
+		}
+	}
+}
+
+func TestRepository_MakeReservationPrefilled(t *testing.T) {
+	reservation := models.Reservation{
+		RoomID:    1,
+		StartDate: nextWeekday(time.Thursday),
+		EndDate:   nextWeekday(time.Thursday).AddDate(0, 0, 3),
+	}
+
+	req, _ := http.NewRequest("GET", "/make-reservation", nil)
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	rr := httptest.NewRecorder()
+	session.Put(ctx, "reservation", reservation)
+	session.Put(ctx, "user_id", 2)
+
+	handler := http.HandlerFunc(Repo.MakeReservation)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("MakeReservation handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+
+	res, _ := session.Get(ctx, "reservation").(models.Reservation)
+	if res.FirstName != "John" || res.LastName != "Smith" || res.Email != "john@smith.com" {
+		t.Errorf("expected the form to be filled in from the account but got %s %s <%s>", res.FirstName, res.LastName, res.Email)
+	}
+}
+
+func TestRepository_PostRegisterVerificationLink(t *testing.T) {
+	// The email is caught instead of being discarded
+	mailChan := app.MailChan
+	defer func() { app.MailChan = mailChan }()
+	app.MailChan = make(chan models.MailData, 1)
+
+	postedData := url.Values{}
+	postedData.Add("first_name", "Alice")
+	postedData.Add("last_name", "Jones")
+	postedData.Add("email", "new@guest.com")
+	postedData.Add("password", "secret123")
+	postedData.Add("password_confirmation", "secret123")
+
+	// The Host header is chosen by the client, who could send the link of a victim's email to its own site
+	req, _ := http.NewRequest("POST", "/user/register", strings.NewReader(postedData.Encode()))
+	req.Host = "attacker.example"
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.PostRegister)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected %d but got %d", http.StatusSeeOther, rr.Code)
+	}
+
+	msg := <-app.MailChan
+	if strings.Contains(msg.Content, "attacker.example") || !strings.Contains(msg.Content, "http://panpanzinho.com/user/verify/") {
+		t.Errorf("expected the verification link to lead to the domain of the property but got %s", msg.Content)
+	}
+}
@@ -0,0 +1,887 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wagnojunior/booking/internal/apikeys"
+	"github.com/wagnojunior/booking/internal/cancellation"
+	"github.com/wagnojunior/booking/internal/forms"
+	"github.com/wagnojunior/booking/internal/helpers"
+	"github.com/wagnojunior/booking/internal/models"
+	"github.com/wagnojunior/booking/internal/pricing"
+	"github.com/wagnojunior/booking/internal/render"
+	"github.com/wagnojunior/booking/internal/webhooks"
+)
+
+// AdminPromoCodes lists all promo codes
+func (m *Repository) AdminPromoCodes(w http.ResponseWriter, r *http.Request) {
+	promos, err := m.DB.AllPromoCodes()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["promo_codes"] = promos
+
+	if err := render.Template(w, r, "admin-promo-codes.page.tmpl", &models.TemplateData{
+		Data: data,
+	}); err != nil {
+		helpers.ServerError(w, err)
+	}
+}
+
+// AdminShowPromoCode shows the form to create (id 0) or edit a promo code
+func (m *Repository) AdminShowPromoCode(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	promo := models.PromoCode{
+		DiscountType: models.DiscountPercent,
+	}
+
+	if id > 0 {
+		promo, err = m.DB.GetPromoCodeByID(id)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	m.renderAdminPromoCode(w, r, promo, forms.New(nil))
+}
+
+// AdminPostPromoCode creates (id 0) or updates a promo code
+func (m *Repository) AdminPostPromoCode(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("code", "discount_type", "amount", "valid_from", "valid_until")
+
+	promo := models.PromoCode{
+		ID:           id,
+		Code:         strings.ToUpper(strings.TrimSpace(r.Form.Get("code"))),
+		DiscountType: r.Form.Get("discount_type"),
+	}
+
+	// Percentages are whole numbers, fixed amounts are prices such as 10.50
+	switch promo.DiscountType {
+	case models.DiscountPercent:
+		promo.Amount, err = strconv.Atoi(r.Form.Get("amount"))
+		if err != nil || promo.Amount < 1 || promo.Amount > 100 {
+			form.Errors.Add("amount", "Percentages must be a whole number between 1 and 100")
+		}
+	case models.DiscountFixed:
+		promo.Amount, err = pricing.ParseAmount(r.Form.Get("amount"))
+		if err != nil || promo.Amount < 1 {
+			form.Errors.Add("amount", "Fixed amounts must be a positive price, e.g. 10.50")
+		}
+	default:
+		form.Errors.Add("discount_type", "Unknown discount type")
+	}
+
+	layout := "2006-01-02"
+	promo.ValidFrom, err = time.Parse(layout, r.Form.Get("valid_from"))
+	if err != nil {
+		form.Errors.Add("valid_from", "Dates must have the format yyyy-mm-dd")
+	}
+
+	promo.ValidUntil, err = time.Parse(layout, r.Form.Get("valid_until"))
+	if err != nil {
+		form.Errors.Add("valid_until", "Dates must have the format yyyy-mm-dd")
+	} else if promo.ValidUntil.Before(promo.ValidFrom) {
+		form.Errors.Add("valid_until", "The end of the validity must not be before its start")
+	}
+
+	// The optional numbers default to 0, that is no restriction
+	for field, dest := range map[string]*int{
+		"min_nights": &promo.MinNights,
+		"max_uses":   &promo.MaxUses,
+		"room_id":    &promo.RoomID,
+	} {
+		value := strings.TrimSpace(r.Form.Get(field))
+		if value == "" {
+			continue
+		}
+
+		*dest, err = strconv.Atoi(value)
+		if err != nil || *dest < 0 {
+			form.Errors.Add(field, "This field must be a whole number not below 0")
+		}
+	}
+
+	if !form.Valid() {
+		m.renderAdminPromoCode(w, r, promo, form)
+		return
+	}
+
+	if id == 0 {
+		_, err = m.DB.InsertPromoCode(promo)
+	} else {
+		err = m.DB.UpdatePromoCode(promo)
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Promo code saved")
+	http.Redirect(w, r, "/admin/promo-codes", http.StatusSeeOther)
+}
+
+// AdminDeletePromoCode deletes a promo code
+func (m *Repository) AdminDeletePromoCode(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.DeletePromoCode(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Promo code deleted")
+	http.Redirect(w, r, "/admin/promo-codes", http.StatusSeeOther)
+}
+
+// renderAdminPromoCode renders the promo code form for <promo>
+func (m *Repository) renderAdminPromoCode(w http.ResponseWriter, r *http.Request, promo models.PromoCode, form *forms.Form) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// Fixed amounts are shown as prices, percentages as they are
+	stringMap := make(map[string]string)
+	stringMap["amount"] = strconv.Itoa(promo.Amount)
+	if promo.DiscountType == models.DiscountFixed {
+		stringMap["amount"] = pricing.FormatAmount(promo.Amount, "")
+	}
+	if !promo.ValidFrom.IsZero() {
+		stringMap["valid_from"] = promo.ValidFrom.Format("2006-01-02")
+	}
+	if !promo.ValidUntil.IsZero() {
+		stringMap["valid_until"] = promo.ValidUntil.Format("2006-01-02")
+	}
+
+	// Show back what was typed when the form was rejected
+	for _, field := range []string{"amount", "valid_from", "valid_until"} {
+		if value := form.Get(field); value != "" {
+			stringMap[field] = value
+		}
+	}
+
+	data := make(map[string]interface{})
+	data["promo_code"] = promo
+	data["rooms"] = rooms
+
+	if err := render.Template(w, r, "admin-promo-code.page.tmpl", &models.TemplateData{
+		Form:      form,
+		Data:      data,
+		StringMap: stringMap,
+	}); err != nil {
+		helpers.ServerError(w, err)
+	}
+}
+
+// AdminReservations lists all reservations
+func (m *Repository) AdminReservations(w http.ResponseWriter, r *http.Request) {
+	reservations, err := m.DB.AllReservations()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["reservations"] = reservations
+
+	if err := render.Template(w, r, "admin-reservations.page.tmpl", &models.TemplateData{
+		Data: data,
+	}); err != nil {
+		helpers.ServerError(w, err)
+	}
+}
+
+// AdminShowReservation shows a reservation with its payments and the refund the guest would get if it was cancelled now
+func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	res, err := m.DB.GetReservationByID(id)
+	if err == sql.ErrNoRows {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	payments, err := m.DB.GetPaymentsByReservationID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	paid := capturedAmount(payments)
+
+	stringMap := make(map[string]string)
+	stringMap["start_date"] = res.StartDate.Format("2006-01-02")
+	stringMap["end_date"] = res.EndDate.Format("2006-01-02")
+
+	intMap := make(map[string]int)
+	intMap["paid"] = paid
+	intMap["refund"] = cancellation.Refund(res.CancellationPolicy, paid, res.StartDate, m.App.Property.Today(m.App.Clock.Now()))
+
+	data := make(map[string]interface{})
+	data["reservation"] = res
+	data["payments"] = payments
+
+	if err := render.Template(w, r, "admin-reservation.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		IntMap:    intMap,
+		Data:      data,
+	}); err != nil {
+		helpers.ServerError(w, err)
+	}
+}
+
+// AdminCancelReservation cancels a reservation, refunds the guest what its cancellation policy allows and frees the room
+func (m *Repository) AdminCancelReservation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	res, err := m.DB.GetReservationByID(id)
+	if err == sql.ErrNoRows {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	page := fmt.Sprintf("/admin/reservations/%d", id)
+
+	if res.Status == models.ReservationCancelled {
+		m.App.Session.Put(r.Context(), "warning", "The reservation is already cancelled")
+		http.Redirect(w, r, page, http.StatusSeeOther)
+		return
+	}
+
+	res, err = m.cancelReservation(res)
+	if errors.Is(err, errAlreadyCancelled) {
+		m.App.Session.Put(r.Context(), "warning", "The reservation is already cancelled")
+		http.Redirect(w, r, page, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Reservation cancelled, %s refunded", pricing.FormatAmount(res.RefundAmount, res.Price.Currency)))
+	http.Redirect(w, r, page, http.StatusSeeOther)
+}
+
+// errAlreadyCancelled is returned when a reservation was cancelled by another request in the meantime
+var errAlreadyCancelled = errors.New("the reservation is already cancelled")
+
+// cancelReservation cancels the reservation <res>, refunds the guest what its cancellation policy allows, frees the room
+// and tells the guest. The cancelled reservation is returned with the refunded amount
+func (m *Repository) cancelReservation(res models.Reservation) (models.Reservation, error) {
+	payments, err := m.DB.GetPaymentsByReservationID(res.ID)
+	if err != nil {
+		return res, err
+	}
+
+	// The policy stored with the reservation applies, not the current policy of the room
+	refund := cancellation.Refund(res.CancellationPolicy, capturedAmount(payments), res.StartDate, m.App.Property.Today(m.App.Clock.Now()))
+
+	// The reservation is cancelled before the money is given back: if a refund then fails, a retry cannot refund the
+	// guest a second time, as the reservation is no longer active
+	cancelled, err := m.DB.CancelReservation(res.ID, refund)
+	if err != nil {
+		return res, err
+	}
+
+	if !cancelled {
+		return res, errAlreadyCancelled
+	}
+
+	err = m.refundPayments(payments, refund)
+	if err != nil {
+		return res, fmt.Errorf("reservation %s is cancelled, but its refund of %s failed: %w",
+			res.Code, pricing.FormatAmount(refund, res.Price.Currency), err)
+	}
+
+	res.Status = models.ReservationCancelled
+	res.RefundAmount = refund
+	res.CancelledAt = m.App.Clock.Now()
+
+	m.App.MailChan <- models.MailData{
+		To:      res.Email,
+		From:    m.App.MailFrom,
+		Subject: "Reservation cancelled",
+		Content: cancellationEmail(res),
+	}
+
+	m.queueWebhook(models.EventReservationCancelled, toAPIReservation(res))
+
+	return res, nil
+}
+
+// refundPayments gives <refund> back to the guest from the captured <payments>, the oldest first, and records on each
+// payment how much of it was refunded
+func (m *Repository) refundPayments(payments []models.Payment, refund int) error {
+	remaining := refund
+	for i, payment := range payments {
+		if remaining == 0 {
+			break
+		}
+
+		if payment.Status != models.PaymentCaptured && payment.Status != models.PaymentPartiallyRefunded {
+			continue
+		}
+
+		amount := payment.Amount - payment.RefundedAmount
+		if amount > remaining {
+			amount = remaining
+		}
+
+		err := m.App.PaymentGateway.Refund(payment.ProviderRef, amount)
+		if err != nil {
+			return err
+		}
+
+		payment.RefundedAmount += amount
+		payment.Status = models.PaymentRefunded
+		if payment.RefundedAmount < payment.Amount {
+			payment.Status = models.PaymentPartiallyRefunded
+		}
+
+		err = m.DB.UpdatePaymentRefund(payment.ID, payment.RefundedAmount, payment.Status)
+		if err != nil {
+			return err
+		}
+
+		payments[i] = payment
+		remaining -= amount
+	}
+
+	return nil
+}
+
+// capturedAmount returns how much of the <payments> was collected from the guest, and not refunded yet
+func capturedAmount(payments []models.Payment) int {
+	paid := 0
+	for _, payment := range payments {
+		if payment.Status == models.PaymentCaptured || payment.Status == models.PaymentPartiallyRefunded {
+			paid += payment.Amount - payment.RefundedAmount
+		}
+	}
+
+	return paid
+}
+
+// cancellationEmail returns the HTML content of the email that tells the guest that the reservation <res> was cancelled
+func cancellationEmail(res models.Reservation) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "<strong>Reservation Cancelled</strong><br>")
+	fmt.Fprintf(&b, "Dear %s,<br>", html.EscapeString(res.FirstName))
+	fmt.Fprintf(&b, "Your reservation of the %s from %s to %s has been cancelled.<br>",
+		html.EscapeString(res.Room.RoomName),
+		res.StartDate.Format("2006-01-02"),
+		res.EndDate.Format("2006-01-02"),
+	)
+	fmt.Fprintf(&b, "Cancellation policy: %s<br>", html.EscapeString(res.CancellationSummary))
+	fmt.Fprintf(&b, "Refund: %s<br>", pricing.FormatAmount(res.RefundAmount, res.Price.Currency))
+
+	return b.String()
+}
+
+// AdminRooms lists all rooms with the address of their calendar feed
+func (m *Repository) AdminRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// The feeds are read by calendar apps, which need the full address
+	feeds := make(map[int]string)
+	for _, room := range rooms {
+		if room.ICalToken != "" {
+			feeds[room.ID] = m.siteURL(fmt.Sprintf("/ical/%d/%s.ics", room.ID, room.ICalToken))
+		}
+	}
+
+	// The calendars imported from the other channels, by room
+	allImports, err := m.DB.AllICalImports()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	imports := make(map[int][]models.ICalImport)
+	for _, imp := range allImports {
+		imports[imp.RoomID] = append(imports[imp.RoomID], imp)
+	}
+
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+	data["feeds"] = feeds
+	data["imports"] = imports
+
+	if err := render.Template(w, r, "admin-rooms.page.tmpl", &models.TemplateData{
+		Form: forms.New(nil),
+		Data: data,
+	}); err != nil {
+		helpers.ServerError(w, err)
+	}
+}
+
+// AdminPostICalImport adds the calendar of another channel to the calendars imported for a room
+func (m *Repository) AdminPostICalImport(w http.ResponseWriter, r *http.Request) {
+	roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	imp := models.ICalImport{
+		RoomID: roomID,
+		URL:    strings.TrimSpace(r.Form.Get("url")),
+	}
+
+	u, err := url.Parse(imp.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		m.App.Session.Put(r.Context(), "error", "The calendar address must be an http or https URL")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+
+	imp.ID, err = m.DB.InsertICalImport(imp)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// Import the calendar right away, so that a wrong address shows up at once
+	warnings, err := m.syncICalImport(imp)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "warning", "Calendar added, but it could not be imported: "+err.Error())
+	} else if len(warnings) > 0 {
+		m.App.Session.Put(r.Context(), "warning", "Calendar added and imported, but "+strings.Join(warnings, ". "))
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "Calendar added and imported")
+	}
+
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
+
+// AdminSyncICalImport imports a calendar of another channel now, instead of waiting for the next synchronisation
+func (m *Repository) AdminSyncICalImport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	imp, err := m.DB.GetICalImportByID(id)
+	if err == sql.ErrNoRows {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	warnings, err := m.syncICalImport(imp)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "The calendar could not be imported: "+err.Error())
+	} else if len(warnings) > 0 {
+		m.App.Session.Put(r.Context(), "warning", "Calendar imported, but "+strings.Join(warnings, ". "))
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "Calendar imported")
+	}
+
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
+
+// AdminDeleteICalImport stops importing a calendar of another channel and frees the dates it blocked
+func (m *Repository) AdminDeleteICalImport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.DeleteICalImport(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Calendar removed")
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
+
+// AdminAPIKeys lists all API keys, with the form to create one. A new key is shown once, right after its creation
+func (m *Repository) AdminAPIKeys(w http.ResponseWriter, r *http.Request) {
+	m.renderAdminAPIKeys(w, r, forms.New(nil))
+}
+
+// renderAdminAPIKeys renders the list of the API keys with the form <form>
+func (m *Repository) renderAdminAPIKeys(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	keys, err := m.DB.AllAPIKeys()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["api_key"] = m.App.Session.PopString(r.Context(), "api_key")
+
+	data := make(map[string]interface{})
+	data["api_keys"] = keys
+	data["scopes"] = models.AllScopes
+
+	if err := render.Template(w, r, "admin-api-keys.page.tmpl", &models.TemplateData{
+		Form:      form,
+		Data:      data,
+		StringMap: stringMap,
+	}); err != nil {
+		helpers.ServerError(w, err)
+	}
+}
+
+// AdminPostAPIKey creates an API key. Only its hash is stored, so the key is shown to the admin once
+func (m *Repository) AdminPostAPIKey(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "rate_limit")
+
+	k := models.APIKey{
+		Name: strings.TrimSpace(r.Form.Get("name")),
+	}
+
+	known := models.Scopes(strings.Join(models.AllScopes, ","))
+	var scopes []string
+	for _, scope := range r.Form["scopes"] {
+		if !known.Contains(scope) {
+			form.Errors.Add("scopes", "Unknown scope "+scope)
+			continue
+		}
+		scopes = append(scopes, scope)
+	}
+	if len(scopes) == 0 {
+		form.Errors.Add("scopes", "Choose at least one scope")
+	}
+	k.Scopes = models.Scopes(strings.Join(scopes, ","))
+
+	k.RateLimit, err = strconv.Atoi(strings.TrimSpace(r.Form.Get("rate_limit")))
+	if err != nil || k.RateLimit < 0 {
+		form.Errors.Add("rate_limit", "This field must be a whole number not below 0")
+	}
+
+	// The key expires at the end of the given day
+	if expires := strings.TrimSpace(r.Form.Get("expires_at")); expires != "" {
+		day, err := time.Parse("2006-01-02", expires)
+		if err != nil {
+			form.Errors.Add("expires_at", "Dates must have the format yyyy-mm-dd")
+		} else if k.ExpiresAt = day.AddDate(0, 0, 1); k.ExpiresAt.Before(m.App.Clock.Now()) {
+			form.Errors.Add("expires_at", "The expiry date must not be in the past")
+		}
+	}
+
+	if !form.Valid() {
+		m.renderAdminAPIKeys(w, r, form)
+		return
+	}
+
+	key, prefix, hash, err := apikeys.Generate()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	k.Prefix = prefix
+	k.Hash = hash
+
+	_, err = m.DB.InsertAPIKey(k)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "api_key", key)
+	m.App.Session.Put(r.Context(), "flash", "API key created")
+	http.Redirect(w, r, "/admin/api-keys", http.StatusSeeOther)
+}
+
+// AdminShowAPIKey shows an API key with the latest requests made with it
+func (m *Repository) AdminShowAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	k, err := m.DB.GetAPIKeyByID(id)
+	if err == sql.ErrNoRows {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	usages, err := m.DB.GetAPIKeyUsages(id, 100)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["api_key"] = k
+	data["usages"] = usages
+
+	if err := render.Template(w, r, "admin-api-key.page.tmpl", &models.TemplateData{
+		Data: data,
+	}); err != nil {
+		helpers.ServerError(w, err)
+	}
+}
+
+// AdminDeleteAPIKey deletes an API key, which can no longer be used
+func (m *Repository) AdminDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.DeleteAPIKey(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "API key deleted")
+	http.Redirect(w, r, "/admin/api-keys", http.StatusSeeOther)
+}
+
+// AdminWebhooks lists all webhook endpoints, with the form to add one
+func (m *Repository) AdminWebhooks(w http.ResponseWriter, r *http.Request) {
+	m.renderAdminWebhooks(w, r, forms.New(nil))
+}
+
+// renderAdminWebhooks renders the list of the webhook endpoints with the form <form>
+func (m *Repository) renderAdminWebhooks(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	endpoints, err := m.DB.AllWebhookEndpoints()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["endpoints"] = endpoints
+	data["events"] = models.AllEvents
+
+	if err := render.Template(w, r, "admin-webhooks.page.tmpl", &models.TemplateData{
+		Form: form,
+		Data: data,
+	}); err != nil {
+		helpers.ServerError(w, err)
+	}
+}
+
+// AdminPostWebhook adds a webhook endpoint with a new secret, with which its deliveries are signed
+func (m *Repository) AdminPostWebhook(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("url")
+
+	e := models.WebhookEndpoint{
+		URL: strings.TrimSpace(r.Form.Get("url")),
+	}
+
+	if e.URL != "" {
+		u, err := url.Parse(e.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			form.Errors.Add("url", "The address must be an http or https URL")
+		}
+	}
+
+	known := models.Events(strings.Join(models.AllEvents, ","))
+	var events []string
+	for _, event := range r.Form["events"] {
+		if !known.Contains(event) {
+			form.Errors.Add("events", "Unknown event "+event)
+			continue
+		}
+		events = append(events, event)
+	}
+	if len(events) == 0 {
+		form.Errors.Add("events", "Choose at least one event")
+	}
+	e.Events = models.Events(strings.Join(events, ","))
+
+	if !form.Valid() {
+		m.renderAdminWebhooks(w, r, form)
+		return
+	}
+
+	e.Secret, err = webhooks.NewSecret()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	e.ID, err = m.DB.InsertWebhookEndpoint(e)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Webhook added")
+	http.Redirect(w, r, fmt.Sprintf("/admin/webhooks/%d", e.ID), http.StatusSeeOther)
+}
+
+// AdminShowWebhook shows a webhook endpoint, with its secret and its latest deliveries
+func (m *Repository) AdminShowWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	e, err := m.DB.GetWebhookEndpointByID(id)
+	if err == sql.ErrNoRows {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	deliveries, err := m.DB.GetWebhookDeliveriesByEndpointID(id, 100)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["endpoint"] = e
+	data["deliveries"] = deliveries
+
+	if err := render.Template(w, r, "admin-webhook.page.tmpl", &models.TemplateData{
+		Data: data,
+	}); err != nil {
+		helpers.ServerError(w, err)
+	}
+}
+
+// AdminDeleteWebhook deletes a webhook endpoint with its deliveries
+func (m *Repository) AdminDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.DeleteWebhookEndpoint(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Webhook deleted")
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
+
+// AdminRetryWebhookDelivery sends a webhook delivery now, instead of waiting for its next attempt
+func (m *Repository) AdminRetryWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	d, err := m.DB.GetWebhookDeliveryByID(id)
+	if err == sql.ErrNoRows {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if d.Status == models.DeliveryDelivered {
+		m.App.Session.Put(r.Context(), "warning", "The event was already delivered")
+		http.Redirect(w, r, fmt.Sprintf("/admin/webhooks/%d", d.EndpointID), http.StatusSeeOther)
+		return
+	}
+
+	d = m.attemptWebhookDelivery(d, m.App.Clock.Now())
+
+	err = m.DB.UpdateWebhookDelivery(d)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if d.Status == models.DeliveryDelivered {
+		m.App.Session.Put(r.Context(), "flash", "Event delivered")
+	} else {
+		m.App.Session.Put(r.Context(), "error", "The event could not be delivered: "+d.LastError)
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/webhooks/%d", d.EndpointID), http.StatusSeeOther)
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wagnojunior/booking/internal/apikeys"
+	"github.com/wagnojunior/booking/internal/models"
+	"github.com/wagnojunior/booking/internal/ratelimit"
+)
+
+// contextKey is the type of the keys of the values that the handlers put in the context of a request
+type contextKey string
+
+// apiKeyContextKey holds the API key that authenticated a request to the API
+const apiKeyContextKey = contextKey("api_key")
+
+// statusRecorder remembers the status of the response written through it
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status before writing it
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// APIAuth authenticates the requests to the API with the API key of the Authorization header ("Bearer <key>"),
+// or of the X-API-Key header. It enforces the rate limit of the key and logs every request made with it
+func (m *Repository) APIAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-API-Key")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			key = strings.TrimSpace(auth[len("Bearer "):])
+		}
+
+		if key == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			m.apiClientError(w, http.StatusUnauthorized, "unauthorized", "An API key is required", nil)
+			return
+		}
+
+		k, ok, err := m.apiKey(key)
+		if err != nil {
+			m.apiServerError(w, err)
+			return
+		}
+
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			m.apiClientError(w, http.StatusUnauthorized, "unauthorized", "The API key is invalid", nil)
+			return
+		}
+
+		now := m.App.Clock.Now()
+		if !k.ExpiresAt.IsZero() && now.After(k.ExpiresAt) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			m.apiClientError(w, http.StatusUnauthorized, "key_expired", "The API key has expired", nil)
+			return
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() { m.logAPIKeyUsage(k, r, rec.status) }()
+
+		// A key may make its whole limit of requests at once, and gets them back over a minute
+		if k.RateLimit > 0 {
+			d := m.APILimiter.Take(strconv.Itoa(k.ID), ratelimit.Every(k.RateLimit, time.Minute, k.RateLimit), now)
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(k.RateLimit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(d.Remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(now.Add(d.Reset).Unix(), 10))
+
+			if !d.OK {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.RetryAfter.Seconds()))))
+				m.apiClientError(rec, http.StatusTooManyRequests, "rate_limited", "The API key has made too many requests, try again later", nil)
+				return
+			}
+		}
+
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey, k)))
+	})
+}
+
+// RequireScope refuses the requests to the API whose API key does not have the scope <scope>.
+// It must be used after APIAuth
+func (m *Repository) RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k, ok := r.Context().Value(apiKeyContextKey).(models.APIKey)
+			if !ok || !k.Scopes.Contains(scope) {
+				m.apiClientError(w, http.StatusForbidden, "insufficient_scope", "The API key does not have the scope "+scope, nil)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// apiKey returns the stored API key of <key>, and false when there is none
+func (m *Repository) apiKey(key string) (models.APIKey, bool, error) {
+	prefix, ok := apikeys.Prefix(key)
+	if !ok {
+		return models.APIKey{}, false, nil
+	}
+
+	k, err := m.DB.GetAPIKeyByPrefix(prefix)
+	if err == sql.ErrNoRows {
+		return k, false, nil
+	} else if err != nil {
+		return k, false, err
+	}
+
+	return k, apikeys.Verify(key, k.Hash), nil
+}
+
+// logAPIKeyUsage logs the request <r> made with the API key <k>, which was answered with the status <status>.
+// A request is never failed because it could not be logged
+func (m *Repository) logAPIKeyUsage(k models.APIKey, r *http.Request, status int) {
+	err := m.DB.InsertAPIKeyUsage(models.APIKeyUsage{
+		APIKeyID: k.ID,
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		Status:   status,
+	})
+	if err != nil {
+		m.App.ErrorLog.Println("logging the usage of API key", k.ID, err)
+	}
+}
@@ -0,0 +1,568 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wagnojunior/booking/internal/forms"
+	"github.com/wagnojunior/booking/internal/i18n"
+	"github.com/wagnojunior/booking/internal/models"
+	"github.com/wagnojunior/booking/internal/payments"
+)
+
+// apiDateLayout is the layout of the dates in the requests and responses of the API
+const apiDateLayout = "2006-01-02"
+
+// apiError is the body of every error response of the API
+type apiError struct {
+	Error apiErrorDetail `json:"error"`
+}
+
+// apiErrorDetail explains an error of the API. Fields holds the validation errors per field of the request, if any
+type apiErrorDetail struct {
+	Code    string              `json:"code"`
+	Message string              `json:"message"`
+	Fields  map[string][]string `json:"fields,omitempty"`
+}
+
+// apiRoom is the representation of a room in the API
+type apiRoom struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	BasePrice int    `json:"base_price"`
+}
+
+// apiRoomList is the response of the rooms endpoint
+type apiRoomList struct {
+	Rooms []apiRoom `json:"rooms"`
+}
+
+// apiPrice is the representation of a price breakdown in the API. Amounts are in the minor unit of the currency
+type apiPrice struct {
+	Currency  string         `json:"currency"`
+	Nights    []apiNight     `json:"nights"`
+	Subtotal  int            `json:"subtotal"`
+	PromoCode string         `json:"promo_code,omitempty"`
+	Discount  int            `json:"discount"`
+	Lines     []apiPriceLine `json:"lines"`
+	Total     int            `json:"total"`
+}
+
+// apiNight is the price of one night in the API
+type apiNight struct {
+	Date     string `json:"date"`
+	RateName string `json:"rate_name"`
+	Amount   int    `json:"amount"`
+}
+
+// apiPriceLine is a tax or a fee in the API
+type apiPriceLine struct {
+	Name     string `json:"name"`
+	Category string `json:"category"`
+	Amount   int    `json:"amount"`
+}
+
+// apiAvailableRoom is a room that can be booked for the requested stay, with the price of the stay
+type apiAvailableRoom struct {
+	Room  apiRoom  `json:"room"`
+	Price apiPrice `json:"price"`
+}
+
+// apiUnavailableRoom is a free room whose stay rules do not allow the requested stay
+type apiUnavailableRoom struct {
+	Room    apiRoom  `json:"room"`
+	Reasons []string `json:"reasons"`
+}
+
+// apiAvailability is the response of the availability endpoint
+type apiAvailability struct {
+	StartDate   string               `json:"start_date"`
+	EndDate     string               `json:"end_date"`
+	Guests      int                  `json:"guests"`
+	Rooms       []apiAvailableRoom   `json:"rooms"`
+	Unavailable []apiUnavailableRoom `json:"unavailable"`
+}
+
+// apiReservationRequest is the body of a request that creates a reservation
+type apiReservationRequest struct {
+	RoomID    int    `json:"room_id"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	Guests    int    `json:"guests"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+	PromoCode string `json:"promo_code"`
+
+	// The card the price of the stay is paid with. API keys with the scope create-unpaid-reservation do not pay
+	CardNumber string `json:"card_number"`
+}
+
+// apiReservation is the representation of a reservation in the API
+type apiReservation struct {
+	Code               string   `json:"code"`
+	Status             string   `json:"status"`
+	Room               apiRoom  `json:"room"`
+	StartDate          string   `json:"start_date"`
+	EndDate            string   `json:"end_date"`
+	Guests             int      `json:"guests"`
+	FirstName          string   `json:"first_name"`
+	LastName           string   `json:"last_name"`
+	Email              string   `json:"email"`
+	Phone              string   `json:"phone"`
+	Price              apiPrice `json:"price"`
+	CancellationPolicy string   `json:"cancellation_policy"`
+	RefundAmount       int      `json:"refund_amount"`
+	CancelledAt        string   `json:"cancelled_at,omitempty"`
+}
+
+// toAPIRoom converts the room <room> to its representation in the API
+func toAPIRoom(room models.Room) apiRoom {
+	return apiRoom{
+		ID:        room.ID,
+		Name:      room.RoomName,
+		BasePrice: room.BasePrice,
+	}
+}
+
+// toAPIPrice converts the price breakdown <quote> to its representation in the API
+func toAPIPrice(quote models.PriceQuote) apiPrice {
+	price := apiPrice{
+		Currency:  quote.Currency,
+		Nights:    []apiNight{},
+		Subtotal:  quote.Subtotal,
+		PromoCode: quote.PromoCode,
+		Discount:  quote.Discount,
+		Lines:     []apiPriceLine{},
+		Total:     quote.Total,
+	}
+
+	for _, night := range quote.Nights {
+		price.Nights = append(price.Nights, apiNight{
+			Date:     night.Date.Format(apiDateLayout),
+			RateName: night.RateName,
+			Amount:   night.Amount,
+		})
+	}
+
+	for _, line := range quote.Lines {
+		price.Lines = append(price.Lines, apiPriceLine{
+			Name:     line.Name,
+			Category: line.Category,
+			Amount:   line.Amount,
+		})
+	}
+
+	return price
+}
+
+// toAPIReservation converts the reservation <res> to its representation in the API
+func toAPIReservation(res models.Reservation) apiReservation {
+	out := apiReservation{
+		Code:               res.Code,
+		Status:             res.Status,
+		Room:               apiRoom{ID: res.RoomID, Name: res.Room.RoomName},
+		StartDate:          res.StartDate.Format(apiDateLayout),
+		EndDate:            res.EndDate.Format(apiDateLayout),
+		Guests:             res.Guests,
+		FirstName:          res.FirstName,
+		LastName:           res.LastName,
+		Email:              res.Email,
+		Phone:              res.Phone,
+		Price:              toAPIPrice(res.Price),
+		CancellationPolicy: res.CancellationSummary,
+		RefundAmount:       res.RefundAmount,
+	}
+
+	if !res.CancelledAt.IsZero() {
+		out.CancelledAt = res.CancelledAt.Format(time.RFC3339)
+	}
+
+	return out
+}
+
+// writeJSON writes <v> as the JSON body of a response with the status <status>
+func (m *Repository) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
+// apiClientError writes an error response with the status <status>. <fields> may be nil
+func (m *Repository) apiClientError(w http.ResponseWriter, status int, code, message string, fields map[string][]string) {
+	m.App.InfoLog.Println("API client error with status of", status)
+	m.writeJSON(w, status, apiError{Error: apiErrorDetail{
+		Code:    code,
+		Message: message,
+		Fields:  fields,
+	}})
+}
+
+// apiServerError logs the error <err> and writes an error response that does not reveal it
+func (m *Repository) apiServerError(w http.ResponseWriter, err error) {
+	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
+	m.App.ErrorLog.Println(trace)
+
+	body, _ := json.Marshal(apiError{Error: apiErrorDetail{
+		Code:    "internal_error",
+		Message: http.StatusText(http.StatusInternalServerError),
+	}})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write(body)
+}
+
+// apiValidationError writes the validation errors of the form <form>
+func (m *Repository) apiValidationError(w http.ResponseWriter, form *forms.Form) {
+	m.apiClientError(w, http.StatusUnprocessableEntity, "validation_failed", "The request has invalid fields", form.Errors.Messages(i18n.DefaultLocale))
+}
+
+// parseAPIDates parses the dates <start> and <end> of a stay in the time zone of the property, adding an error to
+// <form> for every invalid date
+func (m *Repository) parseAPIDates(form *forms.Form, start, end string) (time.Time, time.Time) {
+	startDate, err := forms.ParseDate(start, apiDateLayout, m.App.Property.TimeZone)
+	if err != nil {
+		form.Errors.Add("start_date", "The date must have the format YYYY-MM-DD")
+	}
+
+	endDate, err := forms.ParseDate(end, apiDateLayout, m.App.Property.TimeZone)
+	if err != nil {
+		form.Errors.Add("end_date", "The date must have the format YYYY-MM-DD")
+	}
+
+	return startDate, endDate
+}
+
+// APIRooms lists the rooms
+func (m *Repository) APIRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	out := apiRoomList{Rooms: []apiRoom{}}
+	for _, room := range rooms {
+		out.Rooms = append(out.Rooms, toAPIRoom(room))
+	}
+
+	m.writeJSON(w, http.StatusOK, out)
+}
+
+// APIAvailability lists the rooms that can be booked for the stay of the query parameters start_date, end_date and
+// guests, with the price of the stay. Free rooms whose stay rules do not allow the stay are listed with the reasons
+func (m *Repository) APIAvailability(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	form := forms.New(query)
+
+	startDate, endDate := m.parseAPIDates(form, query.Get("start_date"), query.Get("end_date"))
+
+	guests := 1
+	if query.Get("guests") != "" {
+		n, err := strconv.Atoi(query.Get("guests"))
+		if err != nil || n < 1 {
+			form.Errors.Add("guests", "form.guests_min")
+		}
+		guests = n
+	}
+
+	if !form.Valid() {
+		m.apiValidationError(w, form)
+		return
+	}
+
+	res := models.Reservation{
+		StartDate: startDate,
+		EndDate:   endDate,
+		Guests:    guests,
+	}
+
+	// The stay rules that apply to every room are reported like the invalid fields
+	violations, err := m.checkStayRules(res, i18n.DefaultLocale)
+	if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	if len(violations) > 0 {
+		m.apiClientError(w, http.StatusUnprocessableEntity, "stay_not_allowed", strings.Join(violations, ". "), nil)
+		return
+	}
+
+	rooms, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate)
+	if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	out := apiAvailability{
+		StartDate:   startDate.Format(apiDateLayout),
+		EndDate:     endDate.Format(apiDateLayout),
+		Guests:      guests,
+		Rooms:       []apiAvailableRoom{},
+		Unavailable: []apiUnavailableRoom{},
+	}
+
+	for _, room := range rooms {
+		res.RoomID = room.ID
+
+		violations, err := m.checkStayRules(res, i18n.DefaultLocale)
+		if err != nil {
+			m.apiServerError(w, err)
+			return
+		}
+
+		if len(violations) > 0 {
+			out.Unavailable = append(out.Unavailable, apiUnavailableRoom{Room: toAPIRoom(room), Reasons: violations})
+			continue
+		}
+
+		quote, err := m.priceReservation(res, room, nil)
+		if err != nil {
+			m.apiServerError(w, err)
+			return
+		}
+
+		out.Rooms = append(out.Rooms, apiAvailableRoom{Room: toAPIRoom(room), Price: toAPIPrice(quote)})
+	}
+
+	m.writeJSON(w, http.StatusOK, out)
+}
+
+// APIPostReservation creates a reservation from the JSON body of the request. The guest details are validated like
+// those of the reservation form. Like on the website, the room is held while the card of the request is charged, and
+// the reservation is confirmed once it is paid. The API keys allowed to book without paying collect the payment
+// themselves, and their reservations are confirmed at once
+func (m *Repository) APIPostReservation(w http.ResponseWriter, r *http.Request) {
+	var req apiReservationRequest
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		m.apiClientError(w, http.StatusBadRequest, "invalid_json", "The body must be a JSON reservation: "+err.Error(), nil)
+		return
+	}
+
+	// The guest details are checked with the same rules as the reservation form
+	form := forms.New(url.Values{
+		"first_name": {req.FirstName},
+		"last_name":  {req.LastName},
+		"email":      {req.Email},
+		"phone":      {req.Phone},
+	})
+	if err := validateGuestDetails(form); err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	startDate, endDate := m.parseAPIDates(form, req.StartDate, req.EndDate)
+
+	if req.Guests < 1 {
+		form.Errors.Add("guests", "form.guests_min")
+	}
+
+	room, err := m.DB.GetRoomByID(req.RoomID)
+	if err == sql.ErrNoRows {
+		form.Errors.Add("room_id", "Unknown room")
+	} else if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	if !form.Valid() {
+		m.apiValidationError(w, form)
+		return
+	}
+
+	res := models.Reservation{
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		Email:     req.Email,
+		Phone:     req.Phone,
+		StartDate: startDate,
+		EndDate:   endDate,
+		RoomID:    room.ID,
+		Guests:    req.Guests,
+	}
+
+	violations, err := m.checkStayRules(res, i18n.DefaultLocale)
+	if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	if len(violations) > 0 {
+		m.apiClientError(w, http.StatusUnprocessableEntity, "stay_not_allowed", strings.Join(violations, ". "), nil)
+		return
+	}
+
+	available, err := m.DB.SearchAvailabilityByDatesByRoomID(startDate, endDate, room.ID)
+	if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	if !available {
+		m.apiClientError(w, http.StatusConflict, "room_unavailable", "The room is not available for these dates", nil)
+		return
+	}
+
+	res.Price, err = m.priceReservation(res, room, nil)
+	if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	res, err = m.withCancellationPolicy(res)
+	if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	if req.PromoCode != "" {
+		var msg string
+		res, msg, err = m.applyPromoCode(res, room, strings.TrimSpace(req.PromoCode))
+		if err != nil {
+			m.apiServerError(w, err)
+			return
+		}
+
+		if msg != "" {
+			form.Errors.Add("promo_code", msg)
+			m.apiValidationError(w, form)
+			return
+		}
+	}
+
+	k, _ := r.Context().Value(apiKeyContextKey).(models.APIKey)
+	paid := res.Price.Total > 0 && !k.Scopes.Contains(models.ScopeCreateUnpaidReservation)
+
+	res.Status = models.ReservationConfirmed
+	if paid {
+		if strings.TrimSpace(req.CardNumber) == "" {
+			form.Errors.Add("card_number", "form.required")
+			m.apiValidationError(w, form)
+			return
+		}
+
+		res.Status = models.ReservationPending
+		res.ExpiresAt = m.App.Clock.Now().Add(holdDuration)
+	}
+
+	res, err = m.bookReservation(res, room)
+	if err == errPromoCodeUsedUp {
+		form.Errors.Add("promo_code", "form.promo_code_used_up")
+		m.apiValidationError(w, form)
+		return
+	} else if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	if paid {
+		err = m.payReservation(res, req.CardNumber)
+		if err == payments.ErrDeclined || err == errPaymentFailed {
+			// The room is released at once, as the API client books again with another card
+			if _, err := m.DB.CancelReservation(res.ID, 0); err != nil {
+				m.apiServerError(w, err)
+				return
+			}
+			res.Status = models.ReservationCancelled
+			res.CancelledAt = m.App.Clock.Now()
+			m.queueWebhook(models.EventReservationCancelled, toAPIReservation(res))
+
+			if err == payments.ErrDeclined {
+				m.apiClientError(w, http.StatusPaymentRequired, "card_declined", i18n.T(i18n.DefaultLocale, "checkout.card_declined"), nil)
+			} else {
+				m.apiClientError(w, http.StatusPaymentRequired, "payment_failed", i18n.T(i18n.DefaultLocale, "checkout.payment_failed"), nil)
+			}
+			return
+		} else if err != nil {
+			m.apiServerError(w, err)
+			return
+		}
+
+		err = m.DB.UpdateReservationStatus(res.ID, models.ReservationConfirmed)
+		if err != nil {
+			m.apiServerError(w, err)
+			return
+		}
+		res.Status = models.ReservationConfirmed
+	}
+
+	err = m.sendConfirmation(res)
+	if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/reservations/"+res.Code)
+	m.writeJSON(w, http.StatusCreated, toAPIReservation(res))
+}
+
+// apiReservationByCode gets the reservation of the confirmation code in the URL. When there is none, an error response
+// is written and false is returned
+func (m *Repository) apiReservationByCode(w http.ResponseWriter, r *http.Request) (models.Reservation, bool) {
+	res, err := m.DB.GetReservationByCode(chi.URLParam(r, "code"))
+	if err == sql.ErrNoRows {
+		m.apiClientError(w, http.StatusNotFound, "not_found", "There is no reservation with this confirmation code", nil)
+		return res, false
+	} else if err != nil {
+		m.apiServerError(w, err)
+		return res, false
+	}
+
+	return res, true
+}
+
+// APIReservation shows the reservation of a confirmation code
+func (m *Repository) APIReservation(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.apiReservationByCode(w, r)
+	if !ok {
+		return
+	}
+
+	m.writeJSON(w, http.StatusOK, toAPIReservation(res))
+}
+
+// APICancelReservation cancels the reservation of a confirmation code and refunds the guest what its cancellation
+// policy allows
+func (m *Repository) APICancelReservation(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.apiReservationByCode(w, r)
+	if !ok {
+		return
+	}
+
+	if res.Status == models.ReservationCancelled {
+		m.apiClientError(w, http.StatusConflict, "already_cancelled", "The reservation is already cancelled", nil)
+		return
+	}
+
+	res, err := m.cancelReservation(res)
+	if errors.Is(err, errAlreadyCancelled) {
+		m.apiClientError(w, http.StatusConflict, "already_cancelled", "The reservation is already cancelled", nil)
+		return
+	} else if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	m.writeJSON(w, http.StatusOK, toAPIReservation(res))
+}
@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wagnojunior/booking/internal/payments"
+)
+
+// testAPIKey has every scope in the test database
+const testAPIKey = "bk_full0001_secret"
+
+// apiResponse decodes the body of an API response: a room list, an availability, a reservation or an error
+type apiResponse struct {
+	Rooms []json.RawMessage `json:"rooms"`
+	apiReservation
+	Error apiErrorDetail `json:"error"`
+}
+
+func TestRepository_APIRooms(t *testing.T) {
+	ts := httptest.NewServer(getRoutes())
+	defer ts.Close()
+
+	resp, body := apiRequest(t, ts, "GET", "/api/v1/rooms", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("APIRooms returned wrong response code: got %d, wanted %d", resp.StatusCode, http.StatusOK)
+	}
+
+	if resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("APIRooms returned wrong content type: %s", resp.Header.Get("Content-Type"))
+	}
+
+	if len(body.Rooms) != 2 {
+		t.Errorf("APIRooms returned %d rooms, wanted 2", len(body.Rooms))
+	}
+}
+
+func TestRepository_APIAvailability(t *testing.T) {
+	ts := httptest.NewServer(getRoutes())
+	defer ts.Close()
+
+	start := nextWeekday(time.Monday)
+	past := time.Now().AddDate(0, 0, -3)
+
+	var tests = []struct {
+		name          string
+		query         string
+		expectedCode  int
+		expectedError string
+	}{
+		{"available", "?start_date=" + start.Format("2006-01-02") + "&end_date=" + start.AddDate(0, 0, 2).Format("2006-01-02") + "&guests=2", http.StatusOK, ""},
+		{"invalid date", "?start_date=tomorrow&end_date=" + start.Format("2006-01-02"), http.StatusUnprocessableEntity, "validation_failed"},
+		{"invalid guests", "?start_date=" + start.Format("2006-01-02") + "&end_date=" + start.AddDate(0, 0, 2).Format("2006-01-02") + "&guests=0", http.StatusUnprocessableEntity, "validation_failed"},
+		{"arrival in the past", "?start_date=" + past.Format("2006-01-02") + "&end_date=" + start.Format("2006-01-02"), http.StatusUnprocessableEntity, "stay_not_allowed"},
+	}
+
+	for _, e := range tests {
+		resp, body := apiRequest(t, ts, "GET", "/api/v1/availability"+e.query, "")
+		if resp.StatusCode != e.expectedCode {
+			t.Errorf("for %s, expected %d but got %d", e.name, e.expectedCode, resp.StatusCode)
+		}
+
+		if body.Error.Code != e.expectedError {
+			t.Errorf("for %s, expected error %q but got %q", e.name, e.expectedError, body.Error.Code)
+		}
+
+		if e.expectedCode == http.StatusOK && len(body.Rooms) != 1 {
+			t.Errorf("for %s, expected 1 available room but got %d", e.name, len(body.Rooms))
+		}
+	}
+}
+
+func TestRepository_APIPostReservation(t *testing.T) {
+	ts := httptest.NewServer(getRoutes())
+	defer ts.Close()
+
+	start := nextWeekday(time.Monday).Format("2006-01-02")
+	end := nextWeekday(time.Monday).AddDate(0, 0, 2).Format("2006-01-02")
+	dates := `"start_date": "` + start + `", "end_date": "` + end + `"`
+
+	var tests = []struct {
+		name          string
+		body          string
+		expectedCode  int
+		expectedError string
+		expectedField string
+	}{
+		{"valid", `{"room_id": 1, ` + dates + `, "guests": 2, "first_name": "John", "last_name": "Smith", "email": "john@smith.com"}`, http.StatusCreated, "", ""},
+		{"with promo code", `{"room_id": 1, ` + dates + `, "guests": 1, "first_name": "John", "last_name": "Smith", "email": "john@smith.com", "promo_code": "spring10"}`, http.StatusCreated, "", ""},
+		{"invalid promo code", `{"room_id": 1, ` + dates + `, "guests": 1, "first_name": "John", "last_name": "Smith", "email": "john@smith.com", "promo_code": "nope"}`, http.StatusUnprocessableEntity, "validation_failed", "promo_code"},
+		{"short first name", `{"room_id": 1, ` + dates + `, "guests": 1, "first_name": "Jo", "last_name": "Smith", "email": "john@smith.com"}`, http.StatusUnprocessableEntity, "validation_failed", "first_name"},
+		{"invalid email", `{"room_id": 1, ` + dates + `, "guests": 1, "first_name": "John", "last_name": "Smith", "email": "john"}`, http.StatusUnprocessableEntity, "validation_failed", "email"},
+		{"invalid date", `{"room_id": 1, "start_date": "2050/01/01", "end_date": "` + end + `", "guests": 1, "first_name": "John", "last_name": "Smith", "email": "john@smith.com"}`, http.StatusUnprocessableEntity, "validation_failed", "start_date"},
+		{"no guests", `{"room_id": 1, ` + dates + `, "first_name": "John", "last_name": "Smith", "email": "john@smith.com"}`, http.StatusUnprocessableEntity, "validation_failed", "guests"},
+		{"room not available", `{"room_id": 2, ` + dates + `, "guests": 1, "first_name": "John", "last_name": "Smith", "email": "john@smith.com"}`, http.StatusConflict, "room_unavailable", ""},
+		{"invalid json", `{"room_id": "one"}`, http.StatusBadRequest, "invalid_json", ""},
+		{"unknown field", `{"room": 1}`, http.StatusBadRequest, "invalid_json", ""},
+	}
+
+	for _, e := range tests {
+		resp, body := apiRequest(t, ts, "POST", "/api/v1/reservations", e.body)
+		if resp.StatusCode != e.expectedCode {
+			t.Errorf("for %s, expected %d but got %d", e.name, e.expectedCode, resp.StatusCode)
+		}
+
+		if body.Error.Code != e.expectedError {
+			t.Errorf("for %s, expected error %q but got %q", e.name, e.expectedError, body.Error.Code)
+		}
+
+		if e.expectedField != "" && len(body.Error.Fields[e.expectedField]) == 0 {
+			t.Errorf("for %s, expected an error for the field %s but got %v", e.name, e.expectedField, body.Error.Fields)
+		}
+
+		if e.expectedCode == http.StatusCreated {
+			if len(body.Code) != 8 || body.Status != "confirmed" {
+				t.Errorf("for %s, expected a confirmed reservation with a code but got %q %q", e.name, body.Code, body.Status)
+			}
+
+			if resp.Header.Get("Location") != "/api/v1/reservations/"+body.Code {
+				t.Errorf("for %s, wrong location %s", e.name, resp.Header.Get("Location"))
+			}
+		}
+	}
+}
+
+func TestRepository_APIPostReservationPaid(t *testing.T) {
+	ts := httptest.NewServer(getRoutes())
+	defer ts.Close()
+
+	start := nextWeekday(time.Monday).Format("2006-01-02")
+	end := nextWeekday(time.Monday).AddDate(0, 0, 2).Format("2006-01-02")
+	reservation := `"room_id": 1, "start_date": "` + start + `", "end_date": "` + end + `", "guests": 1, "first_name": "John", "last_name": "Smith", "email": "john@smith.com"`
+
+	var tests = []struct {
+		name           string
+		body           string
+		expectedCode   int
+		expectedError  string
+		expectedStatus string
+	}{
+		{"paid", `{` + reservation + `, "card_number": "` + payments.FakeCardOK + `"}`, http.StatusCreated, "", "confirmed"},
+		{"no card", `{` + reservation + `}`, http.StatusUnprocessableEntity, "validation_failed", ""},
+		{"declined", `{` + reservation + `, "card_number": "` + payments.FakeCardDeclined + `"}`, http.StatusPaymentRequired, "card_declined", ""},
+	}
+
+	for _, e := range tests {
+		// The API key may book, but not without paying
+		req, _ := http.NewRequest("POST", ts.URL+"/api/v1/reservations", strings.NewReader(e.body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer bk_book0001_secret")
+
+		resp, body := doAPIRequest(t, req)
+		if resp.StatusCode != e.expectedCode || body.Error.Code != e.expectedError || body.Status != e.expectedStatus {
+			t.Errorf("for %s, expected %d %q %q but got %d %q %q", e.name, e.expectedCode, e.expectedError, e.expectedStatus,
+				resp.StatusCode, body.Error.Code, body.Status)
+		}
+	}
+}
+
+func TestRepository_APIReservation(t *testing.T) {
+	ts := httptest.NewServer(getRoutes())
+	defer ts.Close()
+
+	resp, body := apiRequest(t, ts, "GET", "/api/v1/reservations/testcod1", "")
+	if resp.StatusCode != http.StatusOK || body.Code != "TESTCOD1" {
+		t.Errorf("APIReservation did not return the reservation: got %d %q", resp.StatusCode, body.Code)
+	}
+
+	resp, body = apiRequest(t, ts, "GET", "/api/v1/reservations/UNKNOWN1", "")
+	if resp.StatusCode != http.StatusNotFound || body.Error.Code != "not_found" {
+		t.Errorf("APIReservation returned %d %q for an unknown code, wanted 404 not_found", resp.StatusCode, body.Error.Code)
+	}
+}
+
+func TestRepository_APICancelReservation(t *testing.T) {
+	ts := httptest.NewServer(getRoutes())
+	defer ts.Close()
+
+	// Use a gateway that knows the captured payment of the reservation
+	gateway := payments.NewFakeGateway("secret")
+	ref, _ := gateway.Authorise(payments.AuthoriseRequest{Amount: 15200, CardNumber: payments.FakeCardOK})
+	_ = gateway.Capture(ref, 15200)
+
+	previous := app.PaymentGateway
+	app.PaymentGateway = gateway
+	defer func() { app.PaymentGateway = previous }()
+
+	// Reservation 1 arrives in 30 days, so its policy refunds the whole payment
+	resp, body := apiRequest(t, ts, "POST", "/api/v1/reservations/TESTCOD1/cancel", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("APICancelReservation returned wrong response code: got %d, wanted %d", resp.StatusCode, http.StatusOK)
+	}
+
+	if body.Status != "cancelled" || body.RefundAmount != 15200 || body.CancelledAt == "" {
+		t.Errorf("APICancelReservation returned %q with a refund of %d", body.Status, body.RefundAmount)
+	}
+
+	// Reservation 2 is already cancelled
+	resp, body = apiRequest(t, ts, "POST", "/api/v1/reservations/TESTCOD2/cancel", "")
+	if resp.StatusCode != http.StatusConflict || body.Error.Code != "already_cancelled" {
+		t.Errorf("APICancelReservation returned %d %q for a cancelled reservation", resp.StatusCode, body.Error.Code)
+	}
+
+	resp, _ = apiRequest(t, ts, "POST", "/api/v1/reservations/UNKNOWN1/cancel", "")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("APICancelReservation returned %d for an unknown code, wanted 404", resp.StatusCode)
+	}
+}
+
+func TestRepository_APIAuth(t *testing.T) {
+	ts := httptest.NewServer(getRoutes())
+	defer ts.Close()
+
+	var tests = []struct {
+		name          string
+		header        string
+		key           string
+		method        string
+		path          string
+		expectedCode  int
+		expectedError string
+	}{
+		{"bearer", "Authorization", "Bearer bk_read0001_secret", "GET", "/api/v1/rooms", http.StatusOK, ""},
+		{"x-api-key", "X-API-Key", "bk_read0001_secret", "GET", "/api/v1/rooms", http.StatusOK, ""},
+		{"no key", "", "", "GET", "/api/v1/rooms", http.StatusUnauthorized, "unauthorized"},
+		{"not a key", "Authorization", "Bearer secret", "GET", "/api/v1/rooms", http.StatusUnauthorized, "unauthorized"},
+		{"unknown key", "Authorization", "Bearer bk_none0001_secret", "GET", "/api/v1/rooms", http.StatusUnauthorized, "unauthorized"},
+		{"wrong secret", "Authorization", "Bearer bk_read0001_wrong", "GET", "/api/v1/rooms", http.StatusUnauthorized, "unauthorized"},
+		{"expired key", "Authorization", "Bearer bk_expd0001_secret", "GET", "/api/v1/rooms", http.StatusUnauthorized, "key_expired"},
+		{"missing scope", "Authorization", "Bearer bk_read0001_secret", "POST", "/api/v1/reservations", http.StatusForbidden, "insufficient_scope"},
+		{"missing scope to cancel", "Authorization", "Bearer bk_read0001_secret", "POST", "/api/v1/reservations/TESTCOD1/cancel", http.StatusForbidden, "insufficient_scope"},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest(e.method, ts.URL+e.path, strings.NewReader("{}"))
+		if e.header != "" {
+			req.Header.Set(e.header, e.key)
+		}
+
+		resp, body := doAPIRequest(t, req)
+		if resp.StatusCode != e.expectedCode {
+			t.Errorf("for %s, expected %d but got %d", e.name, e.expectedCode, resp.StatusCode)
+		}
+
+		if body.Error.Code != e.expectedError {
+			t.Errorf("for %s, expected error %q but got %q", e.name, e.expectedError, body.Error.Code)
+		}
+	}
+}
+
+func TestRepository_APIRateLimit(t *testing.T) {
+	ts := httptest.NewServer(getRoutes())
+	defer ts.Close()
+
+	// slow0001 allows one request per minute
+	var resp *http.Response
+	var body apiResponse
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", ts.URL+"/api/v1/rooms", nil)
+		req.Header.Set("Authorization", "Bearer bk_slow0001_secret")
+		resp, body = doAPIRequest(t, req)
+
+		if i == 0 && resp.Header.Get("X-RateLimit-Limit") != "1" {
+			t.Errorf("expected the rate limit in the headers but got %q", resp.Header.Get("X-RateLimit-Limit"))
+		}
+	}
+
+	// The clock is stopped, so both requests fall in the same minute
+	if resp.StatusCode != http.StatusTooManyRequests || body.Error.Code != "rate_limited" {
+		t.Errorf("expected the second request to be rate limited but got %d %q", resp.StatusCode, body.Error.Code)
+	}
+
+	if resp.Header.Get("Retry-After") == "" {
+		t.Error("expected a Retry-After header")
+	}
+
+	// A minute later, the key can make a request again
+	testClock.Advance(time.Minute)
+	defer testClock.Set(time.Now())
+
+	req, _ := http.NewRequest("GET", ts.URL+"/api/v1/rooms", nil)
+	req.Header.Set("Authorization", "Bearer bk_slow0001_secret")
+	if resp, _ := doAPIRequest(t, req); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the request of the next minute to be allowed but got %d", resp.StatusCode)
+	}
+}
+
+// apiRequest sends a request with the JSON <body> to the test server <ts> and decodes the JSON response
+func apiRequest(t *testing.T, ts *httptest.Server, method, path, body string) (*http.Response, apiResponse) {
+	req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+testAPIKey)
+
+	return doAPIRequest(t, req)
+}
+
+// doAPIRequest sends the request <req> and decodes the JSON response
+func doAPIRequest(t *testing.T, req *http.Request) (*http.Response, apiResponse) {
+	method, path := req.Method, req.URL.Path
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var out apiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("%s %s did not return JSON: %v", method, path, err)
+	}
+
+	return resp, out
+}
+
+func TestRepository_OpenAPI(t *testing.T) {
+	ts := httptest.NewServer(getRoutes())
+	defer ts.Close()
+
+	// The document is public
+	resp, err := http.Get(ts.URL + "/api/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("OpenAPI returned wrong response code: got %d, wanted %d", resp.StatusCode, http.StatusOK)
+	}
+
+	var doc struct {
+		OpenAPI    string                            `json:"openapi"`
+		Paths      map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.OpenAPI == "" || doc.Paths["/api/v1/reservations"]["post"] == nil || doc.Components.Schemas["Reservation"] == nil {
+		t.Errorf("expected an OpenAPI document describing the reservations but got %+v", doc)
+	}
+}
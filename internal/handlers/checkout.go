@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/wagnojunior/booking/internal/forms"
+	"github.com/wagnojunior/booking/internal/helpers"
+	"github.com/wagnojunior/booking/internal/invoice"
+	"github.com/wagnojunior/booking/internal/models"
+	"github.com/wagnojunior/booking/internal/payments"
+	"github.com/wagnojunior/booking/internal/pricing"
+	"github.com/wagnojunior/booking/internal/render"
+)
+
+const (
+	holdDuration = 20 * time.Minute // How long the room of a pending reservation is held while the guest pays
+
+	// How long after the end of its hold a pending reservation is cancelled, so that a payment started just before
+	// the end can complete
+	holdGrace = 5 * time.Minute
+)
+
+// Checkout shows the payment page of the pending reservation in the session
+func (m *Repository) Checkout(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.pendingReservation(w, r)
+	if !ok {
+		return
+	}
+
+	m.renderCheckout(w, r, res, forms.New(nil))
+}
+
+// PostCheckout pays the pending reservation in the session and confirms it
+func (m *Repository) PostCheckout(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.pendingReservation(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+
+	// Nothing to pay when a promo code covers the whole stay
+	if res.Price.Total > 0 {
+		form.Required("card_number")
+		if !form.Valid() {
+			m.renderCheckout(w, r, res, form)
+			return
+		}
+
+		err = m.payReservation(res, r.Form.Get("card_number"))
+		if err == payments.ErrDeclined {
+			form.Errors.Add("card_number", "checkout.card_declined")
+			m.renderCheckout(w, r, res, form)
+			return
+		} else if err == errPaymentFailed {
+			form.Errors.Add("card_number", "checkout.payment_failed")
+			m.renderCheckout(w, r, res, form)
+			return
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	err = m.DB.UpdateReservationStatus(res.ID, models.ReservationConfirmed)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	res.Status = models.ReservationConfirmed
+
+	err = m.sendConfirmation(res)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "reservation", res)
+	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+}
+
+// errPaymentFailed is returned when an authorised payment could not be captured
+var errPaymentFailed = errors.New("the payment could not be completed")
+
+// payReservation collects the price of the reservation <res> from the card <cardNumber>. Every attempt is recorded,
+// so that failed payments can be looked into later. payments.ErrDeclined is returned when the card is refused, and
+// errPaymentFailed when the payment could not be captured
+func (m *Repository) payReservation(res models.Reservation, cardNumber string) error {
+	payment := models.Payment{
+		ReservationID: res.ID,
+		Amount:        res.Price.Total,
+		Currency:      res.Price.Currency,
+		Status:        models.PaymentAuthorised,
+	}
+
+	var err error
+	payment.ProviderRef, err = m.App.PaymentGateway.Authorise(payments.AuthoriseRequest{
+		Amount:      res.Price.Total,
+		Currency:    res.Price.Currency,
+		CardNumber:  cardNumber,
+		Description: fmt.Sprintf("Reservation %d", res.ID),
+	})
+	if err == payments.ErrDeclined {
+		payment.Status = models.PaymentFailed
+		if _, err = m.DB.InsertPayment(payment); err != nil {
+			return err
+		}
+
+		return payments.ErrDeclined
+	} else if err != nil {
+		return err
+	}
+
+	payment.ID, err = m.DB.InsertPayment(payment)
+	if err != nil {
+		return err
+	}
+
+	err = m.App.PaymentGateway.Capture(payment.ProviderRef, payment.Amount)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		if err = m.DB.UpdatePaymentStatus(payment.ID, models.PaymentFailed); err != nil {
+			return err
+		}
+
+		return errPaymentFailed
+	}
+
+	return m.DB.UpdatePaymentStatus(payment.ID, models.PaymentCaptured)
+}
+
+// PaymentWebhook receives the changes of the status of the payments from the payment provider
+func (m *Repository) PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	event, err := m.App.PaymentGateway.VerifyWebhook(r)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	payment, err := m.DB.GetPaymentByProviderRef(event.Ref)
+	if err == sql.ErrNoRows {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	switch event.Type {
+	case payments.EventCaptured:
+		// The checkout may have recorded the capture already
+		if payment.Status != models.PaymentCaptured {
+			err = m.confirmCapture(payment, event.Amount)
+		}
+	case payments.EventFailed:
+		err = m.DB.UpdatePaymentStatus(payment.ID, models.PaymentFailed)
+	case payments.EventRefunded:
+		status := models.PaymentRefunded
+		if event.Amount < payment.Amount {
+			status = models.PaymentPartiallyRefunded
+		}
+		err = m.DB.UpdatePaymentRefund(payment.ID, event.Amount, status)
+	default:
+		m.App.InfoLog.Println("Ignoring payment event", event.Type)
+	}
+
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// confirmCapture confirms the reservation of the <payment> of which the provider captured <amount>. When the
+// reservation is no longer pending, its hold has expired or the amount is not the price of the stay, the reservation
+// is left as it is and the amount is refunded
+func (m *Repository) confirmCapture(payment models.Payment, amount int) error {
+	res, err := m.DB.GetReservationByID(payment.ReservationID)
+	if err != nil {
+		return err
+	}
+
+	if amount == payment.Amount && amount == res.Price.Total {
+		// A payment started before the end of the hold can complete during the grace period, as the room is only
+		// freed after it
+		confirmed, err := m.DB.ConfirmReservationPayment(payment.ID, res.ID, m.App.Clock.Now().Add(-holdGrace))
+		if err != nil || confirmed {
+			return err
+		}
+	}
+
+	m.App.ErrorLog.Printf("Refunding %s captured for reservation %s, which cannot be confirmed (status %s, price %s)",
+		pricing.FormatAmount(amount, payment.Currency), res.Code, res.Status, pricing.FormatAmount(res.Price.Total, res.Price.Currency))
+
+	err = m.App.PaymentGateway.Refund(payment.ProviderRef, amount)
+	if err != nil {
+		return err
+	}
+
+	// All that was captured is given back, even when it is not the whole amount of the payment
+	return m.DB.UpdatePaymentRefund(payment.ID, amount, models.PaymentRefunded)
+}
+
+// sendConfirmation sends the confirmation email of the confirmed reservation <res> to the guest,
+// with the itemised price and the invoice
+func (m *Repository) sendConfirmation(res models.Reservation) error {
+	inv, pdf, err := m.invoicePDF(res)
+	if err != nil {
+		return err
+	}
+
+	m.App.MailChan <- models.MailData{
+		To:      res.Email,
+		From:    m.App.MailFrom,
+		Subject: "Reservation confirmation",
+		Content: confirmationEmail(res, m.App.Property),
+		Attachments: []models.MailAttachment{
+			{Name: invoice.FileName(inv), ContentType: "application/pdf", Data: pdf},
+		},
+	}
+
+	return nil
+}
+
+// pendingReservation gets the reservation waiting for payment from the session.
+// When there is none, the user is redirected and false is returned
+func (m *Repository) pendingReservation(w http.ResponseWriter, r *http.Request) (models.Reservation, bool) {
+	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+	if !ok || res.ID == 0 {
+		m.App.Session.Put(r.Context(), "error", "Can't get reservation from session")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return res, false
+	}
+
+	if res.Status != models.ReservationPending {
+		http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+		return res, false
+	}
+
+	// The room is no longer held, and the guest has to book again
+	if !res.ExpiresAt.IsZero() && !m.App.Clock.Now().Before(res.ExpiresAt) {
+		m.App.Session.Remove(r.Context(), "reservation")
+		m.App.Session.Put(r.Context(), "error", "The room is no longer held for you, as it was not paid in time. Please book again")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return res, false
+	}
+
+	return res, true
+}
+
+// renderCheckout renders the checkout page of the reservation <res>
+func (m *Repository) renderCheckout(w http.ResponseWriter, r *http.Request, res models.Reservation, form *forms.Form) {
+	data := make(map[string]interface{})
+	data["reservation"] = res
+
+	if err := render.Template(w, r, "checkout.page.tmpl", &models.TemplateData{
+		Form: form,
+		Data: data,
+		JSON: toAPIReservation(res),
+	}); err != nil {
+		helpers.ServerError(w, err)
+	}
+}
+
+// ExpireHolds cancels the pending reservations that were not paid in time, so that their rooms can be booked again,
+// and returns how many it cancelled. It is run by the background worker
+func (m *Repository) ExpireHolds() int {
+	expired, err := m.DB.ExpirePendingReservations(m.App.Clock.Now().Add(-holdGrace))
+	if err != nil {
+		m.App.ErrorLog.Println("Error expiring the unpaid reservations:", err)
+		return 0
+	}
+
+	for _, res := range expired {
+		m.App.InfoLog.Println("Released the room of the unpaid reservation", res.Code)
+		m.queueWebhook(models.EventReservationCancelled, toAPIReservation(res))
+	}
+
+	return len(expired)
+}
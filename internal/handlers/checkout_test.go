@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wagnojunior/booking/internal/models"
+	"github.com/wagnojunior/booking/internal/payments"
+	"github.com/wagnojunior/booking/internal/repository/dbrepo"
+)
+
+func TestRepository_Checkout(t *testing.T) {
+	reservation := models.Reservation{
+		ID:     1,
+		RoomID: 1,
+		Status: models.ReservationPending,
+		Price:  models.PriceQuote{Currency: "USD", Total: 15200},
+	}
+
+	req, _ := http.NewRequest("GET", "/checkout", nil)
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	rr := httptest.NewRecorder()
+	session.Put(ctx, "reservation", reservation)
+
+	handler := http.HandlerFunc(Repo.Checkout)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Checkout handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+
+	// test case where reservation is not in session
+	req, _ = http.NewRequest("GET", "/checkout", nil)
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+	rr = httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/" {
+		t.Errorf("Checkout handler did not redirect home without a reservation: got %d %s", rr.Code, rr.Header().Get("Location"))
+	}
+}
+
+func TestRepository_PostCheckout(t *testing.T) {
+	var tests = []struct {
+		name             string
+		cardNumber       string
+		total            int
+		expectedCode     int
+		expectedLocation string
+		expectedStatus   string
+	}{
+		{"paid", payments.FakeCardOK, 15200, http.StatusSeeOther, "/reservation-summary", models.ReservationConfirmed},
+		{"declined", payments.FakeCardDeclined, 15200, http.StatusOK, "", models.ReservationPending},
+		{"missing card", "", 15200, http.StatusOK, "", models.ReservationPending},
+		{"nothing to pay", "", 0, http.StatusSeeOther, "/reservation-summary", models.ReservationConfirmed},
+	}
+
+	for _, e := range tests {
+		reservation := models.Reservation{
+			ID:     1,
+			RoomID: 1,
+			Email:  "john@smith.com",
+			Status: models.ReservationPending,
+			Price:  models.PriceQuote{Currency: "USD", Total: e.total},
+		}
+
+		postedData := url.Values{}
+		postedData.Add("card_number", e.cardNumber)
+
+		req, _ := http.NewRequest("POST", "/checkout", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		session.Put(ctx, "reservation", reservation)
+
+		handler := http.HandlerFunc(Repo.PostCheckout)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("For %s, expected %d but got %d", e.name, e.expectedCode, rr.Code)
+		}
+
+		if rr.Header().Get("Location") != e.expectedLocation {
+			t.Errorf("For %s, expected redirect to %s but got %s", e.name, e.expectedLocation, rr.Header().Get("Location"))
+		}
+
+		res, _ := session.Get(ctx, "reservation").(models.Reservation)
+		if res.Status != e.expectedStatus {
+			t.Errorf("For %s, expected the reservation to be %s but got %s", e.name, e.expectedStatus, res.Status)
+		}
+	}
+}
+
+func TestRepository_PaymentWebhook(t *testing.T) {
+	gateway := app.PaymentGateway
+	defer func() {
+		app.PaymentGateway = gateway
+		testClock.Set(time.Now())
+	}()
+
+	var tests = []struct {
+		name           string
+		body           string
+		signed         bool
+		now            time.Time
+		expectedCode   int
+		expectedRefund bool
+	}{
+		{"captured", `{"type":"payment.captured","ref":"fake_3","amount":15200}`, true, dbrepo.TestHoldExpiry.Add(-time.Minute), http.StatusOK, false},
+		{"captured within the grace period", `{"type":"payment.captured","ref":"fake_3","amount":15200}`, true, dbrepo.TestHoldExpiry.Add(holdGrace - time.Minute), http.StatusOK, false},
+		{"captured after the hold expired", `{"type":"payment.captured","ref":"fake_3","amount":15200}`, true, dbrepo.TestHoldExpiry.Add(holdGrace + time.Minute), http.StatusOK, true},
+		{"captured another amount", `{"type":"payment.captured","ref":"fake_3","amount":100}`, true, dbrepo.TestHoldExpiry.Add(-time.Minute), http.StatusOK, true},
+		{"captured for a confirmed reservation", `{"type":"payment.captured","ref":"fake_1","amount":15200}`, true, dbrepo.TestHoldExpiry.Add(-time.Minute), http.StatusOK, true},
+		{"unknown payment", `{"type":"payment.captured","ref":"fake_9","amount":15200}`, true, dbrepo.TestHoldExpiry, http.StatusNotFound, false},
+		{"bad signature", `{"type":"payment.captured","ref":"fake_3","amount":15200}`, false, dbrepo.TestHoldExpiry, http.StatusBadRequest, false},
+	}
+
+	for _, e := range tests {
+		testClock.Set(e.now)
+
+		// The payments fake_1 to fake_3 are authorised and captured at the provider
+		fake := payments.NewFakeGateway("secret")
+		for i := 1; i <= 3; i++ {
+			ref, _ := fake.Authorise(payments.AuthoriseRequest{Amount: 15200, Currency: "USD", CardNumber: payments.FakeCardOK})
+			_ = fake.Capture(ref, 15200)
+		}
+		app.PaymentGateway = fake
+
+		req, _ := http.NewRequest("POST", "/payments/webhook", bytes.NewReader([]byte(e.body)))
+		if e.signed {
+			req.Header.Set(payments.FakeSignatureHeader, fake.Sign([]byte(e.body)))
+		}
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PaymentWebhook)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("For %s, expected %d but got %d", e.name, e.expectedCode, rr.Code)
+		}
+
+		// The whole payment can only be refunded again if nothing was refunded
+		refunded := fake.Refund("fake_3", 15200) != nil || fake.Refund("fake_1", 15200) != nil
+		if refunded != e.expectedRefund {
+			t.Errorf("For %s, expected the payment to be refunded: %t", e.name, e.expectedRefund)
+		}
+	}
+}
+
+func TestRepository_CheckoutHoldExpired(t *testing.T) {
+	defer testClock.Set(time.Now())
+
+	reservation := models.Reservation{
+		ID:        1,
+		RoomID:    1,
+		Status:    models.ReservationPending,
+		Price:     models.PriceQuote{Currency: "USD", Total: 15200},
+		ExpiresAt: testClock.Now().Add(holdDuration),
+	}
+
+	var tests = []struct {
+		name             string
+		elapsed          time.Duration
+		expectedCode     int
+		expectedLocation string
+	}{
+		{"held", holdDuration - time.Minute, http.StatusOK, ""},
+		{"expired", holdDuration, http.StatusSeeOther, "/search-availability"},
+	}
+
+	start := testClock.Now()
+	for _, e := range tests {
+		testClock.Set(start.Add(e.elapsed))
+
+		req, _ := http.NewRequest("GET", "/checkout", nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		rr := httptest.NewRecorder()
+		session.Put(ctx, "reservation", reservation)
+
+		handler := http.HandlerFunc(Repo.Checkout)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode || rr.Header().Get("Location") != e.expectedLocation {
+			t.Errorf("For %s, expected %d %s but got %d %s", e.name, e.expectedCode, e.expectedLocation, rr.Code, rr.Header().Get("Location"))
+		}
+
+		// The guest has to book again once the hold has expired
+		if e.expectedLocation != "" && session.Exists(ctx, "reservation") {
+			t.Errorf("For %s, expected the reservation to be removed from the session", e.name)
+		}
+	}
+}
+
+func TestRepository_ExpireHolds(t *testing.T) {
+	defer testClock.Set(time.Now())
+
+	var tests = []struct {
+		name     string
+		now      time.Time
+		expected int
+	}{
+		{"held", dbrepo.TestHoldExpiry.Add(-time.Minute), 0},
+		{"within the grace period", dbrepo.TestHoldExpiry.Add(holdGrace - time.Minute), 0},
+		{"expired", dbrepo.TestHoldExpiry.Add(holdGrace + time.Minute), 1},
+	}
+
+	for _, e := range tests {
+		testClock.Set(e.now)
+
+		if released := Repo.ExpireHolds(); released != e.expected {
+			t.Errorf("For %s, expected %d reservations to be released but got %d", e.name, e.expected, released)
+		}
+	}
+}
@@ -1,22 +1,32 @@
 package handlers
 
 import (
-	"encoding/json"
+	"crypto/rand"
+	"database/sql"
 	"errors"
-	"log"
+	"fmt"
+	"html"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/wagnojunior/booking/internal/cancellation"
 	"github.com/wagnojunior/booking/internal/config"
 	"github.com/wagnojunior/booking/internal/driver"
 	"github.com/wagnojunior/booking/internal/forms"
 	"github.com/wagnojunior/booking/internal/helpers"
+	"github.com/wagnojunior/booking/internal/i18n"
 	"github.com/wagnojunior/booking/internal/models"
+	"github.com/wagnojunior/booking/internal/pricing"
+	"github.com/wagnojunior/booking/internal/property"
+	"github.com/wagnojunior/booking/internal/ratelimit"
 	"github.com/wagnojunior/booking/internal/render"
 	"github.com/wagnojunior/booking/internal/repository"
 	"github.com/wagnojunior/booking/internal/repository/dbrepo"
+	"github.com/wagnojunior/booking/internal/stayrules"
 )
 
 // Repo the repository used by the handlers
@@ -24,15 +34,26 @@ var Repo *Repository
 
 // Repository
 type Repository struct {
-	App *config.AppConfig
-	DB  repository.DatabaseRepo
+	App        *config.AppConfig
+	DB         repository.DatabaseRepo
+	APILimiter *ratelimit.Limiter // Counts the requests of every API key against its rate limit
 }
 
 // NewRepo creates a new repository
 func NewRepo(a *config.AppConfig, db *driver.DB) *Repository {
 	return &Repository{
-		App: a,
-		DB:  dbrepo.NewPostgresRepo(db.SQL, a),
+		App:        a,
+		DB:         dbrepo.NewPostgresRepo(db.SQL, a),
+		APILimiter: ratelimit.New(ratelimit.Limit{}),
+	}
+}
+
+// NewTestRepo creates a new repository for testing
+func NewTestRepo(a *config.AppConfig) *Repository {
+	return &Repository{
+		App:        a,
+		DB:         dbrepo.NewTestingPostgresRepo(a),
+		APILimiter: ratelimit.New(ratelimit.Limit{}),
 	}
 }
 
@@ -44,14 +65,18 @@ func NewHandlers(r *Repository) {
 // Home is the handler for the home page
 func (m *Repository) Home(w http.ResponseWriter, r *http.Request) {
 	// Render the template
-	render.Template(w, r, "home.page.tmpl", &models.TemplateData{})
+	if err := render.Template(w, r, "home.page.tmpl", &models.TemplateData{}); err != nil {
+		helpers.ServerError(w, err)
+	}
 }
 
 // About is the handler for the about page
 func (m *Repository) About(w http.ResponseWriter, r *http.Request) {
 
 	// Render the template
-	render.Template(w, r, "about.page.tmpl", &models.TemplateData{})
+	if err := render.Template(w, r, "about.page.tmpl", &models.TemplateData{}); err != nil {
+		helpers.ServerError(w, err)
+	}
 }
 
 // MakeReservation is the handler for the make reservation page
@@ -73,9 +98,46 @@ func (m *Repository) MakeReservation(w http.ResponseWriter, r *http.Request) {
 	// Add the room name to the reservation model
 	res.Room.RoomName = room.RoomName
 
+	// The form of a guest with an account starts with the details of the account
+	if res.FirstName == "" && helpers.IsAuthenticated(r) {
+		user, err := m.DB.GetUserByID(m.App.Session.GetInt(r.Context(), "user_id"))
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		res.FirstName = user.FirstName
+		res.LastName = user.LastName
+		res.Email = user.Email
+	}
+
+	// The guest can change the number of guests in the form
+	if res.Guests < 1 {
+		res.Guests = 1
+	}
+
+	// Price the stay with the current rates of the room
+	res.Price, err = m.priceReservation(res, room, nil)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// The guest sees the cancellation policy before booking
+	res, err = m.withCancellationPolicy(res)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
 	// Add the reservation model <res> to the session
 	m.App.Session.Put(r.Context(), "reservation", res)
 
+	m.renderMakeReservation(w, r, res, forms.New(nil)) // Pass an empty form to the make-reservation template
+}
+
+// renderMakeReservation renders the make reservation page for the reservation <res> and the form <form>
+func (m *Repository) renderMakeReservation(w http.ResponseWriter, r *http.Request, res models.Reservation, form *forms.Form) {
 	// Format the date to string
 	sd := res.StartDate.Format("2006-01-02")
 	ed := res.EndDate.Format("2006-01-02")
@@ -87,13 +149,19 @@ func (m *Repository) MakeReservation(w http.ResponseWriter, r *http.Request) {
 	data := make(map[string]interface{})
 	data["reservation"] = res
 
-	render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
-		Form:      forms.New(nil), // Pass an empty form to the make-reservation template
-		Data:      data,           // Pass the empty reservation model to the make-reservation template
+	if err := render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
+		Form:      form,
+		Data:      data,
 		StringMap: stringMap,
-	})
+		JSON:      toAPIReservation(res),
+	}); err != nil {
+		helpers.ServerError(w, err)
+	}
 }
 
+// honeypotField is the name of the hidden field of the reservation form that only bots fill in
+const honeypotField = "website"
+
 // PostMakeReservation handles the posting of a reservation form
 func (m *Repository) PostMakeReservation(w http.ResponseWriter, r *http.Request) {
 	reservation, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
@@ -109,98 +177,217 @@ func (m *Repository) PostMakeReservation(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	reservation.FirstName = r.Form.Get("first_name")
-	reservation.LastName = r.Form.Get("last_name")
-	reservation.Phone = r.Form.Get("phone")
-	reservation.Email = r.Form.Get("email")
+	// Only bots fill in the honeypot field, which people do not see. They are sent away without being told why
+	if r.Form.Get(honeypotField) != "" {
+		m.App.InfoLog.Println("Reservation refused: honeypot filled in by", r.RemoteAddr)
+		m.App.Session.Remove(r.Context(), "reservation")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
 
-	// Creates a form object
+	// Creates a form object, and binds the posted details of the guest to the reservation
 	form := forms.New(r.PostForm)
 
-	// Server-side form validation
-	// form.Has("first_name", r)
-	form.Required("first_name", "last_name", "email")
-	form.MinLength("first_name", 3)
-	form.IsEmail("email")
+	var details reservationForm
+	if err := form.Bind(&details); err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
 
-	// Check if the form is NOT valid and send back the form data to the make-reservation template
-	if !form.Valid() {
-		// data has the same format as Data in templatedata.go
-		data := make(map[string]interface{})
-		data["reservation"] = reservation
+	reservation.FirstName = details.FirstName
+	reservation.LastName = details.LastName
+	reservation.Phone = details.Phone
+	reservation.Email = details.Email
+	reservation.UserID = m.App.Session.GetInt(r.Context(), "user_id") // Shown with the bookings of the guest
+	promoCode := strings.TrimSpace(details.PromoCode)
+
+	// The number of guests is needed to charge the per guest taxes and fees
+	reservation.Guests = details.Guests
+	if reservation.Guests < 1 {
+		reservation.Guests = 1
+	}
 
-		// Render the template again, but now sending the data from the form to be repopulated
-		render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
-			Form: form,
-			Data: data,
-		})
+	// The stay rules may have changed, or the booking horizon may have passed, since the search
+	violations, err := m.checkStayRules(reservation, i18n.FromContext(r.Context()))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
 
+	if len(violations) > 0 {
+		m.App.Session.Put(r.Context(), "error", strings.Join(violations, ". "))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
 		return
 	}
 
-	// Save to database
-	newReservationID, err := m.DB.InsertReservation(reservation)
+	// Price the stay again at booking time, so the stored price reflects the rates the guest booked with
+	room, err := m.DB.GetRoomByID(reservation.RoomID)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	// Creates a restriction with the newly created reservation (ID)
-	restriction := models.RoomRestriction{
-		StartDate:     reservation.StartDate,
-		EndDate:       reservation.EndDate,
-		RoomID:        reservation.RoomID,
-		ReservationID: newReservationID,
-		RestrictionID: 1,
+	reservation.Price, err = m.priceReservation(reservation, room, nil)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
 	}
+	reservation.PromoCodeID = 0
 
-	// Insert restriction to database
-	err = m.DB.InsertRoomRestriction(restriction)
+	// The cancellation policy is stored with the reservation, as the guest agreed to it
+	reservation, err = m.withCancellationPolicy(reservation)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
+	// The promo code is optional, but when given it must exist and apply to this stay
+	if promoCode != "" {
+		var msg string
+		reservation, msg, err = m.applyPromoCode(reservation, room, promoCode)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		if msg != "" {
+			form.Errors.Add("promo_code", msg)
+		}
+	}
+
+	// Check if the form is NOT valid and send back the form data to the make-reservation template
+	if !form.Valid() {
+		// Render the template again, but now sending the data from the form to be repopulated
+		m.renderMakeReservation(w, r, reservation, form)
+		return
+	}
+
+	// Save to database. The reservation is pending until it is paid, but the room is held for the guest meanwhile
+	reservation.Status = models.ReservationPending
+	reservation.ExpiresAt = m.App.Clock.Now().Add(holdDuration)
+	reservation, err = m.bookReservation(reservation, room)
+	if err == errPromoCodeUsedUp {
+		form.Errors.Add("promo_code", "form.promo_code_used_up")
+		m.renderMakeReservation(w, r, reservation, form)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
 	// Stores the variable reservation in the session
 	m.App.Session.Put(r.Context(), "reservation", reservation)
 
-	// Redirects to the reservation.summmary page
-	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+	// Redirects to the checkout page
+	http.Redirect(w, r, "/checkout", http.StatusSeeOther)
 }
 
 // PandaSuite is the handler for the Panda Suite  page
 func (m *Repository) PandaSuite(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "panda-suite.page.tmpl", &models.TemplateData{})
+	if err := render.Template(w, r, "panda-suite.page.tmpl", &models.TemplateData{}); err != nil {
+		helpers.ServerError(w, err)
+	}
 }
 
 // BambooDorm is the handler for the Bamboo Dorm page
 func (m *Repository) BambooDorm(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "bamboo-dorm.page.tmpl", &models.TemplateData{})
+	if err := render.Template(w, r, "bamboo-dorm.page.tmpl", &models.TemplateData{}); err != nil {
+		helpers.ServerError(w, err)
+	}
 }
 
 // SearchAvailability is the handler for the Book Now page
 func (m *Repository) SearchAvailability(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "search-availability.page.tmpl", &models.TemplateData{})
+	m.renderSearchAvailability(w, r, forms.New(nil))
+}
+
+// searchPage is the JSON body of the Book Now page: the dates of the form, sent back with its errors
+type searchPage struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// roomsPage is the JSON body of the page that lists the rooms that can be booked for a stay
+type roomsPage struct {
+	StartDate   string               `json:"start_date"`
+	EndDate     string               `json:"end_date"`
+	Rooms       []apiAvailableRoom   `json:"rooms"`
+	Unavailable []apiUnavailableRoom `json:"unavailable"`
+}
+
+// renderSearchAvailability renders the Book Now page with the form <form>
+func (m *Repository) renderSearchAvailability(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	if err := render.Template(w, r, "search-availability.page.tmpl", &models.TemplateData{
+		Form: form,
+		JSON: searchPage{Start: form.Get("start"), End: form.Get("end")},
+	}); err != nil {
+		helpers.ServerError(w, err)
+	}
+}
+
+// stayDateLayout is the layout of the dates of the search form and of the links to book a room. Dates in ISO 8601
+// are accepted too
+const stayDateLayout = "2006/01/02"
+
+// maxSearchNights is the longest stay that can be searched for
+const maxSearchNights = 30
+
+// validateStayDates checks the arrival date <start> and the departure date <end> of <form>, with the layout <layout>,
+// and returns them in the time zone of the property. The arrival cannot be in the past, and the departure must be
+// after it, at most maxSearchNights later. The dates are zero when they are not valid
+func (m *Repository) validateStayDates(form *forms.Form, start, end, layout string) (time.Time, time.Time) {
+	form.Location = m.App.Property.TimeZone
+
+	// The empty dates only have the error of Required
+	form.Required(start, end)
+	if strings.TrimSpace(form.Get(start)) != "" {
+		form.NotInPast(start, layout, m.App.Clock.Now())
+	}
+	if strings.TrimSpace(form.Get(end)) != "" && form.DateAfter(end, start, layout) {
+		form.MaxRange(start, end, layout, maxSearchNights)
+	}
+
+	startDate, _ := forms.ParseDate(form.Get(start), layout, form.Location)
+	endDate, _ := forms.ParseDate(form.Get(end), layout, form.Location)
+
+	return startDate, endDate
 }
 
 // PostSearchAvailability is the handler for the Book Now page
 func (m *Repository) PostSearchAvailability(w http.ResponseWriter, r *http.Request) {
-	start := r.Form.Get("start") // The argument <start> matches the input name in the form in <search-availability.page.tmpl>
-	end := r.Form.Get("end")     // The argument <end> matches the input name in the form in <search-availability.page.tmpl>
-
-	// Parse dates from string to time format
-	layout := "2006/01/02"
-	startDate, err := time.Parse(layout, start)
+	// Parse the form and check for errors
+	err := r.ParseForm()
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
-	endDate, err := time.Parse(layout, end)
+
+	// The fields <start> and <end> match the input names in the form in <search-availability.page.tmpl>
+	form := forms.New(r.PostForm)
+	startDate, endDate := m.validateStayDates(form, "start", "end", stayDateLayout)
+	if !form.Valid() {
+		m.renderSearchAvailability(w, r, form)
+		return
+	}
+
+	res := models.Reservation{
+		StartDate: startDate,
+		EndDate:   endDate,
+	}
+
+	// Check the stay rules that apply to every room and explain to the user why the stay is not allowed
+	violations, err := m.checkStayRules(res, i18n.FromContext(r.Context()))
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
+	if len(violations) > 0 {
+		m.App.Session.Put(r.Context(), "error", strings.Join(violations, ". "))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
 	rooms, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate)
 	if err != nil {
 		helpers.ServerError(w, err)
@@ -213,21 +400,70 @@ func (m *Repository) PostSearchAvailability(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	data := make(map[string]interface{})
-	data["rooms"] = rooms
+	page := roomsPage{
+		StartDate:   startDate.Format(apiDateLayout),
+		EndDate:     endDate.Format(apiDateLayout),
+		Rooms:       []apiAvailableRoom{},
+		Unavailable: []apiUnavailableRoom{},
+	}
 
-	// Add a Reservation Model to the session
-	res := models.Reservation{
-		StartDate: startDate,
-		EndDate:   endDate,
+	// Keep only the rooms whose own stay rules allow the stay, and keep the reason why the others do not
+	var bookableRooms []models.Room
+	var reasons []string
+	unavailable := make(map[string]string)
+	for _, room := range rooms {
+		res.RoomID = room.ID
+
+		violations, err := m.checkStayRules(res, i18n.FromContext(r.Context()))
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		if len(violations) > 0 {
+			unavailable[room.RoomName] = strings.Join(violations, ". ")
+			reasons = append(reasons, fmt.Sprintf("%s: %s", room.RoomName, unavailable[room.RoomName]))
+			page.Unavailable = append(page.Unavailable, apiUnavailableRoom{Room: toAPIRoom(room), Reasons: violations})
+			continue
+		}
+
+		bookableRooms = append(bookableRooms, room)
+	}
+	res.RoomID = 0
+
+	if len(bookableRooms) == 0 {
+		m.App.Session.Put(r.Context(), "error", strings.Join(reasons, ". "))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	// Price the stay in every bookable room
+	quotes := make(map[int]models.PriceQuote)
+	for _, room := range bookableRooms {
+		quotes[room.ID], err = m.priceReservation(res, room, nil)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		page.Rooms = append(page.Rooms, apiAvailableRoom{Room: toAPIRoom(room), Price: toAPIPrice(quotes[room.ID])})
 	}
 
+	data := make(map[string]interface{})
+	data["rooms"] = bookableRooms
+	data["quotes"] = quotes
+	data["unavailable"] = unavailable
+
+	// Add a Reservation Model to the session
 	m.App.Session.Put(r.Context(), "reservation", res)
 
 	// Renders the template reservation-summary and passes the session information to it
-	render.Template(w, r, "choose-room.page.tmpl", &models.TemplateData{
+	if err := render.Template(w, r, "choose-room.page.tmpl", &models.TemplateData{
 		Data: data,
-	})
+		JSON: page,
+	}); err != nil {
+		helpers.ServerError(w, err)
+	}
 }
 
 // Defines a type to represent a json format
@@ -245,40 +481,96 @@ func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 	// Get the fields BY NAME from the form
 	sd := r.Form.Get("start")
 	ed := r.Form.Get("end")
+	roomID, _ := strconv.Atoi(r.Form.Get("room_id"))
 
-	// Convert sd and ed from string to date
-	layout := "2006/01/02"
-	startDate, _ := time.Parse(layout, sd)
-	endDate, _ := time.Parse(layout, ed)
+	// Invalid dates are answered like a stay that is not available, with the reasons
+	form := forms.New(r.Form)
+	startDate, endDate := m.validateStayDates(form, "start", "end", stayDateLayout)
+	if !form.Valid() {
+		var reasons []string
+		for _, field := range []string{"start", "end"} {
+			if msg := form.Errors.In(i18n.FromContext(r.Context()), field); msg != "" {
+				reasons = append(reasons, msg)
+			}
+		}
+
+		if err := render.JSON(w, http.StatusOK, jsonResponse{
+			Message:   strings.Join(reasons, ". "),
+			StartDate: sd,
+			EndDate:   ed,
+			RoomID:    strconv.Itoa(roomID),
+		}); err != nil {
+			helpers.ServerError(w, err)
+		}
+		return
+	}
 
-	log.Println(startDate, endDate)
+	available, _ := m.DB.SearchAvailabilityByDatesByRoomID(startDate, endDate, roomID)
 
-	roomID, _ := strconv.Atoi(r.Form.Get("room_id"))
+	// A free room is still not available if its stay rules do not allow the stay
+	violations, err := m.checkStayRules(models.Reservation{
+		StartDate: startDate,
+		EndDate:   endDate,
+		RoomID:    roomID,
+	}, i18n.FromContext(r.Context()))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
 
-	available, _ := m.DB.SearchAvailabilityByDatesByRoomID(startDate, endDate, roomID)
 	// Creates and populates a variable <resp> of type <jsonResponse>
 	resp := jsonResponse{
-		OK:        available,
-		Message:   "",
+		OK:        available && len(violations) == 0,
+		Message:   strings.Join(violations, ". "),
 		StartDate: sd,
 		EndDate:   ed,
 		RoomID:    strconv.Itoa(roomID),
 	}
 
 	// Formats to json format based on the json tags defined within the ``
-	out, err := json.MarshalIndent(resp, "", "     ")
-	if err != nil {
+	if err := render.JSON(w, http.StatusOK, resp); err != nil {
 		helpers.ServerError(w, err)
-		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(out)
 }
 
 // Contact is the handler for the Contact page
 func (m *Repository) Contact(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "contact.page.tmpl", &models.TemplateData{})
+	if err := render.Template(w, r, "contact.page.tmpl", &models.TemplateData{}); err != nil {
+		helpers.ServerError(w, err)
+	}
+}
+
+// ChangeLanguage stores the locale chosen with the language menu in a cookie, and takes the visitor back to the page
+// they came from
+func (m *Repository) ChangeLanguage(w http.ResponseWriter, r *http.Request) {
+	locale := chi.URLParam(r, "locale")
+	if !i18n.Supported(locale) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     i18n.CookieName,
+		Value:    locale,
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		HttpOnly: true,
+		Secure:   m.App.HTTPS,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, sameSiteReferer(r), http.StatusSeeOther)
+}
+
+// sameSiteReferer returns the path of the page that linked to the request <r>, when it is a page of this site,
+// or else the home page
+func sameSiteReferer(r *http.Request) string {
+	referer, err := url.Parse(r.Referer())
+	if err != nil || referer.Path == "" || !strings.HasPrefix(referer.Path, "/") || (referer.Host != "" && referer.Host != r.Host) {
+		return "/"
+	}
+
+	return referer.RequestURI()
 }
 
 // Contact is the handler for the Contact page
@@ -297,21 +589,21 @@ func (m *Repository) ReservationSummary(w http.ResponseWriter, r *http.Request)
 	// After the value is retrieved from the session, it is recommended to remove it
 	m.App.Session.Remove(r.Context(), "reservation")
 
+	// Only the ID is kept, so the guest can still download the invoice
+	m.App.Session.Put(r.Context(), "reservation_id", reservation.ID)
+
 	// If ok is true, then store reservation in a format that matches the templatedata.Data
 	data := make(map[string]interface{})
 	data["reservation"] = reservation
 
-	sd := reservation.StartDate.Format("2006-01-02")
-	ed := reservation.EndDate.Format("2006-01-02")
-	stringMap := make(map[string]string)
-	stringMap["start_date"] = sd
-	stringMap["end_date"] = ed
-
-	// Renders the template reservation-summary and passes the session information to it
-	render.Template(w, r, "reservation-summary.page.tmpl", &models.TemplateData{
-		Data:      data,
-		StringMap: stringMap,
-	})
+	// Renders the template reservation-summary and passes the session information to it. The dates are formatted
+	// in the locale of the guest by the template
+	if err := render.Template(w, r, "reservation-summary.page.tmpl", &models.TemplateData{
+		Data: data,
+		JSON: toAPIReservation(reservation),
+	}); err != nil {
+		helpers.ServerError(w, err)
+	}
 }
 
 // ChooseRoom displays list of available rooms
@@ -340,13 +632,17 @@ func (m *Repository) ChooseRoom(w http.ResponseWriter, r *http.Request) {
 func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 	// We have to grab the values from the URL (id, s, e)
 	roomID, _ := strconv.Atoi(r.URL.Query().Get("id")) // Get the ID from the Request and convert it to str
-	sd := r.URL.Query().Get("s")
-	ed := r.URL.Query().Get("e")
 
-	// Convert sd and ed from string to date
-	layout := "2006/01/02"
-	startDate, _ := time.Parse(layout, sd)
-	endDate, _ := time.Parse(layout, ed)
+	// Invalid dates are shown in the search form, to be chosen again
+	form := forms.New(url.Values{
+		"start": {r.URL.Query().Get("s")},
+		"end":   {r.URL.Query().Get("e")},
+	})
+	startDate, endDate := m.validateStayDates(form, "start", "end", stayDateLayout)
+	if !form.Valid() {
+		m.renderSearchAvailability(w, r, form)
+		return
+	}
 
 	// Create a variable of type <Reservation>
 	var res models.Reservation
@@ -364,9 +660,291 @@ func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 	res.StartDate = startDate
 	res.EndDate = endDate
 
+	// Check the stay rules of the room and explain to the user why the stay is not allowed
+	violations, err := m.checkStayRules(res, i18n.FromContext(r.Context()))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if len(violations) > 0 {
+		m.App.Session.Put(r.Context(), "error", strings.Join(violations, ". "))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
 	// Put <res> into the session
 	m.App.Session.Put(r.Context(), "reservation", res)
 
 	// Redirect
 	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
 }
+
+// priceReservation computes the price breakdown of the reservation <res> in the room <room>, with the taxes and fees.
+// The discount of <promo> is applied before the taxes and fees, unless <promo> is nil
+func (m *Repository) priceReservation(res models.Reservation, room models.Room, promo *models.PromoCode) (models.PriceQuote, error) {
+	rates, err := m.DB.GetRatesByRoomID(room.ID, res.StartDate, res.EndDate)
+	if err != nil {
+		return models.PriceQuote{}, err
+	}
+
+	feeRules, err := m.DB.GetFeeRulesByRoomID(room.ID)
+	if err != nil {
+		return models.PriceQuote{}, err
+	}
+
+	quote := pricing.Quote(res, room, rates, m.App.Currency)
+	if promo != nil {
+		quote = pricing.ApplyPromoCode(quote, *promo)
+	}
+
+	return pricing.ApplyFees(quote, feeRules, res.Guests), nil
+}
+
+// withCancellationPolicy sets the cancellation policy that applies to the priced reservation <res>, and its summary
+func (m *Repository) withCancellationPolicy(res models.Reservation) (models.Reservation, error) {
+	policies, err := m.DB.GetCancellationPoliciesByRoomID(res.RoomID)
+	if err != nil {
+		return res, err
+	}
+
+	res.CancellationPolicy = cancellation.Select(policies, res)
+	res.CancellationSummary = cancellation.Summary(res.CancellationPolicy, res.StartDate)
+
+	return res, nil
+}
+
+// guestDetails are the details of the guest of a reservation. The reservation form and the API share their rules
+type guestDetails struct {
+	FirstName string `form:"first_name" validate:"required,min=3,max=100"`
+	LastName  string `form:"last_name" validate:"required,max=100"`
+	Email     string `form:"email" validate:"required,email"`
+	Phone     string `form:"phone" validate:"max=30"`
+}
+
+// reservationForm is the form of make-reservation.page.tmpl
+type reservationForm struct {
+	guestDetails
+	Guests    int    `form:"guests" validate:"required,min=1,max=20"`
+	PromoCode string `form:"promo_code" validate:"max=50"`
+}
+
+// validateGuestDetails checks the guest details of a reservation in <form>
+func validateGuestDetails(form *forms.Form) error {
+	var details guestDetails
+	return form.Bind(&details)
+}
+
+// applyPromoCode prices the reservation <res> in the room <room> with the discount of the promo code <code>.
+// The returned message explains why the promo code cannot be applied, in which case <res> is returned unchanged
+func (m *Repository) applyPromoCode(res models.Reservation, room models.Room, code string) (models.Reservation, string, error) {
+	promo, err := m.DB.GetPromoCodeByCode(code)
+	if err == sql.ErrNoRows {
+		return res, "form.promo_code_invalid", nil
+	} else if err != nil {
+		return res, "", err
+	}
+
+	if msg := pricing.CheckPromoCode(promo, res, m.App.Clock.Now()); msg != "" {
+		return res, msg, nil
+	}
+
+	res.Price, err = m.priceReservation(res, room, &promo)
+	if err != nil {
+		return res, "", err
+	}
+	res.PromoCodeID = promo.ID
+
+	return res, "", nil
+}
+
+// errPromoCodeUsedUp means that the promo code of a reservation reached its usage limit after it was applied
+var errPromoCodeUsedUp = errors.New("promo code has reached its usage limit")
+
+// bookReservation saves the priced reservation <res> in the room <room> with a new confirmation code and holds the room for it.
+// The use of its promo code is counted with it. When the promo code is used up, nothing is saved, <res> is priced
+// again without it and errPromoCodeUsedUp is returned
+func (m *Repository) bookReservation(res models.Reservation, room models.Room) (models.Reservation, error) {
+	code, err := newReservationCode()
+	if err != nil {
+		return res, err
+	}
+	res.Code = code
+
+	newReservationID, err := m.DB.InsertReservation(res)
+	if err == repository.ErrPromoCodeUsedUp {
+		res.Price, err = m.priceReservation(res, room, nil)
+		if err != nil {
+			return res, err
+		}
+		res.PromoCodeID = 0
+		res.Code = ""
+
+		return res, errPromoCodeUsedUp
+	} else if err != nil {
+		return res, err
+	}
+
+	res.ID = newReservationID
+	res.Room.RoomName = room.RoomName
+
+	m.queueWebhook(models.EventReservationCreated, toAPIReservation(res))
+
+	return res, nil
+}
+
+// reservationCodeAlphabet leaves out the characters that are easily mistaken for one another, such as 0 and O
+const reservationCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// newReservationCode returns a random confirmation code of 8 characters
+func newReservationCode() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	for i := range b {
+		b[i] = reservationCodeAlphabet[int(b[i])%len(reservationCodeAlphabet)]
+	}
+
+	return string(b), nil
+}
+
+// checkStayRules returns the explanations, in <locale>, of the stay rules that the reservation <res> breaks, and of the
+// same-day cutoff of the property. When res.RoomID is 0, only the rules that apply to every room are checked
+func (m *Repository) checkStayRules(res models.Reservation, locale string) ([]string, error) {
+	rules, err := m.DB.GetStayRulesByRoomID(res.RoomID, res.StartDate)
+	if err != nil {
+		return nil, err
+	}
+
+	// The day, and the same-day cutoff, are the ones of the property, whatever the time zone of the server
+	now := m.App.Clock.Now()
+	violations := stayrules.Check(res, rules, m.App.Property.Today(now))
+
+	if m.App.Property.SameDayClosed(res.StartDate, now) {
+		violations = append(violations, stayrules.Violation{Key: "stay.same_day_cutoff", Args: []interface{}{m.App.Property.SameDayCutoff}})
+	}
+
+	return stayrules.Messages(locale, violations), nil
+}
+
+// ShowLogin shows the login page
+func (m *Repository) ShowLogin(w http.ResponseWriter, r *http.Request) {
+	if err := render.Template(w, r, "login.page.tmpl", &models.TemplateData{
+		Form: forms.New(nil),
+	}); err != nil {
+		helpers.ServerError(w, err)
+	}
+}
+
+// PostShowLogin handles logging the user in
+func (m *Repository) PostShowLogin(w http.ResponseWriter, r *http.Request) {
+	// Prevents session fixation attacks
+	_ = m.App.Session.RenewToken(r.Context())
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	email := r.Form.Get("email")
+	password := r.Form.Get("password")
+
+	form := forms.New(r.PostForm)
+	form.Required("email", "password")
+	form.IsEmail("email")
+
+	if !form.Valid() {
+		if err := render.Template(w, r, "login.page.tmpl", &models.TemplateData{
+			Form: form,
+		}); err != nil {
+			helpers.ServerError(w, err)
+		}
+		return
+	}
+
+	id, _, err := m.DB.Authenticate(email, password)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid login credentials")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	user, err := m.DB.GetUserByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "user_id", user.ID)
+	m.App.Session.Put(r.Context(), "access_level", user.AccessLevel)
+	m.App.Session.Put(r.Context(), "flash", "Logged in successfully")
+
+	if user.AccessLevel == models.AccessAdmin {
+		http.Redirect(w, r, "/admin/promo-codes", http.StatusSeeOther)
+		return
+	}
+
+	// The reservations made with a verified email since the last login join the bookings of the guest
+	if !user.EmailVerifiedAt.IsZero() {
+		if _, err := m.DB.LinkReservationsByEmail(user.ID, user.Email); err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/account/bookings", http.StatusSeeOther)
+}
+
+// Logout logs the user out
+func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
+	_ = m.App.Session.Destroy(r.Context())
+	_ = m.App.Session.RenewToken(r.Context())
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// confirmationEmail returns the HTML content of the email that confirms the reservation <res> to the guest, with the
+// check-in and check-out times of the property <p>
+func confirmationEmail(res models.Reservation, p property.Settings) string {
+	var b strings.Builder
+	price := res.Price
+
+	fmt.Fprintf(&b, "<strong>Reservation Confirmation</strong><br>")
+	fmt.Fprintf(&b, "Dear %s,<br>", html.EscapeString(res.FirstName))
+	fmt.Fprintf(&b, "This is to confirm your reservation of the %s from %s to %s for %d guest(s).<br><br>",
+		html.EscapeString(res.Room.RoomName),
+		res.StartDate.Format("2006-01-02"),
+		res.EndDate.Format("2006-01-02"),
+		res.Guests,
+	)
+	fmt.Fprintf(&b, "Check-in is from %s on %s and check-out is until %s on %s, %s time.<br>",
+		p.CheckIn,
+		res.StartDate.Format("2006-01-02"),
+		p.CheckOut,
+		res.EndDate.Format("2006-01-02"),
+		html.EscapeString(p.Location().String()),
+	)
+	fmt.Fprintf(&b, "Your confirmation code is <strong>%s</strong>.<br><br>", html.EscapeString(res.Code))
+
+	b.WriteString("<table>")
+	for _, night := range price.Nights {
+		fmt.Fprintf(&b, "<tr><td>%s (%s)</td><td align=\"right\">%s</td></tr>",
+			night.Date.Format("2006-01-02"), html.EscapeString(night.RateName), pricing.FormatAmount(night.Amount, price.Currency))
+	}
+	if price.Discount > 0 {
+		fmt.Fprintf(&b, "<tr><td>Discount (%s)</td><td align=\"right\">-%s</td></tr>",
+			html.EscapeString(price.PromoCode), pricing.FormatAmount(price.Discount, price.Currency))
+	}
+	for _, line := range price.Lines {
+		fmt.Fprintf(&b, "<tr><td>%s</td><td align=\"right\">%s</td></tr>",
+			html.EscapeString(line.Name), pricing.FormatAmount(line.Amount, price.Currency))
+	}
+	fmt.Fprintf(&b, "<tr><th>Total</th><th align=\"right\">%s</th></tr>", pricing.FormatAmount(price.Total, price.Currency))
+	b.WriteString("</table><br>")
+	fmt.Fprintf(&b, "Cancellation policy: %s<br>", html.EscapeString(res.CancellationSummary))
+
+	return b.String()
+}
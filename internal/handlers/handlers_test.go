@@ -1,10 +1,25 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wagnojunior/booking/internal/forms"
+	"github.com/wagnojunior/booking/internal/i18n"
+	"github.com/wagnojunior/booking/internal/models"
+	"github.com/wagnojunior/booking/internal/payments"
+	"github.com/wagnojunior/booking/internal/property"
 )
 
 type postData struct {
@@ -25,21 +40,75 @@ var theTest = []struct {
 	{"bamboo-dorm", "/bamboo-dorm", "GET", []postData{}, http.StatusOK},                 // first entry of the test
 	{"search-availability", "/search-availability", "GET", []postData{}, http.StatusOK}, // first entry of the test
 	{"contact", "/contact", "GET", []postData{}, http.StatusOK},                         // first entry of the test
-	{"make-reservation", "/make-reservation", "GET", []postData{}, http.StatusOK},       // first entry of the test
+	{"language", "/language/pt", "GET", []postData{}, http.StatusOK},
+	{"unsupported-language", "/language/xx", "GET", []postData{}, http.StatusNotFound},
 	{"post-search-availability", "/search-availability", "POST", []postData{
-		{key: "start", value: "2022-01-01"},
-		{key: "end", value: "2022-01-02"},
+		{key: "start", value: "2022/01/01"},
+		{key: "end", value: "2022/01/02"},
 	}, http.StatusOK},
 	{"post-search-availability-json", "/search-availability-json", "POST", []postData{
 		{key: "start", value: "2022-01-01"},
 		{key: "end", value: "2022-01-02"},
 	}, http.StatusOK},
-	{"make-reservation", "/make-reservation", "POST", []postData{
-		{key: "first_name", value: "John"},
-		{key: "last_name", value: "Smith"},
-		{key: "email", value: "me@here.com"},
-		{key: "phone", value: "555-555-5555"},
+	{"login", "/user/login", "GET", []postData{}, http.StatusOK},
+	{"logout", "/user/logout", "GET", []postData{}, http.StatusOK},
+	{"register", "/user/register", "GET", []postData{}, http.StatusOK},
+	{"admin-promo-codes", "/admin/promo-codes", "GET", []postData{}, http.StatusOK},
+	{"admin-new-promo-code", "/admin/promo-codes/0", "GET", []postData{}, http.StatusOK},
+	{"admin-show-promo-code", "/admin/promo-codes/1", "GET", []postData{}, http.StatusOK},
+	{"admin-rooms", "/admin/rooms", "GET", []postData{}, http.StatusOK},
+	{"room-calendar", "/ical/1/token1.ics", "GET", []postData{}, http.StatusOK},
+	{"room-calendar-wrong-token", "/ical/1/token2.ics", "GET", []postData{}, http.StatusNotFound},
+	{"room-calendar-invalid-room", "/ical/x/token1.ics", "GET", []postData{}, http.StatusNotFound},
+	{"admin-reservations", "/admin/reservations", "GET", []postData{}, http.StatusOK},
+	{"admin-show-reservation", "/admin/reservations/1", "GET", []postData{}, http.StatusOK},
+	{"admin-show-cancelled-reservation", "/admin/reservations/2", "GET", []postData{}, http.StatusOK},
+	{"admin-show-unknown-reservation", "/admin/reservations/4", "GET", []postData{}, http.StatusNotFound},
+	{"admin-reservation-invoice", "/admin/reservations/1/invoice", "GET", []postData{}, http.StatusOK},
+	{"admin-new-reservation-invoice", "/admin/reservations/2/invoice", "GET", []postData{}, http.StatusOK},
+	{"admin-unknown-reservation-invoice", "/admin/reservations/4/invoice", "GET", []postData{}, http.StatusNotFound},
+	{"admin-api-keys", "/admin/api-keys", "GET", []postData{}, http.StatusOK},
+	{"admin-show-api-key", "/admin/api-keys/1", "GET", []postData{}, http.StatusOK},
+	{"admin-show-unknown-api-key", "/admin/api-keys/9", "GET", []postData{}, http.StatusNotFound},
+	{"admin-webhooks", "/admin/webhooks", "GET", []postData{}, http.StatusOK},
+	{"admin-show-webhook", "/admin/webhooks/1", "GET", []postData{}, http.StatusOK},
+	{"admin-show-unknown-webhook", "/admin/webhooks/9", "GET", []postData{}, http.StatusNotFound},
+	{"post-login", "/user/login", "POST", []postData{
+		{key: "email", value: "me@here.ca"},
+		{key: "password", value: "password"},
+	}, http.StatusOK},
+	{"post-login-invalid-email", "/user/login", "POST", []postData{
+		{key: "email", value: "me"},
+		{key: "password", value: "password"},
+	}, http.StatusOK},
+	{"admin-post-promo-code", "/admin/promo-codes/0", "POST", []postData{
+		{key: "code", value: "summer"},
+		{key: "discount_type", value: "fixed"},
+		{key: "amount", value: "10.50"},
+		{key: "valid_from", value: "2022-06-01"},
+		{key: "valid_until", value: "2022-08-31"},
+	}, http.StatusOK},
+	{"admin-post-invalid-promo-code", "/admin/promo-codes/1", "POST", []postData{
+		{key: "code", value: "spring10"},
+		{key: "discount_type", value: "percent"},
+		{key: "amount", value: "120"},
+		{key: "valid_from", value: "2022-06-01"},
+		{key: "valid_until", value: "2022-05-31"},
+	}, http.StatusOK},
+	{"admin-delete-promo-code", "/admin/promo-codes/1/delete", "POST", []postData{}, http.StatusOK},
+	{"admin-delete-ical-import", "/admin/ical-imports/1/delete", "POST", []postData{}, http.StatusOK},
+	{"admin-post-invalid-api-key", "/admin/api-keys", "POST", []postData{
+		{key: "name", value: "Travel agent"},
+		{key: "scopes", value: "everything"},
+		{key: "rate_limit", value: "-1"},
+		{key: "expires_at", value: "2022-01-01"},
+	}, http.StatusOK},
+	{"admin-delete-api-key", "/admin/api-keys/1/delete", "POST", []postData{}, http.StatusOK},
+	{"admin-post-invalid-webhook", "/admin/webhooks", "POST", []postData{
+		{key: "url", value: "ftp://example.com"},
+		{key: "events", value: "room.deleted"},
 	}, http.StatusOK},
+	{"admin-delete-webhook", "/admin/webhooks/1/delete", "POST", []postData{}, http.StatusOK},
 }
 
 func TestHandler(t *testing.T) {
@@ -81,3 +150,774 @@ func TestHandler(t *testing.T) {
 		}
 	}
 }
+
+func TestRepository_MakeReservation(t *testing.T) {
+	reservation := models.Reservation{
+		RoomID:    1,
+		StartDate: nextWeekday(time.Thursday),
+		EndDate:   nextWeekday(time.Thursday).AddDate(0, 0, 3),
+	}
+
+	req, _ := http.NewRequest("GET", "/make-reservation", nil)
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	rr := httptest.NewRecorder()
+	session.Put(ctx, "reservation", reservation)
+
+	handler := http.HandlerFunc(Repo.MakeReservation)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("MakeReservation handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+
+	// Thursday at the base price, Friday and Saturday at the weekend rate, plus the cleaning fee and the tourist tax
+	res, _ := session.Get(ctx, "reservation").(models.Reservation)
+	if res.Price.Total != 42000+3000+600 {
+		t.Errorf("MakeReservation priced the stay at %d, wanted %d", res.Price.Total, 42000+3000+600)
+	}
+
+	// A Thursday arrival is at the base price, so the policy of every room applies
+	if res.CancellationPolicy.Name != "Moderate" || res.CancellationSummary == "" {
+		t.Errorf("MakeReservation set the cancellation policy %q (%q), wanted Moderate", res.CancellationPolicy.Name, res.CancellationSummary)
+	}
+
+	// test case where reservation is not in session
+	req, _ = http.NewRequest("GET", "/make-reservation", nil)
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+	rr = httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("MakeReservation handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusInternalServerError)
+	}
+
+	// test with non-existent room
+	req, _ = http.NewRequest("GET", "/make-reservation", nil)
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+	rr = httptest.NewRecorder()
+	reservation.RoomID = 100
+	session.Put(ctx, "reservation", reservation)
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("MakeReservation handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestRepository_PostMakeReservation(t *testing.T) {
+	reservation := models.Reservation{
+		RoomID:    1,
+		StartDate: nextWeekday(time.Thursday),
+		EndDate:   nextWeekday(time.Thursday).AddDate(0, 0, 1),
+	}
+
+	postedData := url.Values{}
+	postedData.Add("first_name", "John")
+	postedData.Add("last_name", "Smith")
+	postedData.Add("email", "john@smith.com")
+	postedData.Add("phone", "555-555-5555")
+	postedData.Add("guests", "2")
+
+	req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	session.Put(ctx, "reservation", reservation)
+
+	handler := http.HandlerFunc(Repo.PostMakeReservation)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("PostMakeReservation handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+
+	// The price is computed at booking time, even if the session carried none: the room, the cleaning fee and
+	// the tourist tax of both guests
+	res, _ := session.Get(ctx, "reservation").(models.Reservation)
+	if res.Price.Total != 12000+3000+400 {
+		t.Errorf("PostMakeReservation priced the stay at %d, wanted %d", res.Price.Total, 12000+3000+400)
+	}
+
+	// The room is held while the guest pays
+	if !res.ExpiresAt.Equal(testClock.Now().Add(holdDuration)) {
+		t.Errorf("PostMakeReservation held the room until %s, wanted %s", res.ExpiresAt, testClock.Now().Add(holdDuration))
+	}
+
+	// test for an invalid number of guests
+	postedData.Set("guests", "0")
+	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	session.Put(ctx, "reservation", reservation)
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("PostMakeReservation handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+	postedData.Set("guests", "2")
+
+	// test for failure to insert the reservation into the database
+	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	reservation.RoomID = 2
+	session.Put(ctx, "reservation", reservation)
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("PostMakeReservation handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusInternalServerError)
+	}
+
+	// test for a stay that breaks the stay rules of the room (closed to arrival on Sundays)
+	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	reservation.RoomID = 1
+	reservation.StartDate = nextWeekday(time.Sunday)
+	reservation.EndDate = nextWeekday(time.Sunday).AddDate(0, 0, 2)
+	session.Put(ctx, "reservation", reservation)
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/search-availability" {
+		t.Errorf("PostMakeReservation handler did not redirect to the search for a stay that breaks the stay rules: got %d %s", rr.Code, rr.Header().Get("Location"))
+	}
+
+	if msg := session.GetString(ctx, "error"); msg == "" {
+		t.Error("PostMakeReservation handler did not explain why the stay is not allowed")
+	}
+
+	// test for a bot that fills in the honeypot field
+	postedData.Set("website", "https://spam.example.com")
+	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	reservation.StartDate = nextWeekday(time.Thursday)
+	reservation.EndDate = nextWeekday(time.Thursday).AddDate(0, 0, 1)
+	session.Put(ctx, "reservation", reservation)
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/" || session.Exists(ctx, "reservation") {
+		t.Errorf("PostMakeReservation handler did not send the bot away: got %d %s", rr.Code, rr.Header().Get("Location"))
+	}
+}
+
+func TestRepository_PostMakeReservationPromoCode(t *testing.T) {
+	var tests = []struct {
+		name             string
+		promoCode        string
+		nights           int
+		expectedCode     int
+		expectedDiscount int
+	}{
+		{"valid promo code", "spring10", 2, http.StatusSeeOther, 2700},
+		{"unknown promo code", "WINTER", 2, http.StatusOK, 0},
+		{"stay too short for the promo code", "SPRING10", 1, http.StatusOK, 0},
+	}
+
+	for _, e := range tests {
+		// Thursday at the base price, Friday at the weekend rate
+		reservation := models.Reservation{
+			RoomID:    1,
+			StartDate: nextWeekday(time.Thursday),
+			EndDate:   nextWeekday(time.Thursday).AddDate(0, 0, e.nights),
+		}
+
+		postedData := url.Values{}
+		postedData.Add("first_name", "John")
+		postedData.Add("last_name", "Smith")
+		postedData.Add("email", "john@smith.com")
+		postedData.Add("phone", "555-555-5555")
+		postedData.Add("guests", "1")
+		postedData.Add("promo_code", e.promoCode)
+
+		req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		session.Put(ctx, "reservation", reservation)
+
+		handler := http.HandlerFunc(Repo.PostMakeReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("For %s, expected %d but got %d", e.name, e.expectedCode, rr.Code)
+		}
+
+		if e.expectedCode == http.StatusSeeOther {
+			res, _ := session.Get(ctx, "reservation").(models.Reservation)
+			if res.Price.Discount != e.expectedDiscount || res.PromoCodeID != 1 {
+				t.Errorf("For %s, expected discount %d with promo code 1 but got %d with promo code %d", e.name, e.expectedDiscount, res.Price.Discount, res.PromoCodeID)
+			}
+		}
+	}
+}
+
+func TestRepository_BookReservationPromoCodeUsedUp(t *testing.T) {
+	// Promo code 2 was applied, but its last use was taken by another booking in the meantime
+	res := models.Reservation{
+		RoomID:      1,
+		StartDate:   nextWeekday(time.Thursday),
+		EndDate:     nextWeekday(time.Thursday).AddDate(0, 0, 2),
+		PromoCodeID: 2,
+		Price:       models.PriceQuote{Currency: "USD", Discount: 2700},
+	}
+
+	res, err := Repo.bookReservation(res, models.Room{ID: 1, RoomName: "Panda Suite", BasePrice: 12000})
+	if err != errPromoCodeUsedUp {
+		t.Fatalf("expected the promo code to be used up but got %v", err)
+	}
+
+	if res.ID != 0 || res.PromoCodeID != 0 || res.Price.Discount != 0 {
+		t.Errorf("expected nothing to be booked and the stay to be priced again without the promo code but got %d %d %d",
+			res.ID, res.PromoCodeID, res.Price.Discount)
+	}
+}
+
+func TestRepository_PostSearchAvailability(t *testing.T) {
+	start := nextWeekday(time.Monday)
+
+	var tests = []struct {
+		name             string
+		start            string
+		end              string
+		expectedCode     int
+		expectedLocation string
+		expectedErrors   []string // The fields shown with an error when the form is shown again
+	}{
+		{"end before start", start.AddDate(0, 0, 2).Format("2006/01/02"), start.Format("2006/01/02"), http.StatusUnprocessableEntity, "", []string{"end"}},
+		{"zero nights", start.Format("2006/01/02"), start.Format("2006/01/02"), http.StatusUnprocessableEntity, "", []string{"end"}},
+		{"arrival in the past", time.Now().AddDate(0, 0, -1).Format("2006/01/02"), time.Now().AddDate(0, 0, 1).Format("2006/01/02"), http.StatusUnprocessableEntity, "", []string{"start"}},
+		{"invalid date", "tomorrow", start.Format("2006/01/02"), http.StatusUnprocessableEntity, "", []string{"start"}},
+		{"missing dates", "", "", http.StatusUnprocessableEntity, "", []string{"start", "end"}},
+		{"longer than the search", start.Format("2006/01/02"), start.AddDate(0, 0, maxSearchNights+1).Format("2006/01/02"), http.StatusUnprocessableEntity, "", []string{"end"}},
+		{"longer than the maximum stay", start.Format("2006/01/02"), start.AddDate(0, 0, 20).Format("2006/01/02"), http.StatusSeeOther, "/search-availability", nil},
+		{"longer than the maximum stay in ISO 8601", start.Format("2006-01-02"), start.AddDate(0, 0, 20).Format("2006-01-02"), http.StatusSeeOther, "/search-availability", nil},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("start", e.start)
+		postedData.Add("end", e.end)
+
+		req, _ := http.NewRequest("POST", "/search-availability", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Accept", "application/json")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostSearchAvailability)
+		handler.ServeHTTP(rr, req)
+
+		if len(e.expectedErrors) > 0 {
+			// The JSON of the page that is shown again lists the fields with errors
+			var body struct {
+				Errors map[string][]string `json:"errors"`
+			}
+			_ = json.Unmarshal(rr.Body.Bytes(), &body)
+
+			if rr.Code != e.expectedCode || len(body.Errors) != len(e.expectedErrors) {
+				t.Errorf("For %s, expected the errors of %v but got %d %s", e.name, e.expectedErrors, rr.Code, rr.Body.String())
+			}
+			for _, field := range e.expectedErrors {
+				if len(body.Errors[field]) == 0 {
+					t.Errorf("For %s, expected an error for %s", e.name, field)
+				}
+			}
+			continue
+		}
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("For %s, expected %d but got %d", e.name, e.expectedCode, rr.Code)
+		}
+
+		if rr.Header().Get("Location") != e.expectedLocation {
+			t.Errorf("For %s, expected redirect to %s but got %s", e.name, e.expectedLocation, rr.Header().Get("Location"))
+		}
+
+		if msg := session.GetString(ctx, "error"); msg == "" {
+			t.Errorf("For %s, expected an explanation but got none", e.name)
+		}
+	}
+}
+
+func TestRepository_PostSearchAvailabilityForm(t *testing.T) {
+	postedData := url.Values{}
+	postedData.Add("start", "2022/01/02")
+	postedData.Add("end", "2022/01/01")
+
+	req, _ := http.NewRequest("POST", "/search-availability", strings.NewReader(postedData.Encode()))
+	req = req.WithContext(getCtx(req))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.PostSearchAvailability)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "is-invalid") || !strings.Contains(rr.Body.String(), `value="2022/01/02"`) {
+		t.Errorf("expected the search form to be shown again with its errors and values but got %d", rr.Code)
+	}
+}
+
+func TestRepository_ValidateStayDatesMissing(t *testing.T) {
+	form := forms.New(url.Values{"start": {""}, "end": {" "}})
+	Repo.validateStayDates(form, "start", "end", stayDateLayout)
+
+	// Each missing date is reported once
+	messages := form.Errors.Messages("en")
+	for _, field := range []string{"start", "end"} {
+		if len(messages[field]) != 1 || messages[field][0] != "This field cannot be blank" {
+			t.Errorf("expected one required error for %s but got %q", field, messages[field])
+		}
+	}
+}
+
+func TestRepository_BookRoomInvalidDates(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/book-room?id=1&s=2022/01/01&e=soon", nil)
+	req = req.WithContext(getCtx(req))
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.BookRoom)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || strings.Count(rr.Body.String(), "is-invalid") != 2 {
+		t.Errorf("expected the search form with both dates invalid but got %d", rr.Code)
+	}
+}
+
+func TestRepository_AdminCancelReservation(t *testing.T) {
+	// Use a gateway that knows the captured payment of the reservation
+	gateway := payments.NewFakeGateway("secret")
+	ref, _ := gateway.Authorise(payments.AuthoriseRequest{Amount: 15200, CardNumber: payments.FakeCardOK})
+	_ = gateway.Capture(ref, 15200)
+
+	previous := app.PaymentGateway
+	app.PaymentGateway = gateway
+	defer func() { app.PaymentGateway = previous }()
+
+	var tests = []struct {
+		name         string
+		id           string
+		expectedCode int
+		expectedMsg  string
+	}{
+		{"refunded", "1", http.StatusSeeOther, "flash"},
+		{"already cancelled", "2", http.StatusSeeOther, "warning"},
+		{"unknown reservation", "4", http.StatusNotFound, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/reservations/"+e.id+"/cancel", nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		ctx := getCtx(req)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminCancelReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("For %s, expected %d but got %d", e.name, e.expectedCode, rr.Code)
+		}
+
+		if e.expectedMsg != "" && session.GetString(ctx, e.expectedMsg) == "" {
+			t.Errorf("For %s, expected a %s message but got none", e.name, e.expectedMsg)
+		}
+	}
+
+	// Reservation 1 arrives in 30 days under a moderate policy, so the whole payment is refunded
+	if err := gateway.Refund(ref, 1); err == nil {
+		t.Error("expected the payment to be fully refunded")
+	}
+}
+
+func TestRepository_RefundPayments(t *testing.T) {
+	gateway := payments.NewFakeGateway("secret")
+	first, _ := gateway.Authorise(payments.AuthoriseRequest{Amount: 15200, CardNumber: payments.FakeCardOK})
+	_ = gateway.Capture(first, 15200)
+	_ = gateway.Refund(first, 5000)
+	second, _ := gateway.Authorise(payments.AuthoriseRequest{Amount: 3000, CardNumber: payments.FakeCardOK})
+	_ = gateway.Capture(second, 3000)
+
+	previous := app.PaymentGateway
+	app.PaymentGateway = gateway
+	defer func() { app.PaymentGateway = previous }()
+
+	// The first payment was already partly refunded, so the refund takes the rest of it and part of the second
+	paid := []models.Payment{
+		{ID: 1, ProviderRef: first, Amount: 15200, RefundedAmount: 5000, Status: models.PaymentPartiallyRefunded},
+		{ID: 2, ProviderRef: second, Amount: 3000, Status: models.PaymentCaptured},
+	}
+
+	if err := Repo.refundPayments(paid, 12000); err != nil {
+		t.Fatal(err)
+	}
+
+	if paid[0].RefundedAmount != 15200 || paid[0].Status != models.PaymentRefunded {
+		t.Errorf("expected the first payment to be refunded but got %d %s", paid[0].RefundedAmount, paid[0].Status)
+	}
+
+	if paid[1].RefundedAmount != 1800 || paid[1].Status != models.PaymentPartiallyRefunded {
+		t.Errorf("expected 1800 of the second payment to be refunded but got %d %s", paid[1].RefundedAmount, paid[1].Status)
+	}
+
+	if err := gateway.Refund(second, 1201); err == nil {
+		t.Error("expected only 1200 of the second payment to be left at the provider")
+	}
+}
+
+func TestRepository_CancelReservationTwice(t *testing.T) {
+	// Reservation 2 was cancelled by another request since it was read
+	res := models.Reservation{ID: 2, Code: "TESTCOD2", Status: models.ReservationConfirmed}
+
+	if _, err := Repo.cancelReservation(res); !errors.Is(err, errAlreadyCancelled) {
+		t.Errorf("expected the reservation to be already cancelled but got %v", err)
+	}
+}
+
+func TestRepository_AdminPostAPIKey(t *testing.T) {
+	postedData := url.Values{}
+	postedData.Add("name", "Travel agent")
+	postedData.Add("scopes", models.ScopeReadAvailability)
+	postedData.Add("scopes", models.ScopeCreateReservation)
+	postedData.Add("rate_limit", "60")
+
+	req, _ := http.NewRequest("POST", "/admin/api-keys", strings.NewReader(postedData.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminPostAPIKey)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("AdminPostAPIKey handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+
+	// The key is shown once on the next page
+	if key := session.GetString(ctx, "api_key"); !strings.HasPrefix(key, "bk_") {
+		t.Errorf("expected the new API key in the session but got %q", key)
+	}
+
+	// test case without scopes
+	postedData.Del("scopes")
+	req, _ = http.NewRequest("POST", "/admin/api-keys", strings.NewReader(postedData.Encode()))
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || session.GetString(ctx, "api_key") != "" {
+		t.Errorf("AdminPostAPIKey created a key without scopes: got %d", rr.Code)
+	}
+}
+
+func TestRepository_ReservationInvoice(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/reservation-summary/invoice", nil)
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	rr := httptest.NewRecorder()
+	session.Put(ctx, "reservation_id", 1)
+
+	handler := http.HandlerFunc(Repo.ReservationInvoice)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("ReservationInvoice handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+
+	if rr.Header().Get("Content-Type") != "application/pdf" || !strings.Contains(rr.Header().Get("Content-Disposition"), "INV-000001.pdf") {
+		t.Errorf("ReservationInvoice handler did not send the invoice: %v", rr.Header())
+	}
+
+	// test case where the reservation is not in session
+	req, _ = http.NewRequest("GET", "/reservation-summary/invoice", nil)
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+	rr = httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("ReservationInvoice handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+}
+
+func TestRepository_AdminSyncICalImport(t *testing.T) {
+	// The reservation 1 of the test room holds the 10th and 11th of March 2022
+	calendar := func(date string) string {
+		return "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:1@other.com\r\nDTSTART;VALUE=DATE:" + date + "\r\n" +
+			"END:VEVENT\r\nEND:VCALENDAR\r\n"
+	}
+
+	// The calendar of the test import is a local file
+	dir := t.TempDir()
+	transport := &http.Transport{}
+	transport.RegisterProtocol("file", http.NewFileTransport(http.Dir(dir)))
+
+	previous := app.HTTPClient
+	app.HTTPClient = &http.Client{Transport: transport}
+	defer func() { app.HTTPClient = previous }()
+
+	var tests = []struct {
+		name         string
+		id           string
+		date         string // Of the event of the calendar. Empty when there is no calendar
+		expectedCode int
+		expectedMsg  string
+	}{
+		{"missing calendar", "1", "", http.StatusSeeOther, "error"},
+		{"imported", "1", "20220315", http.StatusSeeOther, "flash"},
+		{"overlapping a reservation", "1", "20220311", http.StatusSeeOther, "warning"},
+		{"unknown import", "2", "20220315", http.StatusNotFound, ""},
+	}
+
+	for _, e := range tests {
+		if e.date != "" {
+			os.WriteFile(filepath.Join(dir, "calendar.ics"), []byte(calendar(e.date)), 0644)
+		}
+
+		req, _ := http.NewRequest("POST", "/admin/ical-imports/"+e.id+"/sync", nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		ctx := getCtx(req)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminSyncICalImport)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("For %s, expected %d but got %d", e.name, e.expectedCode, rr.Code)
+		}
+
+		if e.expectedMsg != "" && session.GetString(ctx, e.expectedMsg) == "" {
+			t.Errorf("For %s, expected a %s message but got none", e.name, e.expectedMsg)
+		}
+	}
+}
+
+func TestRepository_AdminPostICalImport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n"))
+	}))
+	defer ts.Close()
+
+	var tests = []struct {
+		name        string
+		url         string
+		expectedMsg string
+	}{
+		{"imported", ts.URL + "/calendar.ics", "flash"},
+		{"unreachable", "http://127.0.0.1:1/calendar.ics", "warning"},
+		{"not http", "file:///etc/passwd", "error"},
+		{"not a url", "calendar", "error"},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("url", e.url)
+
+		req, _ := http.NewRequest("POST", "/admin/rooms/1/ical-imports", strings.NewReader(postedData.Encode()))
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", "1")
+		ctx := getCtx(req)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostICalImport)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("For %s, expected %d but got %d", e.name, http.StatusSeeOther, rr.Code)
+		}
+
+		if session.GetString(ctx, e.expectedMsg) == "" {
+			t.Errorf("For %s, expected a %s message but got none", e.name, e.expectedMsg)
+		}
+	}
+}
+
+// nextWeekday returns the first <wd> that is at least a week from today
+func nextWeekday(wd time.Weekday) time.Time {
+	d := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 7)
+	for d.Weekday() != wd {
+		d = d.AddDate(0, 0, 1)
+	}
+
+	return d
+}
+
+// getCtx returns the context of <req> with a session loaded into it
+func getCtx(req *http.Request) context.Context {
+	ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+	if err != nil {
+		log.Println(err)
+	}
+
+	return ctx
+}
+
+func TestRepository_ChangeLanguage(t *testing.T) {
+	var tests = []struct {
+		name             string
+		locale           string
+		referer          string
+		expectedCode     int
+		expectedLocation string
+	}{
+		{"back-to-page", "pt", "http://example.com/search-availability?x=1", http.StatusSeeOther, "/search-availability?x=1"},
+		{"no-referer", "ja", "", http.StatusSeeOther, "/"},
+		{"other-site", "ja", "http://evil.example/phish", http.StatusSeeOther, "/"},
+		{"unsupported", "xx", "", http.StatusNotFound, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "http://example.com/language/"+e.locale, nil)
+		req.Header.Set("Referer", e.referer)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("locale", e.locale)
+		req = req.WithContext(context.WithValue(getCtx(req), chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.ChangeLanguage)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode || rr.Header().Get("Location") != e.expectedLocation {
+			t.Errorf("For %s, expected %d to %q but got %d to %q", e.name, e.expectedCode, e.expectedLocation, rr.Code, rr.Header().Get("Location"))
+		}
+
+		if e.expectedCode == http.StatusSeeOther && !strings.Contains(rr.Header().Get("Set-Cookie"), i18n.CookieName+"="+e.locale) {
+			t.Errorf("For %s, expected the cookie of the locale but got %q", e.name, rr.Header().Get("Set-Cookie"))
+		}
+	}
+}
+
+func TestRepository_HomeTranslated(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/", nil)
+	req = req.WithContext(i18n.WithLocale(getCtx(req), "pt"))
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.Home)
+	handler.ServeHTTP(rr, req)
+
+	if !strings.Contains(rr.Body.String(), i18n.T("pt", "home.make_reservation")) || !strings.Contains(rr.Body.String(), `<html lang="pt">`) {
+		t.Error("expected the home page in Portuguese")
+	}
+}
+
+func TestRepository_PostSearchAvailabilityJSON(t *testing.T) {
+	start := nextWeekday(time.Monday)
+
+	postedData := url.Values{}
+	postedData.Add("start", start.Format("2006/01/02"))
+	postedData.Add("end", start.AddDate(0, 0, 2).Format("2006/01/02"))
+
+	req, _ := http.NewRequest("POST", "/search-availability", strings.NewReader(postedData.Encode()))
+	req = req.WithContext(getCtx(req))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.PostSearchAvailability)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("expected JSON but got %d %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+
+	var body struct {
+		Data roomsPage `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(body.Data.Rooms) == 0 || body.Data.Rooms[0].Price.Total == 0 {
+		t.Errorf("expected the rooms with their prices but got %s", rr.Body.String())
+	}
+}
+
+func TestRepository_AdminPageNotJSON(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/api-keys", nil)
+	req = req.WithContext(getCtx(req))
+	req.Header.Set("Accept", "application/json")
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminAPIKeys)
+	handler.ServeHTTP(rr, req)
+
+	// Only the pages with a JSON body answer with JSON; the others are always HTML
+	if rr.Code != http.StatusOK || strings.HasPrefix(rr.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("expected the HTML page but got %d %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+}
+
+func TestConfirmationEmail(t *testing.T) {
+	start := time.Date(2050, 3, 1, 0, 0, 0, 0, time.UTC)
+	res := models.Reservation{FirstName: "John", StartDate: start, EndDate: start.AddDate(0, 0, 2), Code: "ABCD2345"}
+
+	email := confirmationEmail(res, app.Property)
+	if !strings.Contains(email, "Check-in is from 14:00 on 2050-03-01 and check-out is until 11:00 on 2050-03-03, UTC time") {
+		t.Errorf("expected the check-in and check-out times of the property but got %s", email)
+	}
+}
+
+func TestRepository_SameDayCutoff(t *testing.T) {
+	app.Property.SameDayCutoff = property.TimeOfDay{Hour: 20}
+	defer func() {
+		app.Property.SameDayCutoff = property.TimeOfDay{}
+		testClock.Set(time.Now())
+	}()
+
+	today := time.Date(2050, 3, 1, 0, 0, 0, 0, time.UTC)
+	res := models.Reservation{StartDate: today, EndDate: today.AddDate(0, 0, 2)}
+
+	testClock.Set(today.Add(19 * time.Hour))
+	if violations, err := Repo.checkStayRules(res, "en"); err != nil || len(violations) != 0 {
+		t.Errorf("expected a stay arriving today to be allowed before the cutoff but got %v, %v", violations, err)
+	}
+
+	testClock.Advance(2 * time.Hour)
+	if violations, err := Repo.checkStayRules(res, "en"); err != nil || len(violations) != 1 || !strings.Contains(violations[0], "20:00") {
+		t.Errorf("expected a stay arriving today to be refused after the cutoff but got %v, %v", violations, err)
+	}
+
+	// The explanation is in the locale of the guest
+	if violations, _ := Repo.checkStayRules(res, "pt"); len(violations) != 1 || violations[0] != i18n.T("pt", "stay.same_day_cutoff", "20:00") {
+		t.Errorf("expected the explanation of the cutoff in Portuguese but got %v", violations)
+	}
+
+	// The next day, the same stay is in the past
+	testClock.Advance(24 * time.Hour)
+	if violations, _ := Repo.checkStayRules(res, "en"); len(violations) == 0 {
+		t.Error("expected a stay arriving yesterday to be refused")
+	}
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wagnojunior/booking/internal/helpers"
+	"github.com/wagnojunior/booking/internal/ical"
+	"github.com/wagnojunior/booking/internal/models"
+)
+
+// RoomCalendar serves the iCalendar feed of the reservations and blocks of a room to whoever knows its secret token
+func (m *Repository) RoomCalendar(w http.ResponseWriter, r *http.Request) {
+	roomID, err := strconv.Atoi(chi.URLParam(r, "room"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	room, err := m.DB.GetRoomByID(roomID)
+	if err == sql.ErrNoRows {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// A room without a token has no feed. The comparison takes the same time whatever the token is
+	token := chi.URLParam(r, "token")
+	if room.ICalToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(room.ICalToken)) != 1 {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	restrictions, err := m.DB.GetRoomRestrictionsByRoomID(roomID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Write([]byte(ical.Feed(room, restrictions, m.App.Domain, m.App.Property)))
+}
+
+// SyncICalImports imports the calendars of every room from the other channels, so that the bookings made there
+// block the room here. Errors are logged and kept with the import
+func (m *Repository) SyncICalImports() {
+	imports, err := m.DB.AllICalImports()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	for _, imp := range imports {
+		_, _ = m.syncICalImport(imp)
+	}
+}
+
+// syncICalImport brings the restrictions of the calendar import <imp> in line with its calendar. The warnings, e.g.
+// the imported bookings that overlap the reservations made here, are logged and kept with the import for the admin
+func (m *Repository) syncICalImport(imp models.ICalImport) ([]string, error) {
+	warnings, err := m.pullICalImport(imp)
+
+	lastError := ""
+	if err != nil {
+		m.App.ErrorLog.Printf("importing calendar %d of room %d: %v", imp.ID, imp.RoomID, err)
+		lastError = err.Error()
+	}
+
+	for _, warning := range warnings {
+		m.App.ErrorLog.Printf("importing calendar %d of room %d: %s", imp.ID, imp.RoomID, warning)
+	}
+
+	if statusErr := m.DB.UpdateICalImportStatus(imp.ID, lastError, strings.Join(warnings, "\n")); statusErr != nil {
+		m.App.ErrorLog.Println(statusErr)
+	}
+
+	return warnings, err
+}
+
+// pullICalImport fetches the calendar of <imp> and applies its changes to the restrictions of the room.
+// The new blocks are announced to the webhook endpoints. It returns what of the calendar was left out, and the
+// imported bookings that overlap the reservations made here, which are still imported but need the admin to act
+func (m *Repository) pullICalImport(imp models.ICalImport) ([]string, error) {
+	cal, err := ical.Fetch(m.App.HTTPClient, imp.URL, m.App.Property.Location(), m.App.Clock.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := m.DB.GetRoomRestrictionsByICalImportID(imp.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := ical.Reconcile(imp, existing, cal.Events)
+
+	// The restrictions of the room are read before the changes, so that the imported ones do not overlap themselves
+	restrictions, err := m.DB.GetRoomRestrictionsByRoomID(imp.RoomID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.DB.SyncRoomRestrictions(changes.Insert, changes.Update, changes.Delete)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the new bookings of the other channels are announced, not the ones that moved
+	for _, r := range changes.Insert {
+		m.queueWebhook(models.EventBlockCreated, toWebhookBlock(r))
+	}
+
+	warnings := cal.Warnings
+	for _, imported := range append(changes.Insert, changes.Update...) {
+		for _, rr := range restrictions {
+			if rr.ReservationID == 0 || !rr.StartDate.Before(imported.EndDate) || !imported.StartDate.Before(rr.EndDate) {
+				continue
+			}
+
+			warnings = append(warnings, fmt.Sprintf("the booking %s from %s to %s overlaps the reservation %s of %s %s",
+				imported.ExternalUID, imported.StartDate.Format("2006-01-02"), imported.EndDate.Format("2006-01-02"),
+				rr.Reservation.Code, rr.Reservation.FirstName, rr.Reservation.LastName))
+		}
+	}
+
+	return warnings, nil
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wagnojunior/booking/internal/helpers"
+	"github.com/wagnojunior/booking/internal/invoice"
+	"github.com/wagnojunior/booking/internal/models"
+)
+
+// ReservationInvoice downloads the invoice of the reservation the guest has just made
+func (m *Repository) ReservationInvoice(w http.ResponseWriter, r *http.Request) {
+	id := m.App.Session.GetInt(r.Context(), "reservation_id")
+	if id == 0 {
+		m.App.Session.Put(r.Context(), "error", "Can't get reservation from session")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	m.downloadInvoice(w, r, id)
+}
+
+// AdminReservationInvoice downloads the invoice of a reservation
+func (m *Repository) AdminReservationInvoice(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	m.downloadInvoice(w, r, id)
+}
+
+// downloadInvoice sends the invoice of the reservation <id> as a PDF file
+func (m *Repository) downloadInvoice(w http.ResponseWriter, r *http.Request, id int) {
+	res, err := m.DB.GetReservationByID(id)
+	if err == sql.ErrNoRows {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// Reservations waiting for payment are not invoiced yet
+	if res.Status == models.ReservationPending {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	inv, pdf, err := m.invoicePDF(res)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", invoice.FileName(inv)))
+	w.Write(pdf)
+}
+
+// invoicePDF renders the invoice of the reservation <res>. The invoice is issued the first time it is needed
+func (m *Repository) invoicePDF(res models.Reservation) (models.Invoice, []byte, error) {
+	inv, err := m.DB.GetInvoiceByReservationID(res.ID)
+	if err == sql.ErrNoRows {
+		inv, err = m.DB.InsertInvoice(res.ID)
+	}
+	if err != nil {
+		return inv, nil, err
+	}
+
+	payments, err := m.DB.GetPaymentsByReservationID(res.ID)
+	if err != nil {
+		return inv, nil, err
+	}
+
+	return inv, invoice.Render(m.App.PropertyName, inv, res, payments), nil
+}
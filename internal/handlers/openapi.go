@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/wagnojunior/booking/internal/models"
+	"github.com/wagnojunior/booking/internal/openapi"
+	"github.com/wagnojunior/booking/internal/render"
+)
+
+// apiVersion is the version of the API described by the OpenAPI document
+const apiVersion = "1.0.0"
+
+// apiSecurity are the ways a request to the API can be authenticated, as API key in either header
+var apiSecurity = []map[string][]string{
+	{"bearerAuth": {}},
+	{"apiKeyHeader": {}},
+}
+
+// APIDocument returns the OpenAPI document of every JSON endpoint. The schemas are derived from the Go types
+// that the handlers encode and decode
+func APIDocument() *openapi.Document {
+	doc := openapi.New(openapi.Info{
+		Title:   "Booking API",
+		Version: apiVersion,
+		Description: "Rooms, availability and reservations. Authenticate with an API key, either as bearer token or " +
+			"in the X-API-Key header. Amounts are in the minor unit of the currency (e.g. cents) and dates have the " +
+			"format YYYY-MM-DD.",
+	})
+
+	doc.Components.SecuritySchemes = map[string]openapi.SecurityScheme{
+		"bearerAuth":   {Type: "http", Scheme: "bearer", Description: "API key as bearer token"},
+		"apiKeyHeader": {Type: "apiKey", In: "header", Name: "X-API-Key", Description: "API key"},
+	}
+
+	// The types are registered before the types that contain them, so that the schemas refer to them
+	doc.Register("ErrorDetail", apiErrorDetail{})
+	doc.Register("Error", apiError{})
+	doc.Register("Room", apiRoom{})
+	doc.Register("RoomList", apiRoomList{})
+	doc.Register("Night", apiNight{})
+	doc.Register("PriceLine", apiPriceLine{})
+	doc.Register("Price", apiPrice{})
+	doc.Register("AvailableRoom", apiAvailableRoom{})
+	doc.Register("UnavailableRoom", apiUnavailableRoom{})
+	doc.Register("Availability", apiAvailability{})
+	doc.Register("ReservationRequest", apiReservationRequest{})
+	doc.Register("Reservation", apiReservation{})
+	doc.Register("RoomAvailability", jsonResponse{})
+	doc.Register("SearchPage", searchPage{})
+	doc.Register("RoomsPage", roomsPage{})
+
+	code := openapi.Parameter{Name: "code", In: "path", Required: true, Description: "Confirmation code of the reservation", Schema: &openapi.Schema{Type: "string"}}
+
+	doc.Add("GET", "/api/openapi.json", openapi.Operation{
+		OperationID: "getOpenAPIDocument",
+		Summary:     "This OpenAPI document",
+		Tags:        []string{"documentation"},
+		Responses: map[string]openapi.Response{
+			"200": jsonContent("The OpenAPI document", &openapi.Schema{Type: "object"}),
+		},
+	})
+
+	doc.Add("POST", "/search-availability-json", openapi.Operation{
+		OperationID: "checkRoomAvailability",
+		Summary:     "Check if a room is free for a stay",
+		Description: "Used by the room pages of the web site. It needs the session cookie and the CSRF token of the site, " +
+			"and no API key. Dates have the format YYYY/MM/DD.",
+		Tags: []string{"web site"},
+		RequestBody: &openapi.RequestBody{
+			Required: true,
+			Content: map[string]openapi.MediaType{
+				"application/x-www-form-urlencoded": {Schema: &openapi.Schema{
+					Type: "object",
+					Properties: map[string]*openapi.Schema{
+						"start":      {Type: "string", Description: "Arrival date, YYYY/MM/DD"},
+						"end":        {Type: "string", Description: "Departure date, YYYY/MM/DD"},
+						"room_id":    {Type: "integer"},
+						"csrf_token": {Type: "string"},
+					},
+					Required: []string{"start", "end", "room_id", "csrf_token"},
+				}},
+			},
+		},
+		Responses: map[string]openapi.Response{
+			"200": jsonContent("Whether the room can be booked, with the reasons why not", doc.SchemaOf(jsonResponse{})),
+			"429": {Description: "Too many requests from this IP address or session; see the Retry-After header"},
+		},
+	})
+
+	doc.Add("GET", "/search-availability", webPageOperation(openapi.Operation{
+		OperationID: "getSearchPage",
+		Summary:     "The Book Now page, with the CSRF token of the search form",
+		Responses: map[string]openapi.Response{
+			"200": pageContent(doc, "The empty search form", doc.SchemaOf(searchPage{})),
+		},
+	}))
+
+	doc.Add("POST", "/search-availability", webPageOperation(openapi.Operation{
+		OperationID: "searchRooms",
+		Summary:     "Search the rooms that can be booked for a stay",
+		Description: "The stay is kept in the session, for one of the rooms to be chosen at /choose-room/{id}.",
+		RequestBody: formBody(map[string]*openapi.Schema{
+			"start": {Type: "string", Description: "Arrival date, YYYY/MM/DD"},
+			"end":   {Type: "string", Description: "Departure date, YYYY/MM/DD"},
+		}, "start", "end"),
+		Responses: map[string]openapi.Response{
+			"200": pageContent(doc, "The rooms that can be booked, with their prices", doc.SchemaOf(roomsPage{})),
+			"303": {Description: "No room can be booked; the reasons are the error of the search page"},
+			"422": pageContent(doc, "Invalid dates", doc.SchemaOf(searchPage{})),
+		},
+	}))
+
+	doc.Add("GET", "/make-reservation", webPageOperation(openapi.Operation{
+		OperationID: "getReservationForm",
+		Summary:     "The priced stay chosen from the session, before the details of the guest are given",
+		Responses: map[string]openapi.Response{
+			"200": pageContent(doc, "The reservation to be booked", doc.SchemaOf(apiReservation{})),
+		},
+	}))
+
+	doc.Add("POST", "/make-reservation", webPageOperation(openapi.Operation{
+		OperationID: "postReservationForm",
+		Summary:     "Book the chosen stay for the guest",
+		Description: "The room is held while the guest pays at /checkout.",
+		RequestBody: formBody(map[string]*openapi.Schema{
+			"first_name": {Type: "string"},
+			"last_name":  {Type: "string"},
+			"email":      {Type: "string"},
+			"phone":      {Type: "string"},
+			"guests":     {Type: "integer"},
+			"promo_code": {Type: "string"},
+		}, "first_name", "last_name", "email", "phone", "guests"),
+		Responses: map[string]openapi.Response{
+			"303": {Description: "Booked; the reservation is paid at /checkout"},
+			"422": pageContent(doc, "Invalid details or promo code", doc.SchemaOf(apiReservation{})),
+		},
+	}))
+
+	doc.Add("GET", "/checkout", webPageOperation(openapi.Operation{
+		OperationID: "getCheckout",
+		Summary:     "The pending reservation of the session, to be paid",
+		Responses: map[string]openapi.Response{
+			"200": pageContent(doc, "The reservation to be paid", doc.SchemaOf(apiReservation{})),
+			"303": {Description: "There is no reservation to pay, or its hold has expired"},
+		},
+	}))
+
+	doc.Add("POST", "/checkout", webPageOperation(openapi.Operation{
+		OperationID: "postCheckout",
+		Summary:     "Pay the pending reservation of the session",
+		RequestBody: formBody(map[string]*openapi.Schema{
+			"card_number": {Type: "string", Description: "Not needed when a promo code covers the whole stay"},
+		}),
+		Responses: map[string]openapi.Response{
+			"303": {Description: "Paid and confirmed; see /reservation-summary"},
+			"422": pageContent(doc, "Missing card number, or the card was declined", doc.SchemaOf(apiReservation{})),
+		},
+	}))
+
+	doc.Add("GET", "/reservation-summary", webPageOperation(openapi.Operation{
+		OperationID: "getReservationSummary",
+		Summary:     "The reservation just booked, which is then removed from the session",
+		Responses: map[string]openapi.Response{
+			"200": pageContent(doc, "The confirmed reservation", doc.SchemaOf(apiReservation{})),
+			"307": {Description: "There is no reservation in the session"},
+		},
+	}))
+
+	doc.Add("GET", "/api/v1/rooms", apiOperation(models.ScopeReadAvailability, openapi.Operation{
+		OperationID: "listRooms",
+		Summary:     "List the rooms",
+		Tags:        []string{"availability"},
+		Responses: map[string]openapi.Response{
+			"200": jsonContent("The rooms", doc.SchemaOf(apiRoomList{})),
+		},
+	}))
+
+	doc.Add("GET", "/api/v1/availability", apiOperation(models.ScopeReadAvailability, openapi.Operation{
+		OperationID: "searchAvailability",
+		Summary:     "List the rooms that can be booked for a stay, with its price",
+		Tags:        []string{"availability"},
+		Parameters: []openapi.Parameter{
+			{Name: "start_date", In: "query", Required: true, Description: "Arrival date", Schema: &openapi.Schema{Type: "string", Format: "date"}},
+			{Name: "end_date", In: "query", Required: true, Description: "Departure date", Schema: &openapi.Schema{Type: "string", Format: "date"}},
+			{Name: "guests", In: "query", Description: "Number of guests, 1 by default", Schema: &openapi.Schema{Type: "integer"}},
+		},
+		Responses: map[string]openapi.Response{
+			"200": jsonContent("The available rooms", doc.SchemaOf(apiAvailability{})),
+			"422": errorContent("Invalid dates or guests, or a stay that is not allowed"),
+		},
+	}))
+
+	doc.Add("POST", "/api/v1/reservations", apiOperation(models.ScopeCreateReservation, openapi.Operation{
+		OperationID: "createReservation",
+		Summary:     "Book a room",
+		Description: "The room is held while the card in card_number is charged the price of the stay, and the " +
+			"reservation is confirmed once it is paid. API keys that also have the scope create-unpaid-reservation " +
+			"book without paying: the API client collects the payment, and the reservation is confirmed at once.",
+		Tags: []string{"reservations"},
+		RequestBody: &openapi.RequestBody{
+			Required: true,
+			Content: map[string]openapi.MediaType{
+				"application/json": {Schema: doc.SchemaOf(apiReservationRequest{})},
+			},
+		},
+		Responses: map[string]openapi.Response{
+			"201": jsonContent("The reservation", doc.SchemaOf(apiReservation{})),
+			"400": errorContent("The body is not a JSON reservation"),
+			"402": errorContent("The card was declined, or the payment could not be completed"),
+			"409": errorContent("The room is not available for these dates"),
+			"422": errorContent("Invalid fields, or a stay that is not allowed"),
+		},
+	}))
+
+	doc.Add("GET", "/api/v1/reservations/{code}", apiOperation(models.ScopeManageReservations, openapi.Operation{
+		OperationID: "getReservation",
+		Summary:     "Show a reservation",
+		Tags:        []string{"reservations"},
+		Parameters:  []openapi.Parameter{code},
+		Responses: map[string]openapi.Response{
+			"200": jsonContent("The reservation", doc.SchemaOf(apiReservation{})),
+			"404": errorContent("There is no reservation with this confirmation code"),
+		},
+	}))
+
+	doc.Add("POST", "/api/v1/reservations/{code}/cancel", apiOperation(models.ScopeManageReservations, openapi.Operation{
+		OperationID: "cancelReservation",
+		Summary:     "Cancel a reservation",
+		Description: "The guest is refunded what the cancellation policy of the reservation allows.",
+		Tags:        []string{"reservations"},
+		Parameters:  []openapi.Parameter{code},
+		Responses: map[string]openapi.Response{
+			"200": jsonContent("The cancelled reservation", doc.SchemaOf(apiReservation{})),
+			"404": errorContent("There is no reservation with this confirmation code"),
+			"409": errorContent("The reservation is already cancelled"),
+		},
+	}))
+
+	return doc
+}
+
+// apiOperation adds to <op> the security and the error responses shared by the endpoints that need the scope <scope>
+func apiOperation(scope string, op openapi.Operation) openapi.Operation {
+	op.Security = apiSecurity
+	op.Description = strings.TrimSpace(fmt.Sprintf("Requires an API key with the scope %s. %s", scope, op.Description))
+
+	op.Responses["401"] = errorContent("Missing, invalid or expired API key")
+	op.Responses["403"] = errorContent("The API key does not have the scope " + scope)
+	op.Responses["429"] = errorContent("The API key has made too many requests; see the Retry-After header")
+	op.Responses["500"] = errorContent("Internal server error")
+
+	return op
+}
+
+// webPageOperation adds to <op> what the pages of the web site that also answer with JSON have in common
+func webPageOperation(op openapi.Operation) openapi.Operation {
+	op.Description = strings.TrimSpace("Page of the web site, which answers with JSON when the Accept header prefers " +
+		"application/json. It needs the session cookie of the site, and the forms need its CSRF token, sent back as " +
+		"csrf_token. " + op.Description)
+	op.Tags = []string{"web site"}
+
+	return op
+}
+
+// formBody returns the body of a form of the web site with the fields <fields>, of which <required> are required.
+// The CSRF token is added to them
+func formBody(fields map[string]*openapi.Schema, required ...string) *openapi.RequestBody {
+	fields["csrf_token"] = &openapi.Schema{Type: "string"}
+
+	return &openapi.RequestBody{
+		Required: true,
+		Content: map[string]openapi.MediaType{
+			"application/x-www-form-urlencoded": {Schema: &openapi.Schema{
+				Type:       "object",
+				Properties: fields,
+				Required:   append(required, "csrf_token"),
+			}},
+		},
+	}
+}
+
+// pageContent returns the JSON response of a page of the web site, whose data has the schema <data>
+func pageContent(doc *openapi.Document, description string, data *openapi.Schema) openapi.Response {
+	page := doc.SchemaOf(render.Page{})
+	page.Properties["data"] = data
+
+	return jsonContent(description, page)
+}
+
+// jsonContent returns a JSON response with the schema <schema>
+func jsonContent(description string, schema *openapi.Schema) openapi.Response {
+	return openapi.Response{
+		Description: description,
+		Content: map[string]openapi.MediaType{
+			"application/json": {Schema: schema},
+		},
+	}
+}
+
+// errorContent returns an error response of the API
+func errorContent(description string) openapi.Response {
+	return jsonContent(description, &openapi.Schema{Ref: "#/components/schemas/Error"})
+}
+
+// OpenAPI serves the OpenAPI document of the API, from which the partners can generate clients
+func (m *Repository) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	m.writeJSON(w, http.StatusOK, APIDocument())
+}
@@ -8,21 +8,48 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"testing"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/justinas/nosurf"
+	"github.com/wagnojunior/booking/internal/clock"
 	"github.com/wagnojunior/booking/internal/config"
+	"github.com/wagnojunior/booking/internal/helpers"
 	"github.com/wagnojunior/booking/internal/models"
+	"github.com/wagnojunior/booking/internal/payments"
+	"github.com/wagnojunior/booking/internal/property"
 	"github.com/wagnojunior/booking/internal/render"
 )
 
 var app config.AppConfig
 var session *scs.SessionManager
 var pathToTemplates = "./../../templates"
-var functions = template.FuncMap{}
+var functions = render.Functions()
+var testClock *clock.Fake
+
+// TestMain sets up the routes, and thus the repository and the session, before any of the tests are run
+func TestMain(m *testing.M) {
+	getRoutes()
+
+	// The handlers send emails through the mail channel, which is drained here
+	mailChan := make(chan models.MailData)
+	app.MailChan = mailChan
+	defer close(mailChan)
+	listenForMail()
+
+	os.Exit(m.Run())
+}
+
+// listenForMail discards every email sent by the handlers
+func listenForMail() {
+	go func() {
+		for range app.MailChan {
+		}
+	}()
+}
 
 func getRoutes() http.Handler {
 	// Things that will be put in sessions
@@ -30,6 +57,20 @@ func getRoutes() http.Handler {
 
 	// Set the in development mode
 	app.InProduction = false
+	app.PropertyName = "Panpanzinho's Bed and Breakfast"
+	app.Domain = "panpanzinho.com"
+	app.Currency = "USD"
+	// The clock is stopped, and only moves when a test moves it
+	testClock = clock.NewFake(time.Now())
+	app.Clock = testClock
+
+	app.Property = property.Settings{
+		TimeZone: time.UTC,
+		CheckIn:  property.TimeOfDay{Hour: 14},
+		CheckOut: property.TimeOfDay{Hour: 11},
+	}
+	app.PaymentGateway = payments.NewFakeGateway("secret")
+	app.HTTPClient = &http.Client{Timeout: time.Second}
 
 	// Creates the infoLog. Write to the standard output (terminal),
 	// prefixed by the tag INFO, and flagged by the date and time
@@ -52,7 +93,7 @@ func getRoutes() http.Handler {
 	// Creates the template cache
 	tc, err := CreateTestTemplateCache()
 	if err != nil {
-		log.Fatal("cannot create template cache")
+		log.Fatal("cannot create template cache: ", err)
 	}
 
 	// Sets the <TemplateCache> field in the <AppConfig>
@@ -60,7 +101,7 @@ func getRoutes() http.Handler {
 	app.UseCache = true
 
 	// Sets the variable <repo>, which points to the <AppConfig> app
-	repo := NewRepo(&app)
+	repo := NewTestRepo(&app)
 
 	// Sends the local variable <repo> to <handlers.go> to initialize the variable <Repo> there
 	NewHandlers(repo)
@@ -68,11 +109,26 @@ func getRoutes() http.Handler {
 	// Initialized the variable <app> of type <*AppConfig> in <render.go>
 	render.NewRenderer(&app)
 
+	// Initialized the variable <app> of type <*AppConfig> in <helpers.go>
+	helpers.NewHelpers(&app)
+
+	// The routes the templates link to
+	render.NewRoutes(map[string]string{
+		"choose-room":               "/choose-room/{id}",
+		"language":                  "/language/{locale}",
+		"admin-promo-code":          "/admin/promo-codes/{id}",
+		"admin-api-key":             "/admin/api-keys/{id}",
+		"admin-webhook":             "/admin/webhooks/{id}",
+		"admin-reservation":         "/admin/reservations/{id}",
+		"admin-reservation-invoice": "/admin/reservations/{id}/invoice",
+	})
+
 	// Create a new mux
 	mux := chi.NewRouter()
 
 	// Middleware allows you to process a web request as it comes and perform an action
 	mux.Use(middleware.Recoverer) // Gracefully absorb panics and prints the stack trace
+
 	// mux.Use(NoSurf)               // Our own middleware which was created in <middleware.go> using the third-party package <nosurf>
 	mux.Use(SessionLoad)
 
@@ -83,13 +139,56 @@ func getRoutes() http.Handler {
 	mux.Get("/bamboo-dorm", Repo.BambooDorm)
 	mux.Get("/search-availability", Repo.SearchAvailability)
 	mux.Get("/contact", Repo.Contact)
+	mux.Get("/language/{locale}", Repo.ChangeLanguage)
 	mux.Get("/make-reservation", Repo.MakeReservation)
 	mux.Get("/reservation-summary", Repo.ReservationSummary)
+	mux.Get("/checkout", Repo.Checkout)
+	mux.Get("/ical/{room}/{token}.ics", Repo.RoomCalendar)
+	mux.Get("/user/login", Repo.ShowLogin)
+	mux.Get("/user/logout", Repo.Logout)
+	mux.Get("/user/register", Repo.ShowRegister)
+	mux.Get("/user/verify/{token}", Repo.VerifyEmail)
+	mux.Get("/admin/promo-codes", Repo.AdminPromoCodes)
+	mux.Get("/admin/promo-codes/{id}", Repo.AdminShowPromoCode)
+	mux.Get("/admin/rooms", Repo.AdminRooms)
+	mux.Get("/admin/api-keys", Repo.AdminAPIKeys)
+	mux.Get("/admin/api-keys/{id}", Repo.AdminShowAPIKey)
+	mux.Get("/admin/webhooks", Repo.AdminWebhooks)
+	mux.Get("/admin/webhooks/{id}", Repo.AdminShowWebhook)
+	mux.Get("/admin/reservations", Repo.AdminReservations)
+	mux.Get("/admin/reservations/{id}", Repo.AdminShowReservation)
+	mux.Get("/admin/reservations/{id}/invoice", Repo.AdminReservationInvoice)
 
 	// Post the http requests
 	mux.Post("/search-availability", Repo.PostSearchAvailability) // Catch requests that POST to this url and send it to the specified handler
 	mux.Post("/search-availability-json", Repo.AvailabilityJSON)
 	mux.Post("/make-reservation", Repo.PostMakeReservation)
+	mux.Post("/checkout", Repo.PostCheckout)
+	mux.Post("/payments/webhook", Repo.PaymentWebhook)
+	mux.Post("/user/login", Repo.PostShowLogin)
+	mux.Post("/user/register", Repo.PostRegister)
+	mux.Post("/admin/promo-codes/{id}", Repo.AdminPostPromoCode)
+	mux.Post("/admin/promo-codes/{id}/delete", Repo.AdminDeletePromoCode)
+	mux.Post("/admin/reservations/{id}/cancel", Repo.AdminCancelReservation)
+	mux.Post("/admin/rooms/{id}/ical-imports", Repo.AdminPostICalImport)
+	mux.Post("/admin/ical-imports/{id}/sync", Repo.AdminSyncICalImport)
+	mux.Post("/admin/ical-imports/{id}/delete", Repo.AdminDeleteICalImport)
+	mux.Post("/admin/api-keys", Repo.AdminPostAPIKey)
+	mux.Post("/admin/api-keys/{id}/delete", Repo.AdminDeleteAPIKey)
+	mux.Post("/admin/webhooks", Repo.AdminPostWebhook)
+	mux.Post("/admin/webhooks/{id}/delete", Repo.AdminDeleteWebhook)
+
+	// The JSON API
+	mux.Get("/api/openapi.json", Repo.OpenAPI)
+	mux.Route("/api/v1", func(mux chi.Router) {
+		mux.Use(Repo.APIAuth)
+
+		mux.With(Repo.RequireScope(models.ScopeReadAvailability)).Get("/rooms", Repo.APIRooms)
+		mux.With(Repo.RequireScope(models.ScopeReadAvailability)).Get("/availability", Repo.APIAvailability)
+		mux.With(Repo.RequireScope(models.ScopeCreateReservation)).Post("/reservations", Repo.APIPostReservation)
+		mux.With(Repo.RequireScope(models.ScopeManageReservations)).Get("/reservations/{code}", Repo.APIReservation)
+		mux.With(Repo.RequireScope(models.ScopeManageReservations)).Post("/reservations/{code}/cancel", Repo.APICancelReservation)
+	})
 
 	// Creates a file server from which static files are retrieved
 	fileServer := http.FileServer(http.Dir("./static/"))
@@ -144,21 +243,17 @@ func CreateTestTemplateCache() (map[string]*template.Template, error) {
 			return myCache, err
 		}
 
-		// <Glob> returns the names of all files matching pattern or nil if there is no matching file
-		matches, err := filepath.Glob(fmt.Sprintf("%s/*.layout.tmpl", pathToTemplates))
+		// ParseGlob parses the template definitions in the files identified by the pattern and associates the
+		//resulting templates with t.
+		ts, err = ts.ParseGlob(fmt.Sprintf("%s/*.layout.tmpl", pathToTemplates))
 		if err != nil {
 			return myCache, err
 		}
 
-		// If the length of <matches> is grater than zero, there are might be layouts associated with templates
-		// In fact, this is the case for <about.page.tmpl> and <home.page.tmpl> which reference <base.layout.tmpl>
-		if len(matches) > 0 {
-			// ParseGlob parses the template definitions in the files identified by the pattern and associates the
-			//resulting templates with t.
-			ts, err = ts.ParseGlob(fmt.Sprintf("%s/*.layout.tmpl", pathToTemplates))
-			if err != nil {
-				return myCache, err
-			}
+		// The partials are the fragments shared by the pages
+		ts, err = ts.ParseGlob(fmt.Sprintf("%s/*.partial.tmpl", pathToTemplates))
+		if err != nil {
+			return myCache, err
 		}
 
 		// Add the parsed template to the template map <myCache>
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/wagnojunior/booking/internal/models"
+	"github.com/wagnojunior/booking/internal/webhooks"
+)
+
+// webhookBatchSize is how many due deliveries are sent at most per run of the worker
+const webhookBatchSize = 50
+
+// webhookEvent is the JSON body posted to the webhook endpoints
+type webhookEvent struct {
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// webhookBlock is the data of a block.created event: the room is closed for the nights from StartDate to EndDate
+type webhookBlock struct {
+	RoomID    int    `json:"room_id"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+	Type      string `json:"type"` // "owner_block", or "external" for a booking imported from another channel
+}
+
+// toWebhookBlock converts the restriction <r> to the data of a block.created event
+func toWebhookBlock(r models.RoomRestriction) webhookBlock {
+	block := webhookBlock{
+		RoomID:    r.RoomID,
+		StartDate: r.StartDate.Format(apiDateLayout),
+		EndDate:   r.EndDate.Format(apiDateLayout),
+		Type:      "owner_block",
+	}
+	if r.RestrictionID == models.RestrictionExternal {
+		block.Type = "external"
+	}
+
+	return block
+}
+
+// webhookDeliveries returns the deliveries of the event <event> with <data> to every endpoint that subscribes to it,
+// due at <now>
+func (m *Repository) webhookDeliveries(event string, data interface{}, now time.Time) ([]models.WebhookDelivery, error) {
+	endpoints, err := m.DB.AllWebhookEndpoints()
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(webhookEvent{Event: event, CreatedAt: now.UTC(), Data: data})
+	if err != nil {
+		return nil, err
+	}
+
+	var deliveries []models.WebhookDelivery
+	for _, e := range endpoints {
+		if !e.Events.Contains(event) {
+			continue
+		}
+
+		deliveries = append(deliveries, models.WebhookDelivery{
+			EndpointID:    e.ID,
+			Event:         event,
+			Payload:       string(payload),
+			Status:        models.DeliveryPending,
+			NextAttemptAt: now,
+			Endpoint:      e,
+		})
+	}
+
+	return deliveries, nil
+}
+
+// queueWebhook queues the event <event> with <data> for the background worker. The event has already happened,
+// so a failure is only logged and does not fail the request
+func (m *Repository) queueWebhook(event string, data interface{}) {
+	deliveries, err := m.webhookDeliveries(event, data, m.App.Clock.Now())
+	if err != nil {
+		m.App.ErrorLog.Println("Error queueing webhook", event+":", err)
+		return
+	}
+
+	for _, d := range deliveries {
+		if _, err := m.DB.InsertWebhookDelivery(d); err != nil {
+			m.App.ErrorLog.Println("Error queueing webhook", event, "for", d.Endpoint.URL+":", err)
+		}
+	}
+}
+
+// DeliverWebhooks sends the deliveries that are due. It is run by the background worker
+func (m *Repository) DeliverWebhooks() {
+	deliveries, err := m.DB.GetDueWebhookDeliveries(m.App.Clock.Now(), webhookBatchSize)
+	if err != nil {
+		m.App.ErrorLog.Println("Error reading the due webhooks:", err)
+		return
+	}
+
+	for _, d := range deliveries {
+		d = m.attemptWebhookDelivery(d, m.App.Clock.Now())
+
+		if err := m.DB.UpdateWebhookDelivery(d); err != nil {
+			m.App.ErrorLog.Println("Error updating webhook delivery", d.ID, err)
+		}
+	}
+}
+
+// attemptWebhookDelivery posts the delivery <d> to its endpoint at <now> and returns it with the outcome. A failed
+// delivery is tried again after a backoff, until it has been tried webhooks.MaxAttempts times
+func (m *Repository) attemptWebhookDelivery(d models.WebhookDelivery, now time.Time) models.WebhookDelivery {
+	code, err := webhooks.Send(m.App.HTTPClient, webhooks.Request{
+		URL:        d.Endpoint.URL,
+		Secret:     d.Endpoint.Secret,
+		Event:      d.Event,
+		DeliveryID: d.ID,
+		Payload:    []byte(d.Payload),
+	}, now)
+
+	d.Attempts++
+	d.LastStatusCode = code
+
+	if err == nil {
+		d.Status = models.DeliveryDelivered
+		d.LastError = ""
+		d.DeliveredAt = now
+		return d
+	}
+
+	d.LastError = err.Error()
+	if d.Attempts >= webhooks.MaxAttempts {
+		d.Status = models.DeliveryFailed
+		return d
+	}
+
+	d.Status = models.DeliveryPending
+	d.NextAttemptAt = now.Add(webhooks.Backoff(d.Attempts))
+
+	return d
+}
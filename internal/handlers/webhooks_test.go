@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wagnojunior/booking/internal/models"
+	"github.com/wagnojunior/booking/internal/webhooks"
+)
+
+func TestRepository_WebhookDeliveries(t *testing.T) {
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	res := models.Reservation{ID: 1, Code: "ABCD2345", RoomID: 1, Status: models.ReservationConfirmed}
+
+	deliveries, err := Repo.webhookDeliveries(models.EventReservationCreated, toAPIReservation(res), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only endpoint 1 subscribes to the reservation events
+	if len(deliveries) != 1 || deliveries[0].EndpointID != 1 {
+		t.Fatalf("expected one delivery to endpoint 1 but got %+v", deliveries)
+	}
+
+	d := deliveries[0]
+	if d.Status != models.DeliveryPending || !d.NextAttemptAt.Equal(now) {
+		t.Errorf("expected a pending delivery due now but got %s at %s", d.Status, d.NextAttemptAt)
+	}
+
+	var event struct {
+		Event string         `json:"event"`
+		Data  apiReservation `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(d.Payload), &event); err != nil {
+		t.Fatal(err)
+	}
+
+	if event.Event != models.EventReservationCreated || event.Data.Code != "ABCD2345" {
+		t.Errorf("unexpected payload %s", d.Payload)
+	}
+}
+
+func TestRepository_AttemptWebhookDelivery(t *testing.T) {
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	status := http.StatusOK
+	var received string
+
+	// A local receiver that checks the signature, as the receivers of the deliveries should
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(webhooks.HeaderTimestamp), 10, 64)
+
+		if !webhooks.Verify("whsec_secret", timestamp, body, r.Header.Get(webhooks.HeaderSignature)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		received = string(body)
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	d := models.WebhookDelivery{
+		ID:       1,
+		Event:    models.EventBlockCreated,
+		Payload:  `{"event":"block.created"}`,
+		Status:   models.DeliveryPending,
+		Endpoint: models.WebhookEndpoint{URL: receiver.URL, Secret: "whsec_secret"},
+	}
+
+	delivered := Repo.attemptWebhookDelivery(d, now)
+	if delivered.Status != models.DeliveryDelivered || delivered.Attempts != 1 || !delivered.DeliveredAt.Equal(now) {
+		t.Errorf("expected the delivery to succeed but got %+v", delivered)
+	}
+
+	if received != d.Payload {
+		t.Errorf("expected the receiver to get %s but got %s", d.Payload, received)
+	}
+
+	// A failed delivery is tried again later
+	status = http.StatusServiceUnavailable
+	d.Attempts = 2
+
+	retried := Repo.attemptWebhookDelivery(d, now)
+	if retried.Status != models.DeliveryPending || retried.LastStatusCode != http.StatusServiceUnavailable || retried.LastError == "" {
+		t.Errorf("expected the delivery to be pending with the error but got %+v", retried)
+	}
+
+	if wait := retried.NextAttemptAt.Sub(now); wait != webhooks.Backoff(3) {
+		t.Errorf("expected the next attempt in %s but got %s", webhooks.Backoff(3), wait)
+	}
+
+	// ...until it has been tried too often
+	d.Attempts = webhooks.MaxAttempts - 1
+
+	if failed := Repo.attemptWebhookDelivery(d, now); failed.Status != models.DeliveryFailed {
+		t.Errorf("expected the delivery to be given up but got %s", failed.Status)
+	}
+}
+
+func TestRepository_AdminPostWebhook(t *testing.T) {
+	postedData := url.Values{}
+	postedData.Add("url", "https://example.com/webhooks")
+	postedData.Add("events", models.EventReservationCreated)
+	postedData.Add("events", models.EventBlockCreated)
+
+	req, _ := http.NewRequest("POST", "/admin/webhooks", strings.NewReader(postedData.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminPostWebhook)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/webhooks/3" {
+		t.Errorf("AdminPostWebhook handler returned %d to %q, wanted %d to the new webhook", rr.Code, rr.Header().Get("Location"), http.StatusSeeOther)
+	}
+
+	// test case without events
+	postedData.Del("events")
+	req, _ = http.NewRequest("POST", "/admin/webhooks", strings.NewReader(postedData.Encode()))
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminPostWebhook added a webhook without events: got %d", rr.Code)
+	}
+}
+
+func TestRepository_AdminRetryWebhookDelivery(t *testing.T) {
+	var tests = []struct {
+		name         string
+		id           string
+		expectedCode int
+		expectedMsg  string
+	}{
+		// The endpoint of delivery 1 is down
+		{"endpoint-down", "1", http.StatusSeeOther, "error"},
+		{"unknown-delivery", "9", http.StatusNotFound, ""},
+		{"invalid-id", "x", http.StatusBadRequest, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/webhook-deliveries/"+e.id+"/retry", nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		ctx := getCtx(req)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminRetryWebhookDelivery)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("For %s, expected %d but got %d", e.name, e.expectedCode, rr.Code)
+		}
+
+		if e.expectedMsg != "" && session.GetString(ctx, e.expectedMsg) == "" {
+			t.Errorf("For %s, expected a %s message but got none", e.name, e.expectedMsg)
+		}
+	}
+}
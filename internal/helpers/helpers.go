@@ -6,6 +6,7 @@ import (
 	"runtime/debug"
 
 	"github.com/wagnojunior/booking/internal/config"
+	"github.com/wagnojunior/booking/internal/models"
 )
 
 var app *config.AppConfig
@@ -26,3 +27,13 @@ func ServerError(w http.ResponseWriter, err error) {
 	app.ErrorLog.Println(trace)
 	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 }
+
+// IsAuthenticated checks if the user of the request is logged in
+func IsAuthenticated(r *http.Request) bool {
+	return app.Session.Exists(r.Context(), "user_id")
+}
+
+// IsAdmin checks if the user of the request is logged in as a member of the staff
+func IsAdmin(r *http.Request) bool {
+	return app.Session.GetInt(r.Context(), "access_level") == models.AccessAdmin
+}
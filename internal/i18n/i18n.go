@@ -0,0 +1,180 @@
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultLocale is the locale of the visitors whose language is not supported, and of the messages missing in a catalogue
+const DefaultLocale = "en"
+
+// CookieName is the cookie that holds the locale chosen by the visitor
+const CookieName = "lang"
+
+// Locales are the supported locales, by their language code
+var Locales = []string{"en", "pt", "ja"}
+
+// Names are the names of the supported locales, in their own language
+var Names = map[string]string{
+	"en": "English",
+	"pt": "Português",
+	"ja": "日本語",
+}
+
+// dateLayouts are the layouts of the dates in each locale
+var dateLayouts = map[string]string{
+	"en": "Jan 2, 2006",
+	"pt": "02/01/2006",
+	"ja": "2006年1月2日",
+}
+
+//go:embed locales/*.json
+var files embed.FS
+
+// catalogues holds the messages of each locale, by key
+var catalogues = loadCatalogues()
+
+// loadCatalogues reads the message catalogue of every supported locale from locales/<locale>.json
+func loadCatalogues() map[string]map[string]string {
+	catalogues := make(map[string]map[string]string)
+
+	for _, locale := range Locales {
+		b, err := files.ReadFile("locales/" + locale + ".json")
+		if err != nil {
+			panic(err)
+		}
+
+		messages := make(map[string]string)
+		if err := json.Unmarshal(b, &messages); err != nil {
+			panic(fmt.Sprintf("locales/%s.json: %v", locale, err))
+		}
+
+		catalogues[locale] = messages
+	}
+
+	return catalogues
+}
+
+// Supported checks if <locale> is one of the supported locales
+func Supported(locale string) bool {
+	_, ok := catalogues[locale]
+	return ok
+}
+
+// T returns the message <key> in <locale>, formatted with <args> like fmt.Sprintf. A message missing in the catalogue
+// of the locale is taken from the default locale. A key that is in no catalogue is returned as it is, so that free text
+// (e.g. the reasons given by the pricing rules) passes through untranslated
+func T(locale, key string, args ...interface{}) string {
+	msg, ok := catalogues[locale][key]
+	if !ok {
+		msg, ok = catalogues[DefaultLocale][key]
+	}
+	if !ok {
+		msg = key
+	}
+
+	if len(args) == 0 {
+		return msg
+	}
+
+	return fmt.Sprintf(msg, args...)
+}
+
+// Plural returns the message of the count <n> in <locale>: <key>.one when n is 1, otherwise <key>.other.
+// The messages are formatted with <n>, e.g. "%d nights"
+func Plural(locale, key string, n int) string {
+	if n == 1 {
+		return T(locale, key+".one", n)
+	}
+
+	return T(locale, key+".other", n)
+}
+
+// FormatDate formats the date <t> the way it is written in <locale>
+func FormatDate(locale string, t time.Time) string {
+	layout, ok := dateLayouts[locale]
+	if !ok {
+		layout = dateLayouts[DefaultLocale]
+	}
+
+	return t.Format(layout)
+}
+
+// Negotiate returns the locale of the request <r>: the one chosen by the visitor in the cookie, otherwise the supported
+// language the browser prefers according to Accept-Language, otherwise the default locale
+func Negotiate(r *http.Request) string {
+	if c, err := r.Cookie(CookieName); err == nil && Supported(c.Value) {
+		return c.Value
+	}
+
+	for _, tag := range parseAcceptLanguage(r.Header.Get("Accept-Language")) {
+		// Only the language counts, so that pt-BR and pt-PT both get pt
+		lang, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if Supported(lang) {
+			return lang
+		}
+	}
+
+	return DefaultLocale
+}
+
+// parseAcceptLanguage returns the language tags of the Accept-Language header <header>, the preferred first
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			if f, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64); err == nil {
+				q = f
+			}
+		}
+
+		if q > 0 {
+			tags = append(tags, weighted{tag: tag, q: q})
+		}
+	}
+
+	// Tags of the same weight keep the order of the header
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	result := make([]string, len(tags))
+	for i, t := range tags {
+		result[i] = t.tag
+	}
+
+	return result
+}
+
+// contextKey is the type of the key of the locale in the context of a request
+type contextKey struct{}
+
+// WithLocale returns a copy of <ctx> that carries the locale <locale>
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, contextKey{}, locale)
+}
+
+// FromContext returns the locale carried by <ctx>, or the default locale when there is none
+func FromContext(ctx context.Context) string {
+	if locale, ok := ctx.Value(contextKey{}).(string); ok {
+		return locale
+	}
+
+	return DefaultLocale
+}
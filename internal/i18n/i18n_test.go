@@ -0,0 +1,107 @@
+package i18n
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestT(t *testing.T) {
+	if msg := T("pt", "nav.home"); msg != catalogues["pt"]["nav.home"] {
+		t.Errorf("expected the Portuguese message but got %q", msg)
+	}
+
+	if msg := T("en", "form.min_length", 3); msg != "This field must be at least 3 characters long" {
+		t.Errorf("expected the message to be formatted but got %q", msg)
+	}
+
+	// An unsupported locale falls back to the default one, and free text passes through
+	if msg := T("xx", "nav.home"); msg != catalogues[DefaultLocale]["nav.home"] {
+		t.Errorf("expected the message of the default locale but got %q", msg)
+	}
+
+	if msg := T("pt", "Promo code expired"); msg != "Promo code expired" {
+		t.Errorf("expected free text to pass through but got %q", msg)
+	}
+}
+
+func TestPlural(t *testing.T) {
+	if msg := Plural("en", "nights", 1); msg != "1 night" {
+		t.Errorf("expected the singular but got %q", msg)
+	}
+
+	if msg := Plural("pt", "nights", 3); msg != "3 noites" {
+		t.Errorf("expected the plural but got %q", msg)
+	}
+}
+
+func TestCatalogues(t *testing.T) {
+	for _, locale := range Locales {
+		if _, ok := Names[locale]; !ok {
+			t.Errorf("locale %s has no name", locale)
+		}
+
+		for key := range catalogues[DefaultLocale] {
+			if catalogues[locale][key] == "" {
+				t.Errorf("locale %s misses the message %s", locale, key)
+			}
+		}
+	}
+}
+
+func TestFormatDate(t *testing.T) {
+	date := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	expected := map[string]string{
+		"en": "Mar 1, 2022",
+		"pt": "01/03/2022",
+		"ja": "2022年3月1日",
+		"xx": "Mar 1, 2022",
+	}
+
+	for locale, want := range expected {
+		if got := FormatDate(locale, date); got != want {
+			t.Errorf("for %s, expected %q but got %q", locale, want, got)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	var tests = []struct {
+		name           string
+		cookie         string
+		acceptLanguage string
+		expected       string
+	}{
+		{"nothing", "", "", "en"},
+		{"cookie", "ja", "pt-BR", "ja"},
+		{"unsupported-cookie", "xx", "pt-BR", "pt"},
+		{"region", "", "pt-BR,pt;q=0.9,en;q=0.8", "pt"},
+		{"weights", "", "en;q=0.5, ja;q=0.8", "ja"},
+		{"unsupported-language", "", "de-DE,fr;q=0.9", "en"},
+		{"refused-language", "", "ja;q=0, pt;q=0.1", "pt"},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/", nil)
+		if e.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: CookieName, Value: e.cookie})
+		}
+		req.Header.Set("Accept-Language", e.acceptLanguage)
+
+		if locale := Negotiate(req); locale != e.expected {
+			t.Errorf("for %s, expected %s but got %s", e.name, e.expected, locale)
+		}
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if locale := FromContext(context.Background()); locale != DefaultLocale {
+		t.Errorf("expected the default locale but got %s", locale)
+	}
+
+	if locale := FromContext(WithLocale(context.Background(), "pt")); locale != "pt" {
+		t.Errorf("expected pt but got %s", locale)
+	}
+}
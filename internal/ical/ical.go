@@ -0,0 +1,90 @@
+package ical
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wagnojunior/booking/internal/models"
+	"github.com/wagnojunior/booking/internal/property"
+)
+
+// ContentType is the media type of an iCalendar feed
+const ContentType = "text/calendar; charset=utf-8"
+
+// Formats of the dates of all-day events and of the timestamps
+const (
+	dateFormat      = "20060102"
+	timestampFormat = "20060102T150405Z"
+)
+
+// Feed returns the RFC 5545 calendar of the <restrictions> of <room>. Every restriction is an all-day event whose
+// UID is built from the ID of the restriction and <domain>, so it stays the same across downloads. The calendar is in
+// the time zone of the property <p>, and the reservations tell its check-in and check-out times
+func Feed(room models.Room, restrictions []models.RoomRestriction, domain string, p property.Settings) string {
+	var b strings.Builder
+
+	writeLine(&b, "BEGIN:VCALENDAR")
+	writeLine(&b, "VERSION:2.0")
+	writeLine(&b, "PRODID:-//"+domain+"//Booking//EN")
+	writeLine(&b, "CALSCALE:GREGORIAN")
+	writeLine(&b, "METHOD:PUBLISH")
+	writeLine(&b, "X-WR-CALNAME:"+escape(room.RoomName))
+	writeLine(&b, "X-WR-TIMEZONE:"+p.Location().String())
+
+	for _, rr := range restrictions {
+		writeLine(&b, "BEGIN:VEVENT")
+		writeLine(&b, fmt.Sprintf("UID:room-restriction-%d@%s", rr.ID, domain))
+		writeLine(&b, "DTSTAMP:"+rr.UpdatedAt.UTC().Format(timestampFormat))
+		writeLine(&b, "DTSTART;VALUE=DATE:"+rr.StartDate.Format(dateFormat))
+		// The end date of an all-day event is exclusive, just like the departure date
+		writeLine(&b, "DTEND;VALUE=DATE:"+rr.EndDate.Format(dateFormat))
+		writeLine(&b, "SUMMARY:"+escape(Summary(rr)))
+		if rr.ReservationID != 0 {
+			writeLine(&b, "DESCRIPTION:"+escape(fmt.Sprintf("Check-in from %s, check-out until %s", p.CheckIn, p.CheckOut)))
+		}
+		writeLine(&b, "TRANSP:OPAQUE")
+		writeLine(&b, "END:VEVENT")
+	}
+
+	writeLine(&b, "END:VCALENDAR")
+
+	return b.String()
+}
+
+// Summary returns the title of the event of the restriction <rr>, e.g. "Reservation: John Smith" or "Owner Block"
+func Summary(rr models.RoomRestriction) string {
+	name := strings.TrimSpace(rr.Reservation.FirstName + " " + rr.Reservation.LastName)
+	if rr.ReservationID == 0 || name == "" {
+		return rr.Restriction.RestrictionName
+	}
+
+	return rr.Restriction.RestrictionName + ": " + name
+}
+
+// writeLine writes a content line, folded so that no line is longer than 75 octets
+func writeLine(b *strings.Builder, line string) {
+	limit := 75
+	for len(line) > limit {
+		// Do not split a multi-byte character
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+
+		// The leading space of the continuation lines counts towards their length
+		limit = 74
+	}
+
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
+
+// escape escapes the characters that have a meaning in a text value
+func escape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return r.Replace(s)
+}
@@ -0,0 +1,285 @@
+package ical
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wagnojunior/booking/internal/models"
+	"github.com/wagnojunior/booking/internal/property"
+)
+
+func TestFeed(t *testing.T) {
+	start := time.Date(2022, 3, 10, 0, 0, 0, 0, time.UTC)
+	restrictions := []models.RoomRestriction{
+		{
+			ID:            7,
+			StartDate:     start,
+			EndDate:       start.AddDate(0, 0, 2),
+			ReservationID: 3,
+			Reservation:   models.Reservation{FirstName: "John", LastName: "Smith, Jr"},
+			Restriction:   models.Restriction{RestrictionName: "Reservation"},
+			UpdatedAt:     start,
+		},
+		{
+			ID:          8,
+			StartDate:   start.AddDate(0, 0, 5),
+			EndDate:     start.AddDate(0, 0, 6),
+			Restriction: models.Restriction{RestrictionName: "Owner Block"},
+		},
+	}
+
+	seoul, err := time.LoadLocation("Asia/Seoul")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+	p := property.Settings{TimeZone: seoul, CheckIn: property.TimeOfDay{Hour: 14}, CheckOut: property.TimeOfDay{Hour: 11}}
+
+	feed := Feed(models.Room{RoomName: "Panda Suite"}, restrictions, "example.com", p)
+
+	for _, s := range []string{
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\n",
+		"UID:room-restriction-7@example.com\r\n",
+		"DTSTART;VALUE=DATE:20220310\r\nDTEND;VALUE=DATE:20220312\r\n",
+		"X-WR-TIMEZONE:Asia/Seoul\r\n",
+		"SUMMARY:Reservation: John Smith\\, Jr\r\nDESCRIPTION:Check-in from 14:00\\, check-out until 11:00\r\n",
+		"UID:room-restriction-8@example.com\r\n",
+		"SUMMARY:Owner Block\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(feed, s) {
+			t.Errorf("expected the feed to contain %q", s)
+		}
+	}
+
+	if strings.Count(feed, "DESCRIPTION:") != 1 {
+		t.Error("expected only the reservation to tell the check-in and check-out times")
+	}
+
+	// The same restrictions give the same feed
+	if feed != Feed(models.Room{RoomName: "Panda Suite"}, restrictions, "example.com", p) {
+		t.Error("expected the feed to be stable")
+	}
+}
+
+func TestWriteLine(t *testing.T) {
+	var b strings.Builder
+	writeLine(&b, "SUMMARY:"+strings.Repeat("é", 80))
+
+	for _, line := range strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("expected lines of at most 75 octets but got %d", len(line))
+		}
+	}
+
+	unfolded := strings.ReplaceAll(b.String(), "\r\n ", "")
+	if unfolded != "SUMMARY:"+strings.Repeat("é", 80)+"\r\n" {
+		t.Error("expected the folded line to unfold to the original")
+	}
+}
+
+// testNow is when the test calendars are imported
+var testNow = time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+
+const testCalendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:abc@other.com\r\n" +
+	"DTSTART;VALUE=DATE:20220310\r\n" +
+	"DTEND;VALUE=DATE:20220312\r\n" +
+	"SUMMARY:Reserved\\, thank\r\n" +
+	"  you\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:def@other.com\r\n" +
+	"DTSTART:20220315T140000Z\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:ghi@other.com\r\n" +
+	"DTSTART;VALUE=DATE:20220320\r\n" +
+	"STATUS:CANCELLED\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParse(t *testing.T) {
+	cal, err := Parse(strings.NewReader(testCalendar), time.UTC, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := cal.Events
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events but got %d", len(events))
+	}
+
+	if events[0].UID != "abc@other.com" || events[0].Summary != "Reserved, thank you" ||
+		!events[0].Start.Equal(date("2022-03-10")) || !events[0].End.Equal(date("2022-03-12")) {
+		t.Errorf("unexpected first event %+v", events[0])
+	}
+
+	// An event without an end lasts one day
+	if !events[1].Start.Equal(date("2022-03-15")) || !events[1].End.Equal(date("2022-03-16")) {
+		t.Errorf("unexpected second event %+v", events[1])
+	}
+
+	// 14:00 UTC on the 15th is already the 16th at UTC+11
+	cal, err = Parse(strings.NewReader(testCalendar), time.FixedZone("UTC+11", 11*60*60), testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events = cal.Events
+	if !events[1].Start.Equal(date("2022-03-16")) || !events[0].Start.Equal(date("2022-03-10")) {
+		t.Errorf("expected the times to be converted to the days in the time zone but got %+v", events)
+	}
+
+	if _, err := Parse(strings.NewReader("<html></html>"), time.UTC, testNow); err == nil {
+		t.Error("expected an error for a file that is not a calendar")
+	}
+}
+
+const recurringCalendar = "BEGIN:VCALENDAR\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:weekly@other.com\r\n" +
+	"DTSTART;VALUE=DATE:20220214\r\n" +
+	"DTEND;VALUE=DATE:20220216\r\n" +
+	"RRULE:FREQ=WEEKLY;COUNT=6\r\n" +
+	"EXDATE;VALUE=DATE:20220307\r\n" +
+	"RDATE;VALUE=DATE:20220401\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:weekly@other.com\r\n" +
+	"RECURRENCE-ID;VALUE=DATE:20220314\r\n" +
+	"DTSTART;VALUE=DATE:20220315\r\n" +
+	"DTEND;VALUE=DATE:20220318\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:monthly@other.com\r\n" +
+	"DTSTART;VALUE=DATE:20220131\r\n" +
+	"RRULE:FREQ=MONTHLY;UNTIL=20220601\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:days@other.com\r\n" +
+	"DTSTART;VALUE=DATE:20220301\r\n" +
+	"RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,SA;COUNT=4\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:nth@other.com\r\n" +
+	"DTSTART;VALUE=DATE:20220307\r\n" +
+	"RRULE:FREQ=MONTHLY;BYDAY=1MO\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParse_Recurring(t *testing.T) {
+	cal, err := Parse(strings.NewReader(recurringCalendar), time.UTC, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]string)
+	for _, e := range cal.Events {
+		got[e.UID] = e.Start.Format("2006-01-02") + "/" + e.End.Format("2006-01-02")
+	}
+
+	expected := map[string]string{
+		// The occurrences that ended before now are left out, the 7th is excluded, the 14th is moved and the
+		// 1st of April is added
+		"weekly@other.com/20220228": "2022-02-28/2022-03-02",
+		"weekly@other.com/20220314": "2022-03-15/2022-03-18",
+		"weekly@other.com/20220321": "2022-03-21/2022-03-23",
+		"weekly@other.com/20220401": "2022-04-01/2022-04-03",
+		// The months without a 31st are skipped
+		"monthly@other.com/20220331": "2022-03-31/2022-04-01",
+		"monthly@other.com/20220531": "2022-05-31/2022-06-01",
+		// Every other week, on Tuesdays and Saturdays
+		"days@other.com/20220301": "2022-03-01/2022-03-02",
+		"days@other.com/20220305": "2022-03-05/2022-03-06",
+		"days@other.com/20220315": "2022-03-15/2022-03-16",
+		"days@other.com/20220319": "2022-03-19/2022-03-20",
+		// The rules that are not supported keep their first occurrence
+		"nth@other.com/20220307": "2022-03-07/2022-03-08",
+	}
+
+	if len(got) != len(expected) {
+		t.Errorf("expected %d events but got %v", len(expected), got)
+	}
+	for uid, dates := range expected {
+		if got[uid] != dates {
+			t.Errorf("for %s, expected %s but got %q", uid, dates, got[uid])
+		}
+	}
+
+	if len(cal.Warnings) != 1 || !strings.Contains(cal.Warnings[0], "nth@other.com") {
+		t.Errorf("expected a warning for the rule that is not supported but got %v", cal.Warnings)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/calendar.ics" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(testCalendar))
+	}))
+	defer ts.Close()
+
+	cal, err := Fetch(ts.Client(), ts.URL+"/calendar.ics", time.UTC, testNow)
+	if err != nil || len(cal.Events) != 2 {
+		t.Errorf("expected 2 events but got %d (%v)", len(cal.Events), err)
+	}
+
+	if _, err := Fetch(ts.Client(), ts.URL+"/missing.ics", time.UTC, testNow); err == nil {
+		t.Error("expected an error for a missing calendar")
+	}
+
+	// A local file stands in for the calendar of another channel
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "calendar.ics"), []byte(testCalendar), 0644)
+
+	transport := &http.Transport{}
+	transport.RegisterProtocol("file", http.NewFileTransport(http.Dir(dir)))
+
+	cal, err = Fetch(&http.Client{Transport: transport}, "file:///calendar.ics", time.UTC, testNow)
+	if err != nil || len(cal.Events) != 2 {
+		t.Errorf("expected 2 events from the file but got %d (%v)", len(cal.Events), err)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	imp := models.ICalImport{ID: 4, RoomID: 1}
+	existing := []models.RoomRestriction{
+		{ID: 1, ExternalUID: "same", StartDate: date("2022-03-01"), EndDate: date("2022-03-03")},
+		{ID: 2, ExternalUID: "moved", StartDate: date("2022-03-05"), EndDate: date("2022-03-07")},
+		{ID: 3, ExternalUID: "gone", StartDate: date("2022-03-10"), EndDate: date("2022-03-12")},
+	}
+	events := []Event{
+		{UID: "same", Start: date("2022-03-01"), End: date("2022-03-03")},
+		{UID: "moved", Start: date("2022-03-06"), End: date("2022-03-08")},
+		{UID: "new", Start: date("2022-03-20"), End: date("2022-03-22")},
+		{UID: "new", Start: date("2022-04-20"), End: date("2022-04-22")},
+	}
+
+	changes := Reconcile(imp, existing, events)
+
+	if len(changes.Insert) != 1 || changes.Insert[0].ExternalUID != "new" || changes.Insert[0].ICalImportID != 4 ||
+		changes.Insert[0].RoomID != 1 || changes.Insert[0].RestrictionID != models.RestrictionExternal {
+		t.Errorf("unexpected inserts %+v", changes.Insert)
+	}
+
+	if len(changes.Update) != 1 || changes.Update[0].ID != 2 || !changes.Update[0].StartDate.Equal(date("2022-03-06")) {
+		t.Errorf("unexpected updates %+v", changes.Update)
+	}
+
+	if len(changes.Delete) != 1 || changes.Delete[0] != 3 {
+		t.Errorf("unexpected deletes %v", changes.Delete)
+	}
+}
+
+func date(s string) time.Time {
+	d, _ := time.Parse("2006-01-02", s)
+	return d
+}
@@ -0,0 +1,222 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Event is an event of an imported calendar. Start and End are dates, End is exclusive
+type Event struct {
+	UID     string
+	Start   time.Time
+	End     time.Time
+	Summary string
+}
+
+// Calendar holds the events of an imported calendar
+type Calendar struct {
+	Events   []Event
+	Warnings []string // What of the calendar was left out, e.g. the recurrences that are not supported
+}
+
+// vevent is a VEVENT of a calendar as it is read, before its recurrences are expanded
+type vevent struct {
+	Event
+	cancelled    bool
+	rule         string      // The RRULE, empty when the event does not repeat
+	rdates       []time.Time // The dates of the extra occurrences
+	exdates      []time.Time // The dates of the occurrences that are left out
+	recurrenceID time.Time   // The date of the occurrence that this event replaces. Zero for the event itself
+}
+
+// Fetch downloads the calendar at <url> with <client> and parses its events, whose times are converted to the days
+// in the time zone <loc>. Recurring events are expanded around <now>, as Parse does
+func Fetch(client *http.Client, url string, loc *time.Location, now time.Time) (Calendar, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return Calendar{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Calendar{}, fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+
+	return Parse(io.LimitReader(resp.Body, 10<<20), loc, now)
+}
+
+// Parse reads the events of an RFC 5545 calendar. Cancelled events and events without a UID or a start are
+// left out. An event without an end lasts one day. The times of the events are converted to the days in the time
+// zone <loc>, usually the one of the property. Recurring events (RRULE, RDATE, EXDATE and the occurrences replaced
+// with RECURRENCE-ID) are expanded into one event per occurrence from <now> until recurrenceHorizon after it, each
+// with the UID of the event followed by the date of the occurrence
+func Parse(r io.Reader, loc *time.Location, now time.Time) (Calendar, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return Calendar{}, err
+	}
+
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return Calendar{}, errors.New("not an iCalendar file")
+	}
+
+	var cal Calendar
+	var events []vevent
+	var event *vevent
+
+	for _, line := range lines {
+		name, params, value := splitLine(line)
+
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			event = &vevent{}
+		case name == "END" && strings.EqualFold(value, "VEVENT") && event != nil:
+			if event.UID != "" && !event.Start.IsZero() {
+				if !event.End.After(event.Start) {
+					event.End = event.Start.AddDate(0, 0, 1)
+				}
+				events = append(events, *event)
+			}
+			event = nil
+		case event == nil:
+			continue
+		case name == "UID":
+			event.UID = value
+		case name == "SUMMARY":
+			event.Summary = unescape(value)
+		case name == "STATUS":
+			event.cancelled = strings.EqualFold(value, "CANCELLED")
+		case name == "DTSTART":
+			event.Start, err = parseDate(params, value, loc)
+			if err != nil {
+				return Calendar{}, err
+			}
+		case name == "DTEND":
+			event.End, err = parseDate(params, value, loc)
+			if err != nil {
+				return Calendar{}, err
+			}
+		case name == "RRULE":
+			event.rule = value
+		case name == "RECURRENCE-ID":
+			event.recurrenceID, err = parseDate(params, value, loc)
+			if err != nil {
+				return Calendar{}, err
+			}
+		case name == "RDATE" || name == "EXDATE":
+			// Periods have an end of their own, which the occurrences of an event cannot have here
+			if strings.Contains(strings.ToUpper(params), "VALUE=PERIOD") {
+				cal.Warnings = append(cal.Warnings, fmt.Sprintf("the %s periods of the event %s are not supported and were left out", name, event.UID))
+				continue
+			}
+
+			for _, v := range strings.Split(value, ",") {
+				d, err := parseDate(params, v, loc)
+				if err != nil {
+					return Calendar{}, err
+				}
+
+				if name == "RDATE" {
+					event.rdates = append(event.rdates, d)
+				} else {
+					event.exdates = append(event.exdates, d)
+				}
+			}
+		}
+	}
+
+	if loc == nil {
+		loc = time.UTC
+	}
+	cal.Events, cal.Warnings = expand(events, loc, now, cal.Warnings)
+
+	return cal, nil
+}
+
+// unfold reads the content lines of a calendar, joining the folded lines
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, scanner.Err()
+}
+
+// splitLine splits a content line such as DTSTART;VALUE=DATE:20220310 into its upper case name, its parameters
+// and its value
+func splitLine(line string) (string, string, string) {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return strings.ToUpper(line), "", ""
+	}
+
+	name, params, _ := strings.Cut(line[:colon], ";")
+
+	return strings.ToUpper(name), params, line[colon+1:]
+}
+
+// parseDate parses the value of DTSTART, DTEND, RECURRENCE-ID, RDATE or EXDATE into a date. Date-times are converted to the date in the time zone
+// <loc>. Floating date-times are in the time zone of their TZID parameter when it is known, and in <loc> otherwise
+func parseDate(params, value string, loc *time.Location) (time.Time, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	if len(value) == 8 {
+		return time.Parse("20060102", value)
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		if err != nil {
+			return t, err
+		}
+		return truncate(t.In(loc)), nil
+	}
+
+	zone := loc
+	for _, param := range strings.Split(params, ";") {
+		if strings.HasPrefix(param, "TZID=") {
+			if l, err := time.LoadLocation(strings.Trim(param[len("TZID="):], `"`)); err == nil {
+				zone = l
+			}
+		}
+	}
+
+	t, err := time.ParseInLocation("20060102T150405", value, zone)
+	if err != nil {
+		return t, err
+	}
+
+	return truncate(t.In(loc)), nil
+}
+
+// truncate returns the date of <t>, at midnight UTC
+func truncate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// unescape reverts the escaping of a text value
+func unescape(s string) string {
+	r := strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+	return r.Replace(s)
+}
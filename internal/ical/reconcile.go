@@ -0,0 +1,60 @@
+package ical
+
+import (
+	"github.com/wagnojunior/booking/internal/models"
+)
+
+// Changes are the changes that bring the restrictions of a calendar import in line with the calendar
+type Changes struct {
+	Insert []models.RoomRestriction
+	Update []models.RoomRestriction
+	Delete []int // IDs of the restrictions to delete
+}
+
+// Reconcile compares the <existing> restrictions of the calendar import <imp> with the <events> of the calendar,
+// matching them by UID. New events are inserted, moved events are updated and vanished events are deleted
+func Reconcile(imp models.ICalImport, existing []models.RoomRestriction, events []Event) Changes {
+	var changes Changes
+
+	byUID := make(map[string]models.RoomRestriction)
+	for _, rr := range existing {
+		byUID[rr.ExternalUID] = rr
+	}
+
+	seen := make(map[string]bool)
+	for _, event := range events {
+		// The occurrences of the recurring events have UIDs of their own, so a repeated UID is a mistake of the
+		// calendar. Only its first event is kept
+		if seen[event.UID] {
+			continue
+		}
+		seen[event.UID] = true
+
+		rr, ok := byUID[event.UID]
+		if !ok {
+			changes.Insert = append(changes.Insert, models.RoomRestriction{
+				StartDate:     event.Start,
+				EndDate:       event.End,
+				RoomID:        imp.RoomID,
+				RestrictionID: models.RestrictionExternal,
+				ICalImportID:  imp.ID,
+				ExternalUID:   event.UID,
+			})
+			continue
+		}
+
+		if !rr.StartDate.Equal(event.Start) || !rr.EndDate.Equal(event.End) {
+			rr.StartDate = event.Start
+			rr.EndDate = event.End
+			changes.Update = append(changes.Update, rr)
+		}
+	}
+
+	for _, rr := range existing {
+		if !seen[rr.ExternalUID] {
+			changes.Delete = append(changes.Delete, rr.ID)
+		}
+	}
+
+	return changes
+}
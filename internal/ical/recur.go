@@ -0,0 +1,241 @@
+package ical
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	recurrenceHorizon = 2     // Years after now until which the recurring events are expanded
+	maxIterations     = 50000 // Most candidate dates looked at for a recurrence rule, however far it goes
+)
+
+// weekdays are the days of the week by their code in the recurrence rules
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// rule is a recurrence rule (RRULE). Only the rules that repeat an event every few days, weeks, months or years are
+// supported, and the weekly ones on some days of the week (BYDAY). The other BYxxx parts are not
+type rule struct {
+	freq      string
+	interval  int
+	count     int       // 0 means no limit
+	until     time.Time // Date of the last occurrence. Zero means no limit
+	byDay     map[time.Weekday]bool
+	weekStart time.Weekday
+}
+
+// parseRule parses the value of an RRULE, whose UNTIL is converted to the date in the time zone <loc>
+func parseRule(value string, loc *time.Location) (rule, error) {
+	r := rule{interval: 1, weekStart: time.Monday}
+
+	for _, part := range strings.Split(value, ";") {
+		name, v, _ := strings.Cut(part, "=")
+
+		var err error
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			r.freq = strings.ToUpper(v)
+		case "INTERVAL":
+			r.interval, err = strconv.Atoi(v)
+			if err == nil && r.interval < 1 {
+				err = fmt.Errorf("INTERVAL=%s", v)
+			}
+		case "COUNT":
+			r.count, err = strconv.Atoi(v)
+			if err == nil && r.count < 1 {
+				err = fmt.Errorf("COUNT=%s", v)
+			}
+		case "UNTIL":
+			r.until, err = parseDate("", v, loc)
+		case "BYDAY":
+			r.byDay = make(map[time.Weekday]bool)
+			for _, day := range strings.Split(strings.ToUpper(v), ",") {
+				wd, ok := weekdays[day]
+				if !ok {
+					return r, fmt.Errorf("BYDAY=%s is not supported", v)
+				}
+				r.byDay[wd] = true
+			}
+		case "WKST":
+			wd, ok := weekdays[strings.ToUpper(v)]
+			if !ok {
+				err = fmt.Errorf("WKST=%s", v)
+			}
+			r.weekStart = wd
+		default:
+			return r, fmt.Errorf("%s is not supported", name)
+		}
+
+		if err != nil {
+			return r, err
+		}
+	}
+
+	switch r.freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	default:
+		return r, fmt.Errorf("FREQ=%s is not supported", r.freq)
+	}
+
+	if r.byDay != nil && r.freq != "WEEKLY" {
+		return r, fmt.Errorf("BYDAY with FREQ=%s is not supported", r.freq)
+	}
+
+	return r, nil
+}
+
+// dates returns the dates of the occurrences of the rule for an event that starts on <start>, before <end>
+func (r rule) dates(start, end time.Time) []time.Time {
+	var dates []time.Time
+
+	for i := 0; i < maxIterations; i++ {
+		d, ok := r.candidate(start, i)
+
+		if !d.Before(end) || (!r.until.IsZero() && d.After(r.until)) {
+			break
+		}
+
+		if !ok {
+			continue
+		}
+
+		dates = append(dates, d)
+		if len(dates) == r.count {
+			break
+		}
+	}
+
+	return dates
+}
+
+// candidate returns the <i>th date looked at for an event that starts on <start>, and whether it is an occurrence
+func (r rule) candidate(start time.Time, i int) (time.Time, bool) {
+	switch {
+	case r.freq == "DAILY":
+		return start.AddDate(0, 0, i*r.interval), true
+	case r.freq == "WEEKLY" && r.byDay == nil:
+		return start.AddDate(0, 0, 7*i*r.interval), true
+	case r.freq == "WEEKLY":
+		// Every day is looked at, and kept on the days of the weeks that repeat. The start is always an occurrence
+		d := start.AddDate(0, 0, i)
+		weeks := int(r.weekOf(d).Sub(r.weekOf(start)).Hours()) / (7 * 24)
+		return d, i == 0 || (r.byDay[d.Weekday()] && weeks%r.interval == 0)
+	case r.freq == "MONTHLY":
+		// The months without the day of the start, e.g. the 31st, are skipped
+		d := start.AddDate(0, i*r.interval, 0)
+		return d, d.Day() == start.Day()
+	default:
+		d := start.AddDate(i*r.interval, 0, 0)
+		return d, d.Month() == start.Month() && d.Day() == start.Day()
+	}
+}
+
+// weekOf returns the first day of the week of <d>
+func (r rule) weekOf(d time.Time) time.Time {
+	return d.AddDate(0, 0, -((int(d.Weekday()) - int(r.weekStart) + 7) % 7))
+}
+
+// occurrenceUID returns the UID of the occurrence on <date> of the recurring event <uid>
+func occurrenceUID(uid string, date time.Time) string {
+	return uid + "/" + date.Format("20060102")
+}
+
+// expand turns the <events> read from a calendar into the events to import, with one event per occurrence of the
+// recurring ones between <now> and recurrenceHorizon after it. The rules that cannot be expanded are added to
+// <warnings>, and only the start and the RDATEs of their event are imported
+func expand(events []vevent, loc *time.Location, now time.Time, warnings []string) ([]Event, []string) {
+	from := truncate(now.In(loc))
+	until := from.AddDate(recurrenceHorizon, 0, 0)
+
+	// The events that replace an occurrence of a recurring event, by UID and date of the occurrence
+	replaced := make(map[string]map[time.Time]vevent)
+	for _, e := range events {
+		if !e.recurrenceID.IsZero() {
+			if replaced[e.UID] == nil {
+				replaced[e.UID] = make(map[time.Time]vevent)
+			}
+			replaced[e.UID][e.recurrenceID] = e
+		}
+	}
+
+	var out []Event
+	recurring := make(map[string]bool)
+
+	for _, e := range events {
+		if !e.recurrenceID.IsZero() {
+			continue
+		}
+
+		if e.rule == "" && len(e.rdates) == 0 {
+			if !e.cancelled {
+				out = append(out, e.Event)
+			}
+			continue
+		}
+
+		recurring[e.UID] = true
+		if e.cancelled {
+			continue
+		}
+
+		dates := []time.Time{e.Start}
+		if e.rule != "" {
+			r, err := parseRule(e.rule, loc)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("the recurrence rule %s of the event %s cannot be expanded (%v), "+
+					"so only its first occurrence was imported", e.rule, e.UID, err))
+			} else {
+				dates = r.dates(e.Start, until)
+			}
+		}
+
+		dates = append(dates, e.rdates...)
+		sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+
+		skip := make(map[time.Time]bool)
+		for _, d := range e.exdates {
+			skip[d] = true
+		}
+
+		length := e.End.Sub(e.Start)
+		for _, d := range dates {
+			if skip[d] {
+				continue
+			}
+			skip[d] = true
+
+			occurrence := Event{UID: occurrenceUID(e.UID, d), Start: d, End: d.Add(length), Summary: e.Summary}
+			if r, ok := replaced[e.UID][d]; ok {
+				if r.cancelled {
+					continue
+				}
+				occurrence.Start, occurrence.End, occurrence.Summary = r.Start, r.End, r.Summary
+			}
+
+			if occurrence.End.After(from) && occurrence.Start.Before(until) {
+				out = append(out, occurrence)
+			}
+		}
+	}
+
+	// The occurrences whose recurring event is not in the calendar are imported on their own
+	for _, e := range events {
+		if !e.recurrenceID.IsZero() && !recurring[e.UID] && !e.cancelled {
+			e.UID = occurrenceUID(e.UID, e.recurrenceID)
+			out = append(out, e.Event)
+		}
+	}
+
+	return out, warnings
+}
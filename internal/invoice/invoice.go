@@ -0,0 +1,150 @@
+package invoice
+
+import (
+	"fmt"
+
+	"github.com/wagnojunior/booking/internal/models"
+	"github.com/wagnojunior/booking/internal/pricing"
+)
+
+// Layout of the pages, in points
+const (
+	marginLeft   = 50.0
+	marginRight  = pageWidth - 50.0
+	marginTop    = pageHeight - 60.0
+	marginBottom = 60.0
+	lineHeight   = 16.0
+)
+
+// FormatNumber formats the number of an invoice, e.g. 42 -> INV-000042
+func FormatNumber(n int) string {
+	return fmt.Sprintf("INV-%06d", n)
+}
+
+// FileName returns the name of the PDF file of the invoice <inv>
+func FileName(inv models.Invoice) string {
+	return FormatNumber(inv.Number) + ".pdf"
+}
+
+// Render renders the invoice <inv> of the reservation <res>, issued by <issuer>, as a PDF document.
+// The captured and refunded <payments> are listed, so the invoice doubles as a receipt
+func Render(issuer string, inv models.Invoice, res models.Reservation, payments []models.Payment) []byte {
+	w := &writer{}
+	w.doc.newPage()
+	w.y = marginTop
+
+	price := res.Price
+	money := func(amount int) string {
+		return pricing.FormatAmount(amount, price.Currency)
+	}
+
+	w.doc.text(marginLeft, w.y, fontBold, 18, issuer)
+	w.doc.textRight(marginRight, w.y, 12, FormatNumber(inv.Number))
+	w.y -= 24
+	w.doc.text(marginLeft, w.y, fontRegular, 10, "Invoice date: "+inv.CreatedAt.Format("2006-01-02"))
+	w.y -= 2 * lineHeight
+
+	w.doc.text(marginLeft, w.y, fontBold, 11, "Billed to")
+	w.y -= lineHeight
+	w.row(res.FirstName+" "+res.LastName, "")
+	w.row(res.Email, "")
+	if res.Phone != "" {
+		w.row(res.Phone, "")
+	}
+	w.y -= lineHeight
+
+	w.doc.text(marginLeft, w.y, fontBold, 11, "Reservation")
+	w.y -= lineHeight
+	w.row(fmt.Sprintf("Reservation number: %d", res.ID), "")
+	w.row("Room: "+res.Room.RoomName, "")
+	w.row(fmt.Sprintf("Stay: %s to %s, %d guest(s)", res.StartDate.Format("2006-01-02"), res.EndDate.Format("2006-01-02"), res.Guests), "")
+	w.y -= lineHeight
+
+	w.heading("Description", "Amount")
+	for _, night := range price.Nights {
+		w.row(fmt.Sprintf("Night of %s (%s)", night.Date.Format("2006-01-02"), night.RateName), money(night.Amount))
+	}
+	if price.Discount > 0 {
+		w.row("Discount ("+price.PromoCode+")", money(-price.Discount))
+	}
+	for _, line := range price.Lines {
+		w.row(line.Name, money(line.Amount))
+	}
+	w.rule()
+	w.total("Total", money(price.Total))
+	w.y -= lineHeight
+
+	// Refunded payments were collected first, the refund itself is kept on the reservation
+	paid := 0
+	w.heading("Payments", "Amount")
+	for _, payment := range payments {
+		if payment.Status != models.PaymentCaptured && payment.Status != models.PaymentRefunded &&
+			payment.Status != models.PaymentPartiallyRefunded {
+			continue
+		}
+
+		paid += payment.Amount
+		w.row(fmt.Sprintf("%s payment %s", payment.CreatedAt.Format("2006-01-02"), payment.ProviderRef), money(payment.Amount))
+	}
+	if res.RefundAmount > 0 {
+		paid -= res.RefundAmount
+		w.row("Refund on "+res.CancelledAt.Format("2006-01-02"), money(-res.RefundAmount))
+	}
+	w.rule()
+	w.total("Amount paid", money(paid))
+
+	if res.Status != models.ReservationCancelled {
+		w.total("Balance due", money(price.Total-paid))
+	}
+
+	if res.CancellationSummary != "" {
+		w.y -= lineHeight
+		w.row("Cancellation policy: "+res.CancellationSummary, "")
+	}
+
+	return w.doc.bytes()
+}
+
+// writer lays out the rows of an invoice from the top of the page down, starting new pages as needed
+type writer struct {
+	doc document
+	y   float64
+}
+
+// next moves down one line, or to the top of a new page when the current one is full
+func (w *writer) next() {
+	w.y -= lineHeight
+	if w.y < marginBottom {
+		w.doc.newPage()
+		w.y = marginTop
+	}
+}
+
+// row writes a line with a <label> on the left and an <amount> on the right
+func (w *writer) row(label, amount string) {
+	w.doc.text(marginLeft, w.y, fontRegular, 10, label)
+	if amount != "" {
+		w.doc.textRight(marginRight, w.y, 10, amount)
+	}
+	w.next()
+}
+
+// heading writes the underlined heading of a table
+func (w *writer) heading(label, amount string) {
+	w.doc.text(marginLeft, w.y, fontBold, 11, label)
+	w.doc.text(marginRight-45, w.y, fontBold, 11, amount)
+	w.doc.line(marginLeft, w.y-4, marginRight, w.y-4)
+	w.next()
+}
+
+// total writes a line in bold
+func (w *writer) total(label, amount string) {
+	w.doc.text(marginLeft, w.y, fontBold, 10, label)
+	w.doc.textRight(marginRight, w.y, 10, amount)
+	w.next()
+}
+
+// rule draws a line above the next row
+func (w *writer) rule() {
+	w.doc.line(marginLeft, w.y+lineHeight-4, marginRight, w.y+lineHeight-4)
+}
@@ -0,0 +1,91 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/wagnojunior/booking/internal/models"
+)
+
+func TestFormatNumber(t *testing.T) {
+	if s := FormatNumber(42); s != "INV-000042" {
+		t.Errorf("expected INV-000042 but got %s", s)
+	}
+}
+
+func TestRender(t *testing.T) {
+	start := time.Date(2022, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	res := models.Reservation{
+		ID:        7,
+		FirstName: "John",
+		LastName:  "Smith (Jr)",
+		Email:     "john@smith.com",
+		StartDate: start,
+		EndDate:   start.AddDate(0, 0, 2),
+		Guests:    2,
+		Room:      models.Room{RoomName: "Panda Suite"},
+		Price: models.PriceQuote{
+			Currency: "USD",
+			Nights: []models.NightlyPrice{
+				{Date: start, RateName: "Base", Amount: 12000},
+				{Date: start.AddDate(0, 0, 1), RateName: "Weekend", Amount: 15000},
+			},
+			Lines: []models.PriceLine{{Name: "Cleaning fee", Amount: 3000}},
+			Total: 30000,
+		},
+	}
+	payments := []models.Payment{
+		{ProviderRef: "fake_1", Amount: 30000, Currency: "USD", Status: models.PaymentCaptured},
+		{ProviderRef: "fake_2", Amount: 30000, Currency: "USD", Status: models.PaymentFailed},
+	}
+	inv := models.Invoice{Number: 42, ReservationID: 7, CreatedAt: start}
+
+	pdf := Render("Panpanzinho's B&B", inv, res, payments)
+
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatal("expected a PDF document")
+	}
+
+	for _, s := range []string{"INV-000042", "Smith (Jr)", "Night of 2022-03-11 (Weekend)", "USD 300.00", "Balance due"} {
+		if !bytes.Contains(pdf, []byte(escape(s))) {
+			t.Errorf("expected the invoice to contain %q", s)
+		}
+	}
+
+	if bytes.Contains(pdf, []byte("fake_2")) {
+		t.Error("expected failed payments to be left out")
+	}
+
+	// The cross-reference table must point at the objects
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(pdf)
+	if m == nil {
+		t.Fatal("expected a startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(pdf[xref:], []byte("xref\n")) {
+		t.Errorf("expected the xref table at offset %d", xref)
+	}
+
+	offsets := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf, -1)
+	for i, offset := range offsets {
+		n, _ := strconv.Atoi(string(offset[1]))
+		if !bytes.HasPrefix(pdf[n:], []byte(fmt.Sprintf("%d 0 obj", i+1))) {
+			t.Errorf("expected object %d at offset %d", i+1, n)
+		}
+	}
+}
+
+func TestRenderAddsPages(t *testing.T) {
+	res := models.Reservation{Price: models.PriceQuote{Nights: make([]models.NightlyPrice, 90)}}
+
+	pdf := Render("B&B", models.Invoice{}, res, nil)
+
+	if bytes.Contains(pdf, []byte("/Count 1 ")) {
+		t.Error("expected a long stay to take more than one page")
+	}
+}
@@ -0,0 +1,123 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Fonts of a document. They are standard PDF fonts, so they need not be embedded
+const (
+	fontRegular = "F1" // Helvetica
+	fontBold    = "F2" // Helvetica-Bold
+	fontMono    = "F3" // Courier
+)
+
+// Size of an A4 page, in points
+const (
+	pageWidth  = 595.0
+	pageHeight = 842.0
+)
+
+// document is a minimal PDF 1.4 writer that supports text and lines on A4 pages
+type document struct {
+	pages []*bytes.Buffer // The content stream of every page
+}
+
+// newPage starts a new page, on which the following text and lines are drawn
+func (d *document) newPage() {
+	d.pages = append(d.pages, new(bytes.Buffer))
+}
+
+// text draws <s> with the bottom left corner at <x>, <y>
+func (d *document) text(x, y float64, font string, size float64, s string) {
+	fmt.Fprintf(d.pages[len(d.pages)-1], "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, escape(s))
+}
+
+// textRight draws <s> in the monospaced font with the bottom right corner at <x>, <y>
+func (d *document) textRight(x, y float64, size float64, s string) {
+	// Every glyph of Courier is 600/1000 of the font size wide
+	width := float64(len([]rune(s))) * size * 0.6
+	d.text(x-width, y, fontMono, size, s)
+}
+
+// line draws a thin line from <x1>, <y1> to <x2>, <y2>
+func (d *document) line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(d.pages[len(d.pages)-1], "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, y1, x2, y2)
+}
+
+// bytes returns the PDF file of the document
+func (d *document) bytes() []byte {
+	var b bytes.Buffer
+	var offsets []int
+
+	// obj starts the next object and returns its number
+	obj := func() int {
+		offsets = append(offsets, b.Len())
+		n := len(offsets)
+		fmt.Fprintf(&b, "%d 0 obj\n", n)
+		return n
+	}
+
+	b.WriteString("%PDF-1.4\n")
+
+	// Objects 1 to 5 are the catalog, the page tree and the fonts. The pages follow, each with its content
+	obj()
+	b.WriteString("<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+
+	obj()
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+	fmt.Fprintf(&b, "<< /Type /Pages /Kids [%s] /Count %d >>\nendobj\n", strings.Join(kids, " "), len(d.pages))
+
+	for _, font := range []string{"Helvetica", "Helvetica-Bold", "Courier"} {
+		obj()
+		fmt.Fprintf(&b, "<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>\nendobj\n", font)
+	}
+
+	for _, content := range d.pages {
+		n := obj()
+		fmt.Fprintf(&b, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R /F3 5 0 R >> >> /Contents %d 0 R >>\nendobj\n",
+			pageWidth, pageHeight, n+1)
+
+		obj()
+		fmt.Fprintf(&b, "<< /Length %d >>\nstream\n", content.Len())
+		b.Write(content.Bytes())
+		b.WriteString("endstream\nendobj\n")
+	}
+
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n", len(offsets)+1)
+	b.WriteString("0000000000 65535 f \n")
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return b.Bytes()
+}
+
+// escape converts <s> to a PDF string in the WinAnsi encoding. Characters that the encoding lacks become '?'
+func escape(s string) string {
+	var b strings.Builder
+
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 32 && r < 127:
+			b.WriteRune(r)
+		case r >= 160 && r <= 255:
+			// Latin-1 characters have the same code in WinAnsi
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+
+	return b.String()
+}
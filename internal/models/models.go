@@ -1,23 +1,37 @@
 package models
 
-import "time"
+import (
+	"strconv"
+	"strings"
+	"time"
+)
 
 // DB user model
 type User struct {
-	ID          int
-	FirstName   string
-	LastName    string
-	Email       string
-	Password    string
-	AccessLevel int
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	ID               int
+	FirstName        string
+	LastName         string
+	Email            string
+	Password         string `json:"-"`
+	AccessLevel      int    // One of the Access* levels
+	EmailVerifiedAt  time.Time
+	VerificationHash string `json:"-"` // Hash of the token of the link that verifies the email, until it is used
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
 }
 
-//DB room model
+// Access levels of a user
+const (
+	AccessGuest = 1 // A guest with an account, who sees their own bookings
+	AccessAdmin = 3 // A member of the staff, who manages the property
+)
+
+// DB room model
 type Room struct {
 	ID        int
 	RoomName  string
+	BasePrice int    // Nightly price in the minor unit of the currency (e.g. cents)
+	ICalToken string `json:"-"` // Secret that gives access to the calendar feed of the room
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
@@ -32,19 +46,46 @@ type Restriction struct {
 
 // DB reservation
 type Reservation struct {
-	ID        int
-	FirstName string
-	LastName  string
-	Email     string
-	Phone     string
-	StartDate time.Time
-	EndDate   time.Time
-	RoomID    int
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	Room      Room // This field is not present in the DB. It is an extra
+	ID          int
+	Code        string // Confirmation code, with which the guest refers to the reservation
+	FirstName   string
+	LastName    string
+	Email       string
+	Phone       string
+	StartDate   time.Time
+	EndDate     time.Time
+	RoomID      int
+	Guests      int
+	PromoCodeID int       // 0 means that no promo code was applied
+	UserID      int       // The account of the guest. 0 means that the reservation is not linked to an account
+	Status      string    // One of the Reservation* statuses
+	ExpiresAt   time.Time // When the room stops being held for a pending reservation that is not paid. Zero means never
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Room        Room       // This field is not present in the DB. It is an extra
+	Price       PriceQuote // Stored as <total_price>, <discount> and <price_details> in the DB
+
+	// The cancellation policy as it was at booking time, with the summary shown to the guest
+	CancellationPolicy  CancellationPolicy
+	CancellationSummary string
+	RefundAmount        int // Amount given back to the guest when the reservation was cancelled
+	CancelledAt         time.Time
 }
 
+// Statuses of a reservation. A reservation is pending until it is paid
+const (
+	ReservationPending   = "pending"
+	ReservationConfirmed = "confirmed"
+	ReservationCancelled = "cancelled"
+)
+
+// IDs of the restriction types
+const (
+	RestrictionReservation = 1
+	RestrictionOwnerBlock  = 2
+	RestrictionExternal    = 3 // A booking made on another channel, imported from its calendar
+)
+
 // DB room restriction
 type RoomRestriction struct {
 	ID            int
@@ -53,9 +94,319 @@ type RoomRestriction struct {
 	RoomID        int
 	ReservationID int
 	RestrictionID int
+	ICalImportID  int    // The calendar import the restriction comes from. 0 means that it was made here
+	ExternalUID   string // The UID of the event of the imported calendar
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 	Room          Room
 	Reservation   Reservation
-	Restriction   Reservation
+	Restriction   Restriction
+}
+
+// DB room rate. Overrides the base price of a room for the nights between StartDate and EndDate (both inclusive)
+type RoomRate struct {
+	ID        int
+	RoomID    int
+	RateName  string
+	StartDate time.Time
+	EndDate   time.Time
+	Weekdays  Weekdays // The weekdays the rate applies to. Empty means every day
+	Price     int
+	Priority  int // When more than one rate applies to a night, the one with the highest priority wins
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// DB stay rule. Applies to the stays arriving between StartDate and EndDate (both inclusive).
+// A zero value in any of the numeric fields means no limit
+type StayRule struct {
+	ID                int
+	RoomID            int // 0 means that the rule applies to every room
+	StartDate         time.Time
+	EndDate           time.Time
+	MinNights         int
+	MaxNights         int
+	MinAdvanceDays    int // Minimum number of days between the booking and the arrival
+	MaxAdvanceDays    int // Maximum number of days between the booking and the arrival, that is the booking horizon
+	ClosedToArrival   Weekdays
+	ClosedToDeparture Weekdays
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+// Discount types of a promo code
+const (
+	DiscountPercent = "percent"
+	DiscountFixed   = "fixed"
+)
+
+// DB promo code
+type PromoCode struct {
+	ID           int
+	Code         string
+	DiscountType string // Either DiscountPercent or DiscountFixed
+	Amount       int    // Percentage for DiscountPercent, minor units of the currency for DiscountFixed
+	ValidFrom    time.Time
+	ValidUntil   time.Time
+	MinNights    int
+	MaxUses      int // 0 means unlimited
+	TimesUsed    int
+	RoomID       int // 0 means that the code applies to every room
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// Categories of a fee rule. Percentage rules are charged on the room price and the fees, but not on the taxes
+const (
+	CategoryFee = "fee"
+	CategoryTax = "tax"
+)
+
+// Kinds of a fee rule, that is how its amount is charged
+const (
+	FeePerNight         = "per_night"
+	FeePerStay          = "per_stay"
+	FeePerGuest         = "per_guest"
+	FeePerGuestPerNight = "per_guest_per_night"
+	FeePercent          = "percent"
+)
+
+// DB tax or fee rule
+type FeeRule struct {
+	ID        int
+	Name      string
+	Category  string // Either CategoryFee or CategoryTax
+	Kind      string
+	Amount    int // Hundredths of a percent for FeePercent (1000 = 10%), minor units of the currency otherwise
+	RoomID    int // 0 means that the rule applies to every room
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// DB cancellation policy. The guest can cancel for free until FreeUntilDays days before the arrival.
+// Later cancellations are charged PenaltyPercent of the amount paid, and non-refundable reservations are never refunded
+type CancellationPolicy struct {
+	ID             int
+	Name           string
+	FreeUntilDays  int
+	PenaltyPercent int
+	NonRefundable  bool
+	RoomID         int    // 0 means that the policy applies to every room
+	RateName       string // The rate of the arrival night the policy applies to. Empty means every rate
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// Weekdays is a comma separated list of weekdays, where 0 is Sunday and 6 is Saturday (e.g. "5,6")
+type Weekdays string
+
+// Contains checks if <wd> is in the list
+func (w Weekdays) Contains(wd time.Weekday) bool {
+	for _, s := range strings.Split(string(w), ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			continue
+		}
+
+		if time.Weekday(n) == wd {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NightlyPrice is the price of a single night of a stay
+type NightlyPrice struct {
+	Date     time.Time
+	RateName string
+	Amount   int
+}
+
+// PriceLine is a tax or fee itemised on top of the room price
+type PriceLine struct {
+	Name     string
+	Category string
+	Amount   int
+}
+
+// PriceQuote is the price breakdown of a reservation. Amounts are in the minor unit of Currency (e.g. cents)
+type PriceQuote struct {
+	Currency  string
+	Nights    []NightlyPrice
+	Subtotal  int
+	PromoCode string
+	Discount  int
+	Lines     []PriceLine
+	Total     int
+}
+
+// Statuses of a payment
+const (
+	PaymentAuthorised        = "authorised"
+	PaymentCaptured          = "captured"
+	PaymentFailed            = "failed"
+	PaymentRefunded          = "refunded"
+	PaymentPartiallyRefunded = "partially_refunded"
+)
+
+// DB payment of a reservation
+type Payment struct {
+	ID             int
+	ReservationID  int
+	ProviderRef    string // Reference of the payment at the payment provider
+	Amount         int
+	RefundedAmount int // How much of the amount was given back to the guest
+	Currency       string
+	Status         string // One of the Payment* statuses
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// DB calendar import. The events of the calendar at URL block the room
+type ICalImport struct {
+	ID           int
+	RoomID       int
+	URL          string
+	LastSyncedAt time.Time
+	LastError    string // Why the last synchronisation failed. Empty when it succeeded
+	Warnings     string // What the last synchronisation left out or imported over the reservations, one per line
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// DB invoice of a reservation. Numbers come from a sequence: they are never reused, but the number drawn by an invoice
+// that was issued at the same time for the same reservation is skipped
+type Invoice struct {
+	ID            int
+	Number        int
+	ReservationID int
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// Scopes of an API key, that is what the API key gives access to. The reservations created with
+// ScopeCreateReservation are paid by card like those of the website, unless the API key also has
+// ScopeCreateUnpaidReservation: the API client then collects the payment and the reservations are confirmed at once
+const (
+	ScopeReadAvailability        = "read-availability"
+	ScopeCreateReservation       = "create-reservation"
+	ScopeCreateUnpaidReservation = "create-unpaid-reservation"
+	ScopeManageReservations      = "manage-reservations"
+)
+
+// AllScopes lists the scopes of an API key
+var AllScopes = []string{ScopeReadAvailability, ScopeCreateReservation, ScopeCreateUnpaidReservation, ScopeManageReservations}
+
+// Scopes is a comma separated list of the scopes of an API key (e.g. "read-availability,create-reservation")
+type Scopes string
+
+// Contains checks if <scope> is in the list
+func (s Scopes) Contains(scope string) bool {
+	for _, x := range strings.Split(string(s), ",") {
+		if strings.TrimSpace(x) == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DB API key of a partner. Only the hash of the key is stored; the prefix identifies the key
+type APIKey struct {
+	ID         int
+	Name       string
+	Prefix     string
+	Hash       string `json:"-"`
+	Scopes     Scopes
+	RateLimit  int       // Requests per minute. 0 means unlimited
+	ExpiresAt  time.Time // Zero means that the key never expires
+	LastUsedAt time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// DB request made with an API key
+type APIKeyUsage struct {
+	ID        int
+	APIKeyID  int
+	Method    string
+	Path      string
+	Status    int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Events that are delivered to the webhook endpoints
+const (
+	EventReservationCreated   = "reservation.created"
+	EventReservationCancelled = "reservation.cancelled"
+	EventBlockCreated         = "block.created"
+)
+
+// AllEvents lists the events that a webhook endpoint can subscribe to
+var AllEvents = []string{EventReservationCreated, EventReservationCancelled, EventBlockCreated}
+
+// Events is a comma separated list of the events a webhook endpoint subscribes to (e.g. "reservation.created,block.created")
+type Events string
+
+// Contains checks if <event> is in the list
+func (e Events) Contains(event string) bool {
+	for _, x := range strings.Split(string(e), ",") {
+		if strings.TrimSpace(x) == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DB webhook endpoint. The events it subscribes to are posted to URL, signed with Secret
+type WebhookEndpoint struct {
+	ID        int
+	URL       string
+	Secret    string `json:"-"`
+	Events    Events
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Statuses of a webhook delivery
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed" // Given up after too many attempts
+)
+
+// DB delivery of an event to a webhook endpoint
+type WebhookDelivery struct {
+	ID             int
+	EndpointID     int
+	Event          string
+	Payload        string // The JSON body that is posted
+	Status         string // One of the Delivery* statuses
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastStatusCode int // Status code of the last response. 0 when the endpoint could not be reached
+	LastError      string
+	DeliveredAt    time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	Endpoint       WebhookEndpoint
+}
+
+// MailData holds an email message
+type MailData struct {
+	To          string
+	From        string
+	Subject     string
+	Content     string
+	Attachments []MailAttachment
+}
+
+// MailAttachment is a file attached to an email message
+type MailAttachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
 }
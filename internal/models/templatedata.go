@@ -9,8 +9,15 @@ type TemplateData struct {
 	FloatMap  map[string]float32
 	Data      map[string]interface{} // For other data structures, use an interface
 	CSRFToken string                 // Cross site request forgery token. This token is called in <search-availability.page.tmpl>
+	CSPNonce  string                 // Nonce that lets the inline scripts run under the Content-Security-Policy
+	Locale    string                 // Locale of the visitor, in which the pages are shown
+	Languages map[string]string      // Names of the locales the visitor can choose, by locale
 	Flash     string                 // Flash message to the end-user
 	Warning   string                 // Warning message to the end-user
 	Error     string                 // Error message to the end-user
 	Form      *forms.Form
+	JSON      interface{} // Body of the page for the clients that prefer JSON. The pages without one only answer with HTML
+
+	IsAuthenticated int // 1 if the user is logged in, 0 otherwise
+	IsAdmin         int // 1 if the user is logged in as a member of the staff, 0 otherwise
 }
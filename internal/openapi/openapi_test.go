@@ -0,0 +1,94 @@
+package openapi
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type room struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type base struct {
+	Code string `json:"code"`
+}
+
+type reservation struct {
+	base
+	Room     room              `json:"room"`
+	Rooms    []room            `json:"rooms"`
+	Guests   *int              `json:"guests"`
+	Note     string            `json:"note,omitempty"`
+	Created  time.Time         `json:"created"`
+	Fields   map[string]string `json:"fields"`
+	Internal string            `json:"-"`
+	private  string
+}
+
+func TestSchemaOf(t *testing.T) {
+	d := New(Info{Title: "Test", Version: "1"})
+	d.Register("Room", room{})
+
+	s := d.SchemaOf(reservation{})
+
+	if s.Type != "object" || len(s.Properties) != 7 {
+		t.Fatalf("expected an object with 7 properties but got %s with %d", s.Type, len(s.Properties))
+	}
+
+	expected := map[string]string{
+		"code":    "string",
+		"guests":  "integer",
+		"note":    "string",
+		"created": "string",
+		"fields":  "object",
+		"rooms":   "array",
+	}
+	for name, typ := range expected {
+		if s.Properties[name] == nil || s.Properties[name].Type != typ {
+			t.Errorf("expected %s to be of type %s but got %+v", name, typ, s.Properties[name])
+		}
+	}
+
+	if s.Properties["room"].Ref != "#/components/schemas/Room" || s.Properties["rooms"].Items.Ref != "#/components/schemas/Room" {
+		t.Error("expected the registered type to be referenced")
+	}
+
+	if !s.Properties["guests"].Nullable || s.Properties["created"].Format != "date-time" {
+		t.Error("expected a nullable pointer and a date-time")
+	}
+
+	for _, name := range s.Required {
+		if name == "note" {
+			t.Error("expected omitempty fields not to be required")
+		}
+	}
+
+	if len(s.Required) != 6 {
+		t.Errorf("expected 6 required properties but got %v", s.Required)
+	}
+}
+
+func TestDocument(t *testing.T) {
+	d := New(Info{Title: "Test", Version: "1"})
+	d.Add("GET", "/rooms", Operation{OperationID: "listRooms", Summary: "List rooms"})
+
+	if !d.Has("get", "/rooms") || d.Has("POST", "/rooms") || d.Has("GET", "/other") {
+		t.Error("expected the document to describe only GET /rooms")
+	}
+
+	out, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(out, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc["openapi"] != Version {
+		t.Errorf("expected the version %s but got %v", Version, doc["openapi"])
+	}
+}
@@ -0,0 +1,138 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Test card numbers of the fake gateway. Every other card number is authorised
+const (
+	FakeCardOK       = "4242424242424242"
+	FakeCardDeclined = "4000000000000002"
+)
+
+// FakeSignatureHeader is the header that carries the signature of the webhook calls of the fake gateway
+const FakeSignatureHeader = "X-Fake-Signature"
+
+// FakeGateway is a payment gateway that keeps the payments in memory, for development and tests
+type FakeGateway struct {
+	secret string
+
+	mu       sync.Mutex
+	payments map[string]*fakePayment
+	lastID   int
+}
+
+// fakePayment is a payment known to the fake gateway
+type fakePayment struct {
+	authorised int
+	captured   int
+	refunded   int
+}
+
+// NewFakeGateway creates a fake gateway that signs its webhook calls with <secret>
+func NewFakeGateway(secret string) *FakeGateway {
+	return &FakeGateway{
+		secret:   secret,
+		payments: make(map[string]*fakePayment),
+	}
+}
+
+// Authorise authorises the payment, unless the card number is FakeCardDeclined
+func (g *FakeGateway) Authorise(req AuthoriseRequest) (string, error) {
+	if req.CardNumber == FakeCardDeclined {
+		return "", ErrDeclined
+	}
+
+	if req.Amount <= 0 {
+		return "", errors.New("the amount must be positive")
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.lastID++
+	ref := fmt.Sprintf("fake_%d", g.lastID)
+	g.payments[ref] = &fakePayment{authorised: req.Amount}
+
+	return ref, nil
+}
+
+// Capture collects an amount of an authorised payment
+func (g *FakeGateway) Capture(ref string, amount int) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p, ok := g.payments[ref]
+	if !ok {
+		return fmt.Errorf("unknown payment %s", ref)
+	}
+
+	if amount <= 0 || p.captured+amount > p.authorised {
+		return fmt.Errorf("cannot capture %d of payment %s", amount, ref)
+	}
+
+	p.captured += amount
+
+	return nil
+}
+
+// Refund gives an amount of a captured payment back
+func (g *FakeGateway) Refund(ref string, amount int) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p, ok := g.payments[ref]
+	if !ok {
+		return fmt.Errorf("unknown payment %s", ref)
+	}
+
+	if amount <= 0 || p.refunded+amount > p.captured {
+		return fmt.Errorf("cannot refund %d of payment %s", amount, ref)
+	}
+
+	p.refunded += amount
+
+	return nil
+}
+
+// VerifyWebhook checks the HMAC-SHA256 signature of the body of the request and decodes the event
+func (g *FakeGateway) VerifyWebhook(r *http.Request) (WebhookEvent, error) {
+	var event WebhookEvent
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return event, err
+	}
+
+	signature, err := hex.DecodeString(r.Header.Get(FakeSignatureHeader))
+	if err != nil || !hmac.Equal(signature, g.sign(body)) {
+		return event, errors.New("invalid webhook signature")
+	}
+
+	err = json.Unmarshal(body, &event)
+	if err != nil {
+		return event, err
+	}
+
+	return event, nil
+}
+
+// Sign returns the signature, as sent in FakeSignatureHeader, of a webhook call with <body>
+func (g *FakeGateway) Sign(body []byte) string {
+	return hex.EncodeToString(g.sign(body))
+}
+
+// sign computes the HMAC-SHA256 of <body> with the secret of the gateway
+func (g *FakeGateway) sign(body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(g.secret))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,69 @@
+package payments
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFakeGateway_Payment(t *testing.T) {
+	g := NewFakeGateway("secret")
+
+	_, err := g.Authorise(AuthoriseRequest{Amount: 1000, Currency: "USD", CardNumber: FakeCardDeclined})
+	if err != ErrDeclined {
+		t.Errorf("expected the card to be declined but got %v", err)
+	}
+
+	ref, err := g.Authorise(AuthoriseRequest{Amount: 1000, Currency: "USD", CardNumber: FakeCardOK})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = g.Refund(ref, 100); err == nil {
+		t.Error("refunded a payment that was not captured")
+	}
+
+	if err = g.Capture(ref, 1200); err == nil {
+		t.Error("captured more than what was authorised")
+	}
+
+	if err = g.Capture(ref, 1000); err != nil {
+		t.Error(err)
+	}
+
+	if err = g.Refund(ref, 600); err != nil {
+		t.Error(err)
+	}
+
+	if err = g.Refund(ref, 600); err == nil {
+		t.Error("refunded more than what was captured")
+	}
+
+	if err = g.Capture("fake_100", 100); err == nil {
+		t.Error("captured an unknown payment")
+	}
+}
+
+func TestFakeGateway_VerifyWebhook(t *testing.T) {
+	g := NewFakeGateway("secret")
+	body := []byte(`{"type":"payment.captured","ref":"fake_1","amount":1000}`)
+
+	r := httptest.NewRequest("POST", "/payments/webhook", bytes.NewReader(body))
+	r.Header.Set(FakeSignatureHeader, g.Sign(body))
+
+	event, err := g.VerifyWebhook(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if event.Type != EventCaptured || event.Ref != "fake_1" || event.Amount != 1000 {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	r = httptest.NewRequest("POST", "/payments/webhook", bytes.NewReader(body))
+	r.Header.Set(FakeSignatureHeader, NewFakeGateway("other").Sign(body))
+
+	if _, err = g.VerifyWebhook(r); err == nil {
+		t.Error("accepted a webhook signed with another secret")
+	}
+}
@@ -0,0 +1,48 @@
+package payments
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Types of the events that payment providers send to the webhook
+const (
+	EventCaptured = "payment.captured"
+	EventFailed   = "payment.failed"
+	EventRefunded = "payment.refunded"
+)
+
+// ErrDeclined is returned when the provider refuses to authorise a payment
+var ErrDeclined = errors.New("the card was declined")
+
+// PaymentGateway is implemented by every payment provider
+type PaymentGateway interface {
+	// Authorise reserves the amount on the card of the guest and returns the reference of the payment at the provider
+	Authorise(req AuthoriseRequest) (string, error)
+
+	// Capture collects an amount of a previously authorised payment
+	Capture(ref string, amount int) error
+
+	// Refund gives an amount of a captured payment back to the guest
+	Refund(ref string, amount int) error
+
+	// VerifyWebhook checks that a webhook call really comes from the provider and returns the event it carries
+	VerifyWebhook(r *http.Request) (WebhookEvent, error)
+}
+
+// AuthoriseRequest holds what a provider needs to authorise a payment. Amount is in the minor unit of Currency
+type AuthoriseRequest struct {
+	Amount      int
+	Currency    string
+	CardNumber  string
+	Description string
+}
+
+// WebhookEvent is a change of the status of a payment, notified by the provider. The Amount of an EventCaptured is the
+// amount captured, and the one of an EventRefunded is the total refunded so far, so that a refund notified twice is
+// only counted once
+type WebhookEvent struct {
+	Type   string `json:"type"`
+	Ref    string `json:"ref"`
+	Amount int    `json:"amount"`
+}
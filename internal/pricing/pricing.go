@@ -0,0 +1,197 @@
+package pricing
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wagnojunior/booking/internal/models"
+)
+
+// Quote builds the price breakdown of the reservation <res> in the room <room>.
+// Every night between the arrival (inclusive) and the departure (exclusive) is charged the base price of the room,
+// unless one of the <rates> applies to that night, in which case the rate with the highest priority is charged
+func Quote(res models.Reservation, room models.Room, rates []models.RoomRate, currency string) models.PriceQuote {
+	quote := models.PriceQuote{
+		Currency: currency,
+	}
+
+	for d := res.StartDate; d.Before(res.EndDate); d = d.AddDate(0, 0, 1) {
+		night := models.NightlyPrice{
+			Date:     d,
+			RateName: "Base",
+			Amount:   room.BasePrice,
+		}
+
+		if rate, ok := rateForNight(rates, d); ok {
+			night.RateName = rate.RateName
+			night.Amount = rate.Price
+		}
+
+		quote.Nights = append(quote.Nights, night)
+		quote.Subtotal += night.Amount
+	}
+
+	quote.Total = total(quote)
+
+	return quote
+}
+
+// ApplyFees itemises the taxes and fees of the <rules> on the <quote> of a stay of <guests> guests.
+// Percentage rules are charged on the discounted room price plus the other fees, but never on other taxes
+func ApplyFees(quote models.PriceQuote, rules []models.FeeRule, guests int) models.PriceQuote {
+	// A stay has at least one guest
+	if guests < 1 {
+		guests = 1
+	}
+
+	nights := len(quote.Nights)
+	base := quote.Subtotal - quote.Discount
+
+	quote.Lines = nil
+	var percentRules []models.FeeRule
+
+	for _, rule := range rules {
+		var amount int
+
+		switch rule.Kind {
+		case models.FeePerNight:
+			amount = rule.Amount * nights
+		case models.FeePerStay:
+			amount = rule.Amount
+		case models.FeePerGuest:
+			amount = rule.Amount * guests
+		case models.FeePerGuestPerNight:
+			amount = rule.Amount * guests * nights
+		case models.FeePercent:
+			percentRules = append(percentRules, rule)
+			continue
+		default:
+			continue
+		}
+
+		quote.Lines = append(quote.Lines, models.PriceLine{
+			Name:     rule.Name,
+			Category: rule.Category,
+			Amount:   amount,
+		})
+
+		if rule.Category == models.CategoryFee {
+			base += amount
+		}
+	}
+
+	for _, rule := range percentRules {
+		quote.Lines = append(quote.Lines, models.PriceLine{
+			Name:     fmt.Sprintf("%s (%s%%)", rule.Name, FormatAmount(rule.Amount, "")),
+			Category: rule.Category,
+			Amount:   int(math.Round(float64(base*rule.Amount) / 10000)),
+		})
+	}
+
+	quote.Total = total(quote)
+
+	return quote
+}
+
+// total returns the price to pay for the <quote>: the room price, minus the discount, plus the taxes and fees
+func total(quote models.PriceQuote) int {
+	t := quote.Subtotal - quote.Discount
+	for _, line := range quote.Lines {
+		t += line.Amount
+	}
+
+	return t
+}
+
+// rateForNight returns the rate with the highest priority that applies to the night <d>
+func rateForNight(rates []models.RoomRate, d time.Time) (models.RoomRate, bool) {
+	var best models.RoomRate
+	found := false
+
+	for _, rate := range rates {
+		if d.Before(rate.StartDate) || d.After(rate.EndDate) {
+			continue
+		}
+
+		if rate.Weekdays != "" && !rate.Weekdays.Contains(d.Weekday()) {
+			continue
+		}
+
+		if !found || rate.Priority > best.Priority {
+			best = rate
+			found = true
+		}
+	}
+
+	return best, found
+}
+
+// FormatAmount formats an <amount> in minor units as a human readable price, e.g. 12050 -> USD 120.50.
+// The currency is left out when empty, e.g. 12050 -> 120.50
+func FormatAmount(amount int, currency string) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	s := fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+	if currency == "" {
+		return s
+	}
+
+	return currency + " " + s
+}
+
+// CheckPromoCode returns the reason why <promo> cannot be applied to the priced reservation <res> booked on <today>.
+// An empty string means that the promo code can be applied
+func CheckPromoCode(promo models.PromoCode, res models.Reservation, today time.Time) string {
+	if today.Before(promo.ValidFrom) || !today.Before(promo.ValidUntil.AddDate(0, 0, 1)) {
+		return "This promo code is not valid at the moment"
+	}
+
+	if promo.RoomID != 0 && promo.RoomID != res.RoomID {
+		return "This promo code is not valid for this room"
+	}
+
+	if len(res.Price.Nights) < promo.MinNights {
+		return fmt.Sprintf("This promo code requires a stay of at least %d night(s)", promo.MinNights)
+	}
+
+	if promo.MaxUses > 0 && promo.TimesUsed >= promo.MaxUses {
+		return "This promo code has reached its usage limit"
+	}
+
+	return ""
+}
+
+// ApplyPromoCode discounts the <quote> by <promo>. The discount is never larger than the subtotal
+func ApplyPromoCode(quote models.PriceQuote, promo models.PromoCode) models.PriceQuote {
+	discount := promo.Amount
+	if promo.DiscountType == models.DiscountPercent {
+		discount = quote.Subtotal * promo.Amount / 100
+	}
+
+	if discount > quote.Subtotal {
+		discount = quote.Subtotal
+	}
+
+	quote.PromoCode = promo.Code
+	quote.Discount = discount
+	quote.Total = total(quote)
+
+	return quote
+}
+
+// ParseAmount parses a human readable price, e.g. 120.50, into minor units, e.g. 12050
+func ParseAmount(s string) (int, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(math.Round(f * 100)), nil
+}
@@ -0,0 +1,188 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wagnojunior/booking/internal/models"
+)
+
+func date(s string) time.Time {
+	d, _ := time.Parse("2006-01-02", s)
+	return d
+}
+
+var quoteTests = []struct {
+	name          string
+	start         string
+	end           string
+	rates         []models.RoomRate
+	expectedNight int
+	expectedTotal int
+}{
+	{"base price only", "2022-03-07", "2022-03-10", nil, 3, 30000},
+	{"zero nights", "2022-03-07", "2022-03-07", nil, 0, 0},
+	{"weekend override", "2022-03-10", "2022-03-13", []models.RoomRate{
+		{RateName: "Weekend", StartDate: date("2022-01-01"), EndDate: date("2022-12-31"), Weekdays: "5,6", Price: 15000},
+	}, 3, 40000},
+	{"season outside the stay", "2022-03-07", "2022-03-09", []models.RoomRate{
+		{RateName: "Summer", StartDate: date("2022-07-01"), EndDate: date("2022-08-31"), Price: 20000},
+	}, 2, 20000},
+	{"highest priority wins", "2022-07-01", "2022-07-02", []models.RoomRate{
+		{RateName: "Summer", StartDate: date("2022-07-01"), EndDate: date("2022-08-31"), Price: 20000, Priority: 1},
+		{RateName: "Weekend", StartDate: date("2022-01-01"), EndDate: date("2022-12-31"), Weekdays: "5,6", Price: 15000, Priority: 0},
+	}, 1, 20000},
+	{"rate end date is inclusive", "2022-08-31", "2022-09-01", []models.RoomRate{
+		{RateName: "Summer", StartDate: date("2022-07-01"), EndDate: date("2022-08-31"), Price: 20000},
+	}, 1, 20000},
+}
+
+func TestQuote(t *testing.T) {
+	room := models.Room{ID: 1, BasePrice: 10000}
+
+	for _, e := range quoteTests {
+		res := models.Reservation{
+			RoomID:    1,
+			StartDate: date(e.start),
+			EndDate:   date(e.end),
+		}
+
+		q := Quote(res, room, e.rates, "USD")
+
+		if len(q.Nights) != e.expectedNight {
+			t.Errorf("For %s, expected %d nights but got %d", e.name, e.expectedNight, len(q.Nights))
+		}
+
+		if q.Total != e.expectedTotal {
+			t.Errorf("For %s, expected total %d but got %d", e.name, e.expectedTotal, q.Total)
+		}
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	if s := FormatAmount(12050, "USD"); s != "USD 120.50" {
+		t.Errorf("expected USD 120.50 but got %s", s)
+	}
+
+	if s := FormatAmount(-5, "USD"); s != "USD -0.05" {
+		t.Errorf("expected USD -0.05 but got %s", s)
+	}
+
+	if s := FormatAmount(1050, ""); s != "10.50" {
+		t.Errorf("expected 10.50 but got %s", s)
+	}
+}
+
+var promoTests = []struct {
+	name             string
+	promo            models.PromoCode
+	expectedDiscount int
+}{
+	{"percentage", models.PromoCode{Code: "TEN", DiscountType: models.DiscountPercent, Amount: 10}, 3000},
+	{"fixed amount", models.PromoCode{Code: "FIVE", DiscountType: models.DiscountFixed, Amount: 500}, 500},
+	{"never below zero", models.PromoCode{Code: "FREE", DiscountType: models.DiscountFixed, Amount: 50000}, 30000},
+}
+
+func TestApplyPromoCode(t *testing.T) {
+	quote := models.PriceQuote{Subtotal: 30000, Total: 30000}
+
+	for _, e := range promoTests {
+		q := ApplyPromoCode(quote, e.promo)
+
+		if q.Discount != e.expectedDiscount {
+			t.Errorf("For %s, expected discount %d but got %d", e.name, e.expectedDiscount, q.Discount)
+		}
+
+		if q.Total != quote.Subtotal-e.expectedDiscount {
+			t.Errorf("For %s, expected total %d but got %d", e.name, quote.Subtotal-e.expectedDiscount, q.Total)
+		}
+
+		if q.PromoCode != e.promo.Code {
+			t.Errorf("For %s, expected promo code %s but got %s", e.name, e.promo.Code, q.PromoCode)
+		}
+	}
+}
+
+func TestCheckPromoCode(t *testing.T) {
+	res := models.Reservation{
+		RoomID: 1,
+		Price:  models.PriceQuote{Nights: make([]models.NightlyPrice, 2)},
+	}
+	valid := models.PromoCode{ValidFrom: date("2022-03-01"), ValidUntil: date("2022-03-31")}
+
+	if msg := CheckPromoCode(valid, res, date("2022-03-31").Add(12*time.Hour)); msg != "" {
+		t.Errorf("expected a valid promo code but got: %s", msg)
+	}
+
+	invalid := []models.PromoCode{
+		{ValidFrom: date("2022-04-01"), ValidUntil: date("2022-04-30")},
+		{ValidFrom: date("2022-03-01"), ValidUntil: date("2022-03-31"), RoomID: 2},
+		{ValidFrom: date("2022-03-01"), ValidUntil: date("2022-03-31"), MinNights: 3},
+		{ValidFrom: date("2022-03-01"), ValidUntil: date("2022-03-31"), MaxUses: 5, TimesUsed: 5},
+	}
+
+	for i, promo := range invalid {
+		if msg := CheckPromoCode(promo, res, date("2022-03-15")); msg == "" {
+			t.Errorf("expected promo code %d to be invalid", i)
+		}
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	amount, err := ParseAmount("120.5")
+	if err != nil || amount != 12050 {
+		t.Errorf("expected 12050 but got %d (%v)", amount, err)
+	}
+
+	if _, err := ParseAmount("abc"); err == nil {
+		t.Error("expected an error for an invalid amount")
+	}
+}
+
+func TestApplyFees(t *testing.T) {
+	rules := []models.FeeRule{
+		{Name: "VAT", Category: models.CategoryTax, Kind: models.FeePercent, Amount: 1000},
+		{Name: "Cleaning fee", Category: models.CategoryFee, Kind: models.FeePerStay, Amount: 3000},
+		{Name: "Tourist tax", Category: models.CategoryTax, Kind: models.FeePerGuestPerNight, Amount: 200},
+		{Name: "Towels", Category: models.CategoryFee, Kind: models.FeePerGuest, Amount: 500},
+		{Name: "Heating", Category: models.CategoryFee, Kind: models.FeePerNight, Amount: 100},
+	}
+
+	quote := models.PriceQuote{
+		Nights:   make([]models.NightlyPrice, 3),
+		Subtotal: 30000,
+		Discount: 3000,
+	}
+
+	q := ApplyFees(quote, rules, 2)
+
+	// Cleaning 3000, tourist tax 200*2*3 = 1200, towels 500*2 = 1000, heating 100*3 = 300,
+	// VAT 10% of (30000 - 3000 + 3000 + 1000 + 300) = 3130
+	expected := map[string]int{
+		"Cleaning fee": 3000,
+		"Tourist tax":  1200,
+		"Towels":       1000,
+		"Heating":      300,
+		"VAT (10.00%)": 3130,
+	}
+
+	if len(q.Lines) != len(expected) {
+		t.Fatalf("expected %d lines but got %d", len(expected), len(q.Lines))
+	}
+
+	for _, line := range q.Lines {
+		if line.Amount != expected[line.Name] {
+			t.Errorf("For %s, expected %d but got %d", line.Name, expected[line.Name], line.Amount)
+		}
+	}
+
+	if q.Total != 27000+3000+1200+1000+300+3130 {
+		t.Errorf("expected total %d but got %d", 27000+3000+1200+1000+300+3130, q.Total)
+	}
+
+	// Applying the fees again replaces the lines instead of adding to them
+	q = ApplyFees(q, rules[1:2], 0)
+	if len(q.Lines) != 1 || q.Total != 30000 {
+		t.Errorf("expected 1 line and a total of 30000 but got %d lines and %d", len(q.Lines), q.Total)
+	}
+}
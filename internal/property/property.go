@@ -0,0 +1,76 @@
+package property
+
+import (
+	"fmt"
+	"time"
+)
+
+// Settings are the settings of the property that decide when its days begin and when its stays start and end.
+// The dates of the stays are calendar days, at midnight UTC like the dates of the database, and the settings tell
+// which day it is at the property and at what time the guests arrive and leave
+type Settings struct {
+	TimeZone      *time.Location // The time zone of the property. nil is UTC
+	CheckIn       TimeOfDay      // The time from which the guests can arrive
+	CheckOut      TimeOfDay      // The time until which the guests can stay on the day of their departure
+	SameDayCutoff TimeOfDay      // The latest time at which a stay arriving on the same day can be booked. Zero is none
+}
+
+// TimeOfDay is a time of the day at the property, e.g. 14:00
+type TimeOfDay struct {
+	Hour   int
+	Minute int
+}
+
+// ParseTimeOfDay parses the time of the day <s>, written as 15:04
+func ParseTimeOfDay(s string) (TimeOfDay, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return TimeOfDay{}, fmt.Errorf("invalid time of the day %q, it must be written as HH:MM", s)
+	}
+
+	return TimeOfDay{Hour: t.Hour(), Minute: t.Minute()}, nil
+}
+
+// String writes the time of the day as 15:04
+func (t TimeOfDay) String() string {
+	return fmt.Sprintf("%02d:%02d", t.Hour, t.Minute)
+}
+
+// IsZero checks if the time of the day is not set
+func (t TimeOfDay) IsZero() bool {
+	return t == TimeOfDay{}
+}
+
+// Location returns the time zone of the property
+func (s Settings) Location() *time.Location {
+	if s.TimeZone == nil {
+		return time.UTC
+	}
+
+	return s.TimeZone
+}
+
+// Date returns the calendar day of <t>, at midnight UTC
+func Date(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Today returns the day that it is at the property at the time <now>, whatever the time zone of the server
+func (s Settings) Today(now time.Time) time.Time {
+	return Date(now.In(s.Location()))
+}
+
+// at returns the time <t> of the day <date> at the property
+func (s Settings) at(date time.Time, t TimeOfDay) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), t.Hour, t.Minute, 0, 0, s.Location())
+}
+
+// SameDayClosed checks if a stay arriving on the day <arrival> can no longer be booked at the time <now>, because
+// it is the same day at the property and the same-day cutoff has passed
+func (s Settings) SameDayClosed(arrival, now time.Time) bool {
+	if s.SameDayCutoff.IsZero() || !Date(arrival).Equal(s.Today(now)) {
+		return false
+	}
+
+	return !now.Before(s.at(arrival, s.SameDayCutoff))
+}
@@ -0,0 +1,60 @@
+package property
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeOfDay(t *testing.T) {
+	tod, err := ParseTimeOfDay("14:30")
+	if err != nil || tod != (TimeOfDay{Hour: 14, Minute: 30}) || tod.String() != "14:30" {
+		t.Errorf("expected 14:30 but got %v, %v", tod, err)
+	}
+
+	if _, err := ParseTimeOfDay("2pm"); err == nil {
+		t.Error("expected an error for a time that is not written as HH:MM")
+	}
+}
+
+func TestSettings_Today(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	now := time.Date(2050, 3, 1, 20, 0, 0, 0, time.UTC)
+
+	if today := (Settings{}).Today(now); !today.Equal(time.Date(2050, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the 1st of March in UTC but got %v", today)
+	}
+
+	// It is already the next day in Tokyo
+	if today := (Settings{TimeZone: tokyo}).Today(now); !today.Equal(time.Date(2050, 3, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the 2nd of March in Tokyo but got %v", today)
+	}
+}
+
+func TestSettings_SameDayClosed(t *testing.T) {
+	saoPaulo := time.FixedZone("BRT", -3*60*60)
+	s := Settings{TimeZone: saoPaulo, SameDayCutoff: TimeOfDay{Hour: 20}}
+	today := time.Date(2050, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		name     string
+		arrival  time.Time
+		now      time.Time
+		expected bool
+	}{
+		{"before the cutoff", today, time.Date(2050, 3, 1, 22, 0, 0, 0, time.UTC), false},
+		{"after the cutoff", today, time.Date(2050, 3, 1, 23, 30, 0, 0, time.UTC), true},
+		// It is already the 2nd in UTC, but still the 1st at the property
+		{"after the cutoff, the next day in UTC", today, time.Date(2050, 3, 2, 1, 0, 0, 0, time.UTC), true},
+		{"arrival tomorrow", today.AddDate(0, 0, 1), time.Date(2050, 3, 1, 23, 30, 0, 0, time.UTC), false},
+	}
+
+	for _, e := range tests {
+		if closed := s.SameDayClosed(e.arrival, e.now); closed != e.expected {
+			t.Errorf("For %s, expected %v but got %v", e.name, e.expected, closed)
+		}
+	}
+
+	if (Settings{}).SameDayClosed(today, time.Date(2050, 3, 1, 23, 59, 0, 0, time.UTC)) {
+		t.Error("expected no cutoff when none is set")
+	}
+}
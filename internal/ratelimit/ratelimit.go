@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit is a token bucket: a client may make Burst requests at once, and then Rate requests per second
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Every returns the limit of <n> requests per <interval>, at most <burst> of them at once
+func Every(n int, interval time.Duration, burst int) Limit {
+	return Limit{Rate: float64(n) / interval.Seconds(), Burst: burst}
+}
+
+// sweepInterval is the longest time between two sweeps of the buckets that are full again
+const sweepInterval = time.Minute
+
+// bucket holds the tokens left to a client at the time of its last request, and the limit they were counted with
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+// Decision is the outcome of a request checked against the limit of its key
+type Decision struct {
+	OK         bool
+	Remaining  int           // Requests the key can still make at once
+	RetryAfter time.Duration // When the request is refused, how long until a token is available
+	Reset      time.Duration // How long until the bucket of the key is full again
+}
+
+// Limiter keeps a token bucket per key (e.g. per IP address). It is safe for concurrent use
+type Limiter struct {
+	limit   Limit
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+// New returns a limiter that applies <limit> to every key, unless the key is given its own limit with Take
+func New(limit Limit) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from the bucket of <key> at <now>. When the bucket is empty, the request is refused and
+// retryAfter tells when a token will be available
+func (l *Limiter) Allow(key string, now time.Time) (ok bool, retryAfter time.Duration) {
+	d := l.Take(key, l.limit, now)
+	return d.OK, d.RetryAfter
+}
+
+// Take takes a token from the bucket of <key> at <now>, with the limit <limit> instead of the one of the limiter,
+// for the keys that each have their own limit (e.g. the API keys). A new limit of a key applies from its next request
+func (l *Limiter) Take(key string, limit Limit, now time.Time) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, found := l.buckets[key]
+	if !found {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.limit = limit
+
+	// Refill the bucket for the time since the last request
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*limit.Rate)
+		b.last = now
+	}
+	b.tokens = math.Min(float64(limit.Burst), b.tokens)
+
+	d := Decision{OK: b.tokens >= 1}
+	if d.OK {
+		b.tokens--
+	} else {
+		d.RetryAfter = limit.wait(1 - b.tokens)
+	}
+
+	d.Remaining = int(b.tokens)
+	d.Reset = limit.wait(float64(limit.Burst) - b.tokens)
+
+	return d
+}
+
+// sweep forgets, at most once per sweepInterval or per time it takes to fill a bucket of the limiter, the buckets
+// that are full again, so that the clients that went away do not take up memory
+func (l *Limiter) sweep(now time.Time) {
+	every := l.limit.wait(float64(l.limit.Burst))
+	if every <= 0 || every > sweepInterval {
+		every = sweepInterval
+	}
+
+	if now.Sub(l.swept) < every {
+		return
+	}
+	l.swept = now
+
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= b.limit.wait(float64(b.limit.Burst)) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// wait returns how long it takes to get <tokens> tokens back. A limit without rate never gives them back,
+// and an hour is returned
+func (limit Limit) wait(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+
+	if limit.Rate <= 0 {
+		return time.Hour
+	}
+
+	return time.Duration(math.Ceil(tokens / limit.Rate * float64(time.Second)))
+}
@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	// 2 requests at once, then one every 30 seconds
+	l := New(Every(2, time.Minute, 2))
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("1.2.3.4", now); !ok {
+			t.Fatalf("expected request %d of the burst to be allowed", i+1)
+		}
+	}
+
+	ok, retryAfter := l.Allow("1.2.3.4", now)
+	if ok || retryAfter != 30*time.Second {
+		t.Errorf("expected the third request to be refused for 30s but got %v and %s", ok, retryAfter)
+	}
+
+	// Other keys have their own bucket
+	if ok, _ := l.Allow("5.6.7.8", now); !ok {
+		t.Error("expected another key to be allowed")
+	}
+
+	// A token is back after 30 seconds, only one
+	now = now.Add(30 * time.Second)
+	if ok, _ := l.Allow("1.2.3.4", now); !ok {
+		t.Error("expected a request to be allowed after the refill")
+	}
+	if ok, retryAfter := l.Allow("1.2.3.4", now); ok || retryAfter != 30*time.Second {
+		t.Errorf("expected the next request to be refused for 30s but got %v and %s", ok, retryAfter)
+	}
+}
+
+func TestLimiter_Sweep(t *testing.T) {
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	l := New(Every(1, time.Second, 1))
+
+	l.Allow("1.2.3.4", now)
+	l.Allow("5.6.7.8", now.Add(2*time.Second))
+
+	if len(l.buckets) != 1 {
+		t.Errorf("expected the full bucket to be forgotten but %d are kept", len(l.buckets))
+	}
+}
+
+func TestLimiter_Take(t *testing.T) {
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	l := New(Limit{})
+
+	// Every key has its own limit
+	slow := Every(1, time.Minute, 1)
+	if d := l.Take("1", slow, now); !d.OK || d.Remaining != 0 || d.Reset != time.Minute {
+		t.Errorf("expected the first request to be allowed with none left but got %+v", d)
+	}
+
+	if d := l.Take("1", slow, now); d.OK || d.RetryAfter != time.Minute {
+		t.Errorf("expected the second request to be refused for a minute but got %+v", d)
+	}
+
+	if d := l.Take("2", Every(60, time.Minute, 60), now); !d.OK || d.Remaining != 59 {
+		t.Errorf("expected the request of another key to be allowed with 59 left but got %+v", d)
+	}
+
+	// The keys that went away are forgotten
+	l.Take("3", slow, now.Add(2*time.Minute))
+	if _, ok := l.buckets["1"]; ok {
+		t.Error("expected the full bucket to be forgotten")
+	}
+}
@@ -0,0 +1,145 @@
+package render
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wagnojunior/booking/internal/i18n"
+	"github.com/wagnojunior/booking/internal/pricing"
+)
+
+// Set the path to the static files, which are served under /static
+var pathToStatic = "./static"
+
+// Map of functions that can be used in a template, usually functions that are not built into the language
+var functions = template.FuncMap{
+	"formatMoney": pricing.FormatAmount, // {{formatMoney .Total .Currency}} formats an amount of cents, e.g. $1,234.50
+	"t":           i18n.T,               // {{t .Locale "nav.home"}} translates a message of the catalogue
+	"plural":      i18n.Plural,          // {{plural .Locale "nights" 3}} translates the singular or plural message of a count
+	"formatDate":  i18n.FormatDate,      // {{formatDate .Locale .StartDate}} formats a date the way it is written in the locale
+	"isoDate":     isoDate,              // {{isoDate .ValidFrom}} formats a date as 2006-01-02
+	"dateTime":    dateTime,             // {{dateTime .CreatedAt}} formats a time as 2006-01-02 15:04
+	"urlFor":      urlFor,               // {{urlFor "admin-reservation" .ID}} builds the URL of a named route
+	"asset":       asset,                // {{asset "css/styles.css"}} is the path of a static file, fingerprinted by its content
+	"dict":        dict,                 // {{template "price-breakdown" dict "Locale" $.Locale "Price" $price}} passes several values to a partial
+}
+
+// Functions returns the functions that can be used in the templates
+func Functions() template.FuncMap {
+	return functions
+}
+
+// isoDate formats the date <t> as 2006-01-02, or returns an empty string when it is not set
+func isoDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format("2006-01-02")
+}
+
+// dateTime formats the time <t> as 2006-01-02 15:04, or returns an empty string when it is not set
+func dateTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format("2006-01-02 15:04")
+}
+
+// routes are the patterns of the routes the templates link to, by name
+var routes = map[string]string{}
+
+// NewRoutes sets the named routes that urlFor builds the URLs of, e.g. "choose-room": "/choose-room/{id}"
+func NewRoutes(r map[string]string) {
+	routes = r
+}
+
+// urlFor returns the URL of the route <name>, whose parameters are replaced by <params> in order
+func urlFor(name string, params ...interface{}) (string, error) {
+	pattern, ok := routes[name]
+	if !ok {
+		return "", fmt.Errorf("urlFor: no route named %q", name)
+	}
+
+	segments := strings.Split(pattern, "/")
+	n := 0
+	for i, s := range segments {
+		if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+			continue
+		}
+
+		if n == len(params) {
+			return "", fmt.Errorf("urlFor: route %q needs more than %d parameters", name, len(params))
+		}
+
+		segments[i] = url.PathEscape(fmt.Sprint(params[n]))
+		n++
+	}
+
+	if n != len(params) {
+		return "", fmt.Errorf("urlFor: route %q takes %d parameters but got %d", name, n, len(params))
+	}
+
+	return strings.Join(segments, "/"), nil
+}
+
+// fingerprints holds the fingerprinted paths of the static files, by path
+var fingerprints sync.Map
+
+// asset returns the path of the static file <path> with a fingerprint of its content, so that browsers can keep it
+// for as long as it does not change. The fingerprints are computed once when the template cache is used, and on every
+// call in development. A file that cannot be read gets its plain path
+func asset(path string) string {
+	useCache := app != nil && app.UseCache
+	if fingerprinted, ok := fingerprints.Load(path); ok && useCache {
+		return fingerprinted.(string)
+	}
+
+	plain := "/static/" + strings.TrimPrefix(path, "/")
+
+	f, err := os.Open(filepath.Join(pathToStatic, filepath.FromSlash(path)))
+	if err != nil {
+		return plain
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return plain
+	}
+
+	fingerprinted := plain + "?v=" + hex.EncodeToString(h.Sum(nil))[:12]
+	fingerprints.Store(path, fingerprinted)
+
+	return fingerprinted
+}
+
+// dict builds a map from the alternating keys and values <pairs>, to pass several values to a partial template
+func dict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("dict: odd number of arguments")
+	}
+
+	m := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict: key %v is not a string", pairs[i])
+		}
+
+		m[key] = pairs[i+1]
+	}
+
+	return m, nil
+}
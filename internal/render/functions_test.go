@@ -0,0 +1,79 @@
+package render
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestURLFor(t *testing.T) {
+	defer NewRoutes(testRoutes)
+	NewRoutes(map[string]string{
+		"home":                      "/",
+		"admin-reservation-invoice": "/admin/reservations/{id}/invoice",
+	})
+
+	if u, err := urlFor("admin-reservation-invoice", 7); err != nil || u != "/admin/reservations/7/invoice" {
+		t.Errorf("expected the URL of reservation 7 but got %q: %v", u, err)
+	}
+
+	if u, err := urlFor("home"); err != nil || u != "/" {
+		t.Errorf("expected the home page but got %q: %v", u, err)
+	}
+
+	if _, err := urlFor("unknown"); err == nil {
+		t.Error("expected an error for an unknown route")
+	}
+
+	if _, err := urlFor("admin-reservation-invoice"); err == nil {
+		t.Error("expected an error for a missing parameter")
+	}
+
+	if _, err := urlFor("home", 1); err == nil {
+		t.Error("expected an error for a parameter too many")
+	}
+}
+
+func TestAsset(t *testing.T) {
+	pathToStatic = "./../../static"
+
+	path := asset("css/styles.css")
+	if !strings.HasPrefix(path, "/static/css/styles.css?v=") {
+		t.Errorf("expected a fingerprinted path but got %s", path)
+	}
+
+	if again := asset("css/styles.css"); again != path {
+		t.Errorf("expected the same fingerprint but got %s and %s", path, again)
+	}
+
+	if missing := asset("css/missing.css"); missing != "/static/css/missing.css" {
+		t.Errorf("expected the plain path of a missing file but got %s", missing)
+	}
+}
+
+func TestDateFunctions(t *testing.T) {
+	date := time.Date(2022, 3, 1, 14, 30, 0, 0, time.UTC)
+
+	if isoDate(date) != "2022-03-01" || dateTime(date) != "2022-03-01 14:30" {
+		t.Errorf("unexpected formats %s and %s", isoDate(date), dateTime(date))
+	}
+
+	if isoDate(time.Time{}) != "" || dateTime(time.Time{}) != "" {
+		t.Error("expected an empty string for a time that is not set")
+	}
+}
+
+func TestDict(t *testing.T) {
+	m, err := dict("Locale", "pt", "Count", 3)
+	if err != nil || m["Locale"] != "pt" || m["Count"] != 3 {
+		t.Errorf("unexpected dict %v: %v", m, err)
+	}
+
+	if _, err := dict("Locale"); err == nil {
+		t.Error("expected an error for an odd number of arguments")
+	}
+
+	if _, err := dict(1, "pt"); err == nil {
+		t.Error("expected an error for a key that is not a string")
+	}
+}
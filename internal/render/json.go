@@ -0,0 +1,89 @@
+package render
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/wagnojunior/booking/internal/models"
+)
+
+// Page is the JSON body of a page, sent instead of the HTML to the clients that ask for JSON, e.g. the mobile app.
+// Only the pages whose handler sets TemplateData.JSON answer with JSON, and their data is that value alone
+type Page struct {
+	Data      interface{}         `json:"data,omitempty"`
+	Errors    map[string][]string `json:"errors,omitempty"` // The messages of the invalid fields of the form, by field
+	Flash     string              `json:"flash,omitempty"`
+	Warning   string              `json:"warning,omitempty"`
+	Error     string              `json:"error,omitempty"`
+	CSRFToken string              `json:"csrf_token"` // To be sent back as csrf_token with the forms that are posted
+}
+
+// WantsJSON checks if the client of the request <r> prefers JSON to HTML, that is if its Accept header lists
+// application/json with a weight at least as high as text/html
+func WantsJSON(r *http.Request) bool {
+	jsonQ, htmlQ := 0.0, 0.0
+
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+
+		switch mediaType {
+		case "application/json":
+			jsonQ = q
+		case "text/html":
+			htmlQ = q
+		}
+	}
+
+	return jsonQ > 0 && jsonQ >= htmlQ
+}
+
+// pageJSON writes the JSON body of the page with the data <td>. A form with errors is answered with
+// 422 Unprocessable Entity
+func pageJSON(w http.ResponseWriter, td *models.TemplateData) error {
+	p := Page{
+		Data:      td.JSON,
+		Flash:     td.Flash,
+		Warning:   td.Warning,
+		Error:     td.Error,
+		CSRFToken: td.CSRFToken,
+	}
+
+	status := http.StatusOK
+	if td.Form != nil && !td.Form.Valid() {
+		p.Errors = td.Form.Errors.Messages(td.Locale)
+		status = http.StatusUnprocessableEntity
+	}
+
+	return JSON(w, status, p)
+}
+
+// JSON writes <v> as the JSON body of a response with the status <status>
+func JSON(w http.ResponseWriter, status int, v interface{}) error {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	// Once the body is being sent, an error cannot be shown to the client anymore, so it is only logged
+	if _, err := w.Write(out); err != nil {
+		app.ErrorLog.Println("error writing JSON to client:", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package render
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/wagnojunior/booking/internal/forms"
+	"github.com/wagnojunior/booking/internal/models"
+)
+
+func TestWantsJSON(t *testing.T) {
+	var tests = []struct {
+		accept   string
+		expected bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", false},
+		{"application/json", true},
+		{"application/json, text/plain, */*", true},
+		{"text/html;q=0.9, application/json", true},
+		{"application/json;q=0.5, text/html", false},
+		{"application/json;q=0", false},
+	}
+
+	for _, e := range tests {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", e.accept)
+
+		if got := WantsJSON(r); got != e.expected {
+			t.Errorf("for %q, expected %t but got %t", e.accept, e.expected, got)
+		}
+	}
+}
+
+func TestTemplate_JSON(t *testing.T) {
+	r, err := getSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Accept", "application/json")
+	session.Put(r.Context(), "flash", "Saved")
+
+	form := forms.New(url.Values{})
+	form.Required("email")
+
+	rr := httptest.NewRecorder()
+	err = Template(rr, r, "login.page.tmpl", &models.TemplateData{
+		Form: form,
+		Data: map[string]interface{}{"room": models.Room{ID: 1, RoomName: "Panda Suite", ICalToken: "secret"}},
+		JSON: map[string]string{"email": ""},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rr.Code != http.StatusUnprocessableEntity || rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected the invalid form as JSON but got %d %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+
+	var p struct {
+		Data   map[string]interface{} `json:"data"`
+		Errors map[string][]string    `json:"errors"`
+		Flash  string                 `json:"flash"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := p.Data["email"]; !ok || len(p.Errors["email"]) != 1 || p.Flash != "Saved" {
+		t.Errorf("unexpected body %s", rr.Body.String())
+	}
+
+	// Only the JSON body of the page is sent, not the data of the template
+	if _, ok := p.Data["room"]; ok {
+		t.Error("expected the data of the template to be left out")
+	}
+}
@@ -0,0 +1,274 @@
+package render
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wagnojunior/booking/internal/forms"
+	"github.com/wagnojunior/booking/internal/i18n"
+	"github.com/wagnojunior/booking/internal/models"
+)
+
+// pageData returns representative data of every page template, as its handler passes it. A new page must be added
+// here, so that TestPages executes it
+func pageData() map[string]func() *models.TemplateData {
+	start := time.Date(2050, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 2)
+	created := time.Date(2050, 1, 10, 9, 30, 0, 0, time.UTC)
+
+	room := models.Room{ID: 1, RoomName: "Panda Suite", BasePrice: 12000, ICalToken: "token1"}
+	price := models.PriceQuote{
+		Currency: "USD",
+		Nights: []models.NightlyPrice{
+			{Date: start, RateName: "Standard", Amount: 12000},
+			{Date: start.AddDate(0, 0, 1), RateName: "Weekend", Amount: 15000},
+		},
+		Subtotal:  27000,
+		PromoCode: "SPRING10",
+		Discount:  2700,
+		Lines:     []models.PriceLine{{Name: "City tax", Category: models.CategoryTax, Amount: 500}},
+		Total:     24800,
+	}
+	res := models.Reservation{
+		ID:                  1,
+		Code:                "ABCD2345",
+		FirstName:           "John",
+		LastName:            "Smith",
+		Email:               "john@smith.com",
+		Phone:               "555-1234",
+		StartDate:           start,
+		EndDate:             end,
+		RoomID:              room.ID,
+		Guests:              2,
+		Status:              models.ReservationCancelled,
+		CreatedAt:           created,
+		Room:                room,
+		Price:               price,
+		CancellationSummary: "Free cancellation until 7 days before arrival",
+		RefundAmount:        24800,
+		CancelledAt:         created.AddDate(0, 0, 1),
+	}
+	promo := models.PromoCode{
+		ID:           1,
+		Code:         "SPRING10",
+		DiscountType: models.DiscountPercent,
+		Amount:       10,
+		ValidFrom:    start,
+		ValidUntil:   end,
+		MinNights:    2,
+		MaxUses:      100,
+		TimesUsed:    3,
+	}
+	key := models.APIKey{ID: 1, Name: "Travel agent", Prefix: "bk_live_abcd", Scopes: "read-availability", RateLimit: 60, LastUsedAt: created}
+	endpoint := models.WebhookEndpoint{ID: 1, URL: "https://example.com/webhooks", Secret: "whsec_secret", Events: "reservation.created", CreatedAt: created}
+	delivery := models.WebhookDelivery{
+		ID:             1,
+		EndpointID:     1,
+		Event:          models.EventReservationCreated,
+		Status:         models.DeliveryPending,
+		Attempts:       1,
+		NextAttemptAt:  created.Add(time.Minute),
+		LastStatusCode: http.StatusServiceUnavailable,
+		LastError:      "endpoint answered 503 Service Unavailable",
+		CreatedAt:      created,
+		Endpoint:       endpoint,
+	}
+
+	// A form that was posted with errors, as it is shown again to the user
+	invalid := func() *forms.Form {
+		form := forms.New(url.Values{"email": {"me"}})
+		form.Required("first_name", "last_name", "email", "password", "code", "url", "name")
+		form.IsEmail("email")
+		return form
+	}
+
+	dates := map[string]string{"start_date": "2050-03-01", "end_date": "2050-03-03"}
+	simple := func() *models.TemplateData { return &models.TemplateData{} }
+
+	return map[string]func() *models.TemplateData{
+		"home.page.tmpl":        simple,
+		"about.page.tmpl":       simple,
+		"contact.page.tmpl":     simple,
+		"panda-suite.page.tmpl": simple,
+		"bamboo-dorm.page.tmpl": simple,
+		"search-availability.page.tmpl": func() *models.TemplateData {
+			form := forms.New(url.Values{"start": {"2050/03/03"}, "end": {"2050/03/01"}})
+			form.DateAfter("end", "start", "2006/01/02")
+			return &models.TemplateData{Form: form}
+		},
+		"login.page.tmpl": func() *models.TemplateData {
+			return &models.TemplateData{Form: invalid()}
+		},
+		"register.page.tmpl": func() *models.TemplateData {
+			form := forms.New(url.Values{"email": {"me@here.ca"}, "password": {"secret123"}, "password_confirmation": {"secret"}})
+			form.Errors.Add("email", "form.email_taken")
+			form.Equal("password_confirmation", "password")
+			return &models.TemplateData{Form: form}
+		},
+		"my-bookings.page.tmpl": func() *models.TemplateData {
+			user := models.User{ID: 2, FirstName: "John", Email: "john@smith.com", AccessLevel: models.AccessGuest}
+			return &models.TemplateData{Data: map[string]interface{}{"user": user, "reservations": []models.Reservation{res}}}
+		},
+		"make-reservation.page.tmpl": func() *models.TemplateData {
+			return &models.TemplateData{Form: invalid(), Data: map[string]interface{}{"reservation": res}, StringMap: dates}
+		},
+		"choose-room.page.tmpl": func() *models.TemplateData {
+			return &models.TemplateData{Data: map[string]interface{}{
+				"rooms":       []models.Room{room},
+				"quotes":      map[int]models.PriceQuote{room.ID: price},
+				"unavailable": map[string]string{"Bamboo Dormitory": "The minimum stay is 3 nights"},
+			}}
+		},
+		"reservation-summary.page.tmpl": func() *models.TemplateData {
+			return &models.TemplateData{Data: map[string]interface{}{"reservation": res}}
+		},
+		"checkout.page.tmpl": func() *models.TemplateData {
+			return &models.TemplateData{Form: invalid(), Data: map[string]interface{}{"reservation": res}}
+		},
+		"admin-promo-codes.page.tmpl": func() *models.TemplateData {
+			return &models.TemplateData{Data: map[string]interface{}{"promo_codes": []models.PromoCode{promo}}}
+		},
+		"admin-promo-code.page.tmpl": func() *models.TemplateData {
+			return &models.TemplateData{
+				Form:      invalid(),
+				Data:      map[string]interface{}{"promo_code": promo, "rooms": []models.Room{room}},
+				StringMap: map[string]string{"amount": "10", "valid_from": "2050-03-01", "valid_until": "2050-03-03"},
+			}
+		},
+		"admin-reservations.page.tmpl": func() *models.TemplateData {
+			return &models.TemplateData{Data: map[string]interface{}{"reservations": []models.Reservation{res}}}
+		},
+		"admin-reservation.page.tmpl": func() *models.TemplateData {
+			payments := []models.Payment{{ID: 1, ReservationID: 1, ProviderRef: "pay_1", Amount: 24800, Currency: "USD", Status: models.PaymentRefunded, CreatedAt: created}}
+			return &models.TemplateData{Data: map[string]interface{}{"reservation": res, "payments": payments}, StringMap: dates}
+		},
+		"admin-rooms.page.tmpl": func() *models.TemplateData {
+			imports := map[int][]models.ICalImport{room.ID: {{ID: 1, RoomID: room.ID, URL: "https://example.com/calendar.ics", LastSyncedAt: created, LastError: "timeout"}}}
+			return &models.TemplateData{Form: invalid(), Data: map[string]interface{}{
+				"rooms":   []models.Room{room},
+				"feeds":   map[int]string{room.ID: "http://localhost/ical/1/token1.ics"},
+				"imports": imports,
+			}}
+		},
+		"admin-api-keys.page.tmpl": func() *models.TemplateData {
+			return &models.TemplateData{
+				Form:      invalid(),
+				Data:      map[string]interface{}{"api_keys": []models.APIKey{key}, "scopes": models.AllScopes},
+				StringMap: map[string]string{"api_key": "bk_live_abcd_secret"},
+			}
+		},
+		"admin-api-key.page.tmpl": func() *models.TemplateData {
+			usages := []models.APIKeyUsage{{ID: 1, APIKeyID: 1, Method: "GET", Path: "/api/v1/rooms", Status: http.StatusOK, CreatedAt: created}}
+			return &models.TemplateData{Data: map[string]interface{}{"api_key": key, "usages": usages}}
+		},
+		"admin-webhooks.page.tmpl": func() *models.TemplateData {
+			return &models.TemplateData{Form: invalid(), Data: map[string]interface{}{"endpoints": []models.WebhookEndpoint{endpoint}, "events": models.AllEvents}}
+		},
+		"admin-webhook.page.tmpl": func() *models.TemplateData {
+			return &models.TemplateData{Data: map[string]interface{}{"endpoint": endpoint, "deliveries": []models.WebhookDelivery{delivery}}}
+		},
+	}
+}
+
+// TestPages executes every page template with representative data, in every locale, so that a template that fails
+// at execution time, and not only when it is parsed, is caught
+func TestPages(t *testing.T) {
+	pathToTemplates = "./../../templates"
+	tc, err := CreateTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.TemplateCache = tc
+	app.UseCache = true
+	defer func() { app.UseCache = false }()
+
+	data := pageData()
+
+	for name := range tc {
+		newData, ok := data[name]
+		if !ok {
+			t.Errorf("%s has no representative data in pageData", name)
+			continue
+		}
+
+		for _, locale := range i18n.Locales {
+			r, err := getSession()
+			if err != nil {
+				t.Fatal(err)
+			}
+			r = r.WithContext(i18n.WithLocale(r.Context(), locale))
+
+			rr := httptest.NewRecorder()
+			if err := Template(rr, r, name, newData()); err != nil {
+				t.Errorf("%s in %s: %v", name, locale, err)
+				continue
+			}
+
+			if !strings.Contains(rr.Body.String(), "</html>") {
+				t.Errorf("%s in %s: the page is not complete", name, locale)
+			}
+		}
+	}
+}
+
+// TestTemplates_NoInlineEventHandlers checks that no template has an inline event handler, such as onsubmit, which the
+// Content-Security-Policy blocks. The scripts listen to the events in static/js/app.js instead
+func TestTemplates_NoInlineEventHandlers(t *testing.T) {
+	handler := regexp.MustCompile(`(?i)\son[a-z]+\s*=`)
+
+	pages, err := filepath.Glob("./../../templates/*.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, page := range pages {
+		content, err := os.ReadFile(page)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if found := handler.Find(content); found != nil {
+			t.Errorf("%s has the inline event handler %q", filepath.Base(page), strings.TrimSpace(string(found)))
+		}
+	}
+}
+
+func TestTemplate_ExecutionError(t *testing.T) {
+	dir := t.TempDir()
+	pathToTemplates = dir
+	defer func() { pathToTemplates = "./../../templates" }()
+
+	// The page needs a form, which it is not given
+	page := `<p>{{.Form.Error "email"}}</p>`
+	if err := os.WriteFile(filepath.Join(dir, "broken.page.tmpl"), []byte(page), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := getSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	err = Template(rr, r, "broken.page.tmpl", &models.TemplateData{})
+	if err == nil || !strings.Contains(err.Error(), "broken.page.tmpl") {
+		t.Errorf("expected an error that names the template but got %v", err)
+	}
+
+	if rr.Body.Len() != 0 {
+		t.Errorf("expected nothing to be sent but got %q", rr.Body.String())
+	}
+
+	err = Template(rr, r, "missing.page.tmpl", &models.TemplateData{})
+	if err == nil || !strings.Contains(err.Error(), "missing.page.tmpl") {
+		t.Errorf("expected an error that names the missing template but got %v", err)
+	}
+}
@@ -2,7 +2,6 @@ package render
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
@@ -10,15 +9,14 @@ import (
 
 	"github.com/justinas/nosurf"
 	"github.com/wagnojunior/booking/internal/config"
+	"github.com/wagnojunior/booking/internal/csp"
+	"github.com/wagnojunior/booking/internal/i18n"
 	"github.com/wagnojunior/booking/internal/models"
 )
 
 // Set the path to the templates
 var pathToTemplates = "./templates"
 
-// Map of functions that can be used in a template, usually functions that are not built into the language
-var functions = template.FuncMap{}
-
 // Local variable of typo <*AppConfig>
 var app *config.AppConfig
 
@@ -33,24 +31,58 @@ func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateDa
 	td.Error = app.Session.PopString(r.Context(), "error")
 	td.Warning = app.Session.PopString(r.Context(), "warning")
 	td.CSRFToken = nosurf.Token(r)
+	td.CSPNonce = csp.Nonce(r.Context())
+	td.Locale = i18n.FromContext(r.Context())
+	td.Languages = i18n.Names
+	if td.Form != nil {
+		td.Form.Locale = td.Locale
+	}
+	if app.Session.Exists(r.Context(), "user_id") {
+		td.IsAuthenticated = 1
+	}
+	if app.Session.GetInt(r.Context(), "access_level") == models.AccessAdmin {
+		td.IsAdmin = 1
+	}
 	return td
 }
 
-// Template renders a template
+// Template renders the template <tmpl> with the data <td>. The page is executed into a buffer before anything is sent,
+// so that a template that fails does not send half a page: the error, which names the template, is returned instead,
+// for the handler to answer with a server error. The clients that prefer JSON get the JSON body of the page instead,
+// when it has one
 func Template(w http.ResponseWriter, r *http.Request, tmpl string, td *models.TemplateData) error {
+	// The pages with a JSON body answer with HTML or JSON from the same URL, depending on the Accept header
+	if td.JSON != nil {
+		w.Header().Add("Vary", "Accept")
+		if WantsJSON(r) {
+			return pageJSON(w, AddDefaultData(td, r))
+		}
+	}
+
 	var tc map[string]*template.Template
+	var parseErr error // Why the watched templates do not parse, in development
+	var watching bool
 
 	if app.UseCache {
 		// get the template cache from the app config
 		tc = app.TemplateCache
-	} else {
-		tc, _ = CreateTemplateCache()
+	} else if tc, watching, parseErr = watchedTemplates(); !watching || (tc == nil && parseErr == nil) {
+		// Without the watcher, or before it has parsed the templates, they are parsed again on every request
+		var err error
+		if tc, err = CreateTemplateCache(); err != nil {
+			return err
+		}
+	} else if tc == nil {
+		// No template has parsed since the watcher started, so there is only the error to show
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(withOverlay(errorPage, parseErr))
+		return nil
 	}
 
 	t, ok := tc[tmpl]
 	if !ok {
-		// log.Fatal("Could not get template from template cache")
-		return errors.New("Can't get template from cache")
+		return fmt.Errorf("template %s is not in the template cache", tmpl)
 	}
 
 	buf := new(bytes.Buffer)
@@ -59,19 +91,28 @@ func Template(w http.ResponseWriter, r *http.Request, tmpl string, td *models.Te
 	td = AddDefaultData(td, r)
 
 	// Data is passed to the template when it is executed; in this case <td> is passed to the template
-	_ = t.Execute(buf, td)
+	if err := t.Execute(buf, td); err != nil {
+		return fmt.Errorf("executing template %s: %w", tmpl, err)
+	}
 
-	_, err := buf.WriteTo(w)
-	if err != nil {
-		fmt.Println("error writing template to browser", err)
-		return err
+	page := buf.Bytes()
+	if parseErr != nil {
+		page = withOverlay(page, parseErr)
 	}
 
-	return nil
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	// Once the page is being sent, an error cannot be shown to the browser anymore, so it is only logged
+	if _, err := w.Write(page); err != nil {
+		app.ErrorLog.Println("error writing template", tmpl, "to browser:", err)
+	}
 
+	return nil
 }
 
-// CreateTemplateCache creates a template cache as a map
+// CreateTemplateCache creates a template cache as a map. Every page is parsed with the layouts (*.layout.tmpl) and
+// the partials (*.partial.tmpl), the shared fragments that pages and layouts include with {{template "name" .}}.
+// It stops at the first template that does not parse, whose error tells the file and the line
 func CreateTemplateCache() (map[string]*template.Template, error) {
 
 	// <myCache> maps a string to a pointer to <template.Template>
@@ -80,7 +121,19 @@ func CreateTemplateCache() (map[string]*template.Template, error) {
 	// Gets the file path of all files in the folder <templates> that end with <.page.tmpl>
 	pages, err := filepath.Glob(fmt.Sprintf("%s/*.page.tmpl", pathToTemplates))
 	if err != nil {
-		return myCache, err
+		return nil, err
+	}
+
+	// The layouts and the partials are shared by all the pages
+	var shared []string
+	for _, pattern := range []string{"*.layout.tmpl", "*.partial.tmpl"} {
+		// <Glob> returns the names of all files matching pattern or nil if there is no matching file
+		matches, err := filepath.Glob(filepath.Join(pathToTemplates, pattern))
+		if err != nil {
+			return nil, err
+		}
+
+		shared = append(shared, matches...)
 	}
 
 	// Loop through all the pages
@@ -93,23 +146,13 @@ func CreateTemplateCache() (map[string]*template.Template, error) {
 		// <ParseFiles> parses the named files and associates the resulting templates with t
 		ts, err := template.New(name).Funcs(functions).ParseFiles(page)
 		if err != nil {
-			return myCache, err
-		}
-
-		// <Glob> returns the names of all files matching pattern or nil if there is no matching file
-		matches, err := filepath.Glob(fmt.Sprintf("%s/*.layout.tmpl", pathToTemplates))
-		if err != nil {
-			return myCache, err
+			return nil, fmt.Errorf("parsing %s: %w", page, err)
 		}
 
-		// If the length of <matches> is grater than zero, there are might be layouts associated with templates
-		// In fact, this is the case for <about.page.tmpl> and <home.page.tmpl> which reference <base.layout.tmpl>
-		if len(matches) > 0 {
-			// ParseGlob parses the template definitions in the files identified by the pattern and associates the
-			//resulting templates with t.
-			ts, err = ts.ParseGlob(fmt.Sprintf("%s/*.layout.tmpl", pathToTemplates))
-			if err != nil {
-				return myCache, err
+		// The shared files are parsed one at a time, so that an error names the file that caused it
+		for _, file := range shared {
+			if ts, err = ts.ParseFiles(file); err != nil {
+				return nil, fmt.Errorf("parsing %s with %s: %w", name, file, err)
 			}
 		}
 
@@ -2,6 +2,9 @@ package render
 
 import (
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/wagnojunior/booking/internal/models"
@@ -75,3 +78,40 @@ func TestCreateTemplateCache(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestCreateTemplateCache_ParseError(t *testing.T) {
+	dir := t.TempDir()
+	pathToTemplates = dir
+	defer func() { pathToTemplates = "./../../templates" }()
+
+	files := map[string]string{
+		"home.page.tmpl":        `{{template "base" .}}{{define "content"}}{{template "greeting" .}}{{end}}`,
+		"base.layout.tmpl":      `{{define "base"}}{{block "content" .}}{{end}}{{end}}`,
+		"greeting.partial.tmpl": "{{define \"greeting\"}}\nHello\n{{unknownFunction}}\n{{end}}",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := CreateTemplateCache()
+	if err == nil || !strings.Contains(err.Error(), "greeting.partial.tmpl:3") {
+		t.Errorf("expected an error that points at the line of the partial but got %v", err)
+	}
+
+	// Once the partial is fixed, the page includes it
+	if err := os.WriteFile(filepath.Join(dir, "greeting.partial.tmpl"), []byte(`{{define "greeting"}}Hello{{end}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tc, err := CreateTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	if err := tc["home.page.tmpl"].Execute(&out, nil); err != nil || out.String() != "Hello" {
+		t.Errorf("expected the page to include the partial but got %q: %v", out.String(), err)
+	}
+}
@@ -16,6 +16,17 @@ import (
 var session *scs.SessionManager
 var testApp config.AppConfig
 
+// testRoutes are the named routes that the templates link to
+var testRoutes = map[string]string{
+	"choose-room":               "/choose-room/{id}",
+	"language":                  "/language/{locale}",
+	"admin-promo-code":          "/admin/promo-codes/{id}",
+	"admin-api-key":             "/admin/api-keys/{id}",
+	"admin-webhook":             "/admin/webhooks/{id}",
+	"admin-reservation":         "/admin/reservations/{id}",
+	"admin-reservation-invoice": "/admin/reservations/{id}/invoice",
+}
+
 // This function is called before any of the tests are run, executes the body, and
 // then call the tests themselves
 func TestMain(m *testing.M) {
@@ -45,15 +56,20 @@ func TestMain(m *testing.M) {
 
 	// app is defined in rander.go
 	app = &testApp
+	NewRoutes(testRoutes)
 
 	os.Exit(m.Run())
 }
 
-type myWrite struct{}
+type myWrite struct {
+	h http.Header
+}
 
 func (tw *myWrite) Header() http.Header {
-	var h http.Header
-	return h
+	if tw.h == nil {
+		tw.h = http.Header{}
+	}
+	return tw.h
 }
 
 func (tw *myWrite) WriteHeader(i int) {
@@ -0,0 +1,118 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// watched is the template cache kept up to date with the template files in development, when the cache of the app is
+// not used. It replaces parsing every template on every request
+var watched struct {
+	sync.RWMutex
+	watching  bool                          // Whether the templates are watched, that is ReloadTemplates has run
+	cache     map[string]*template.Template // The last templates that parsed. nil when none has parsed yet
+	err       error                         // Why the templates do not parse now. nil when they do
+	signature string                        // Names, sizes and modification times of the files the cache was built from
+}
+
+// ReloadTemplates parses the templates again when their files have changed since the last call. When they do not
+// parse, the last templates that did are kept and the error is shown over the pages until the files are fixed
+func ReloadTemplates() {
+	signature, err := templatesSignature()
+	if err != nil {
+		app.ErrorLog.Println("error reading the templates:", err)
+
+		watched.Lock()
+		watched.watching, watched.err = true, err
+		watched.Unlock()
+		return
+	}
+
+	watched.RLock()
+	unchanged := watched.signature != "" && signature == watched.signature
+	watched.RUnlock()
+
+	if unchanged {
+		return
+	}
+
+	tc, err := CreateTemplateCache()
+
+	watched.Lock()
+	defer watched.Unlock()
+
+	watched.watching = true
+	watched.signature = signature
+	watched.err = err
+	if err != nil {
+		app.ErrorLog.Println("error parsing the templates, the last ones that parsed are kept:", err)
+		return
+	}
+
+	watched.cache = tc
+	app.InfoLog.Println("Templates reloaded")
+}
+
+// watchedTemplates returns the watched template cache, or false when the templates are not watched, and why the
+// templates do not parse now. The cache is nil while no template has parsed since the watcher started
+func watchedTemplates() (map[string]*template.Template, bool, error) {
+	watched.RLock()
+	defer watched.RUnlock()
+
+	return watched.cache, watched.watching, watched.err
+}
+
+// templatesSignature returns the names, sizes and modification times of the template files, which change whenever
+// a file is edited, added or removed
+func templatesSignature() (string, error) {
+	files, err := filepath.Glob(filepath.Join(pathToTemplates, "*.tmpl"))
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+
+	var b strings.Builder
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(&b, "%s:%d:%d\n", filepath.Base(file), info.Size(), info.ModTime().UnixNano())
+	}
+
+	return b.String(), nil
+}
+
+// overlay is shown over the pages in development while the templates do not parse
+var overlay = template.Must(template.New("overlay").Parse(`
+<div style="position: fixed; inset: 0; z-index: 10000; overflow: auto; padding: 2rem; background: rgba(0, 0, 0, 0.85); color: #fff; font-family: monospace;">
+    <h2 style="color: #ff6b6b;">The templates do not parse</h2>
+    <p>This page was rendered from the last templates that did. It is shown again as soon as the files are fixed.</p>
+    <pre style="white-space: pre-wrap; color: #ffd1d1;">{{.}}</pre>
+</div>
+`))
+
+// errorPage is the page under the overlay when no template has parsed, so that there is no page to show it over
+var errorPage = []byte("<!DOCTYPE html>\n<html>\n<body>\n</body>\n</html>\n")
+
+// withOverlay returns the page <page> with the overlay of the parse error <err>, just before the end of its body
+func withOverlay(page []byte, err error) []byte {
+	var o bytes.Buffer
+	if execErr := overlay.Execute(&o, err.Error()); execErr != nil {
+		return page
+	}
+
+	i := bytes.LastIndex(page, []byte("</body>"))
+	if i < 0 {
+		return append(page, o.Bytes()...)
+	}
+
+	return append(page[:i:i], append(o.Bytes(), page[i:]...)...)
+}
@@ -0,0 +1,73 @@
+package render
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wagnojunior/booking/internal/models"
+)
+
+func TestReloadTemplates(t *testing.T) {
+	dir := t.TempDir()
+	pathToTemplates = dir
+	defer func() {
+		pathToTemplates = "./../../templates"
+		watched.watching, watched.cache, watched.err, watched.signature = false, nil, nil, ""
+	}()
+
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	render := func() string {
+		r, err := getSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		if err := Template(rr, r, "home.page.tmpl", &models.TemplateData{}); err != nil {
+			t.Fatal(err)
+		}
+
+		return rr.Body.String()
+	}
+
+	write("base.layout.tmpl", `{{define "base"}}<body>{{block "content" .}}{{end}}</body>{{end}}`)
+
+	// Until the templates first parse, the error is shown on a page of its own
+	write("home.page.tmpl", `{{template "base" .}}{{define "content"}}first{{end`)
+
+	ReloadTemplates()
+	if page := render(); !strings.Contains(page, "home.page.tmpl") || !strings.Contains(page, "do not parse") {
+		t.Errorf("expected the error of the templates but got %q", page)
+	}
+
+	write("home.page.tmpl", `{{template "base" .}}{{define "content"}}first{{end}}`)
+
+	ReloadTemplates()
+	if page := render(); page != "<body>first</body>" {
+		t.Errorf("expected the first version of the page but got %q", page)
+	}
+
+	// A change that does not parse keeps the last templates, with the error over the page
+	write("home.page.tmpl", `{{template "base" .}}{{define "content"}}second{{end`)
+
+	ReloadTemplates()
+	page := render()
+	if !strings.Contains(page, "first") || !strings.Contains(page, "home.page.tmpl") || !strings.HasSuffix(page, "</body>") {
+		t.Errorf("expected the first version of the page with the error but got %q", page)
+	}
+
+	// Once fixed, the change is shown
+	write("home.page.tmpl", `{{template "base" .}}{{define "content"}}second version{{end}}`)
+
+	ReloadTemplates()
+	if page := render(); page != "<body>second version</body>" {
+		t.Errorf("expected the second version of the page but got %q", page)
+	}
+}
@@ -2,27 +2,88 @@ package dbrepo
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/wagnojunior/booking/internal/models"
+	"github.com/wagnojunior/booking/internal/repository"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func (m *postgresDBRepo) AllUsers() bool {
 	return true
 }
 
-// InsertReservation inserts a reservations into the database
+// InsertReservation inserts a reservation into the database with the room restriction that holds its room, and counts
+// the use of its promo code, in one transaction. When the promo code reached its usage limit, nothing is inserted and
+// repository.ErrPromoCodeUsedUp is returned
 func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	var newID int
 
+	// The price breakdown is stored as it was at booking time, so later rate changes do not alter it
+	priceDetails, err := json.Marshal(res.Price)
+	if err != nil {
+		return 0, err
+	}
+
+	// So is the cancellation policy, which decides the refund if the reservation is cancelled
+	cancellationPolicy, err := json.Marshal(res.CancellationPolicy)
+	if err != nil {
+		return 0, err
+	}
+
+	var promoCodeID sql.NullInt64
+	if res.PromoCodeID > 0 {
+		promoCodeID = sql.NullInt64{Int64: int64(res.PromoCodeID), Valid: true}
+	}
+
+	var userID sql.NullInt64
+	if res.UserID > 0 {
+		userID = sql.NullInt64{Int64: int64(res.UserID), Valid: true}
+	}
+
+	var expiresAt sql.NullTime
+	if !res.ExpiresAt.IsZero() {
+		expiresAt = sql.NullTime{Time: res.ExpiresAt, Valid: true}
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if res.PromoCodeID > 0 {
+		stmt := `update promo_codes set times_used = times_used + 1, updated_at = $2
+			where id = $1 and (max_uses = 0 or times_used < max_uses)`
+
+		result, err := tx.ExecContext(ctx, stmt, res.PromoCodeID, m.App.Clock.Now())
+		if err != nil {
+			return 0, err
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+
+		if n == 0 {
+			return 0, repository.ErrPromoCodeUsedUp
+		}
+	}
+
 	stmt := `insert into reservations (first_name, last_name, email, phone,
-			start_date, end_date, room_id, created_at, updated_at)
-			values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+			start_date, end_date, room_id, created_at, updated_at, total_price, price_details,
+			promo_code_id, discount, guests, status, cancellation_policy, cancellation_summary, code, user_id, expires_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20) returning id`
 
-	err := m.DB.QueryRowContext(
+	err = tx.QueryRowContext(
 		ctx,
 		stmt,
 		res.FirstName,
@@ -32,38 +93,53 @@ func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error)
 		res.StartDate,
 		res.EndDate,
 		res.RoomID,
-		time.Now(),
-		time.Now(),
+		m.App.Clock.Now(),
+		m.App.Clock.Now(),
+		res.Price.Total,
+		string(priceDetails),
+		promoCodeID,
+		res.Price.Discount,
+		res.Guests,
+		res.Status,
+		string(cancellationPolicy),
+		res.CancellationSummary,
+		res.Code,
+		userID,
+		expiresAt,
 	).Scan(&newID)
 
 	if err != nil {
 		return 0, err
 	}
 
+	restriction := models.RoomRestriction{
+		StartDate:     res.StartDate,
+		EndDate:       res.EndDate,
+		RoomID:        res.RoomID,
+		ReservationID: newID,
+		RestrictionID: models.RestrictionReservation,
+	}
+
+	_, err = tx.ExecContext(ctx, insertRoomRestriction, roomRestrictionArgs(restriction, m.App.Clock.Now())...)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
 	return newID, nil
 }
 
-// InsertRoomRestriction inserts a room restriction into the database
-func (m *postgresDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
+// UpdateReservationStatus updates the status of a reservation
+func (m *postgresDBRepo) UpdateReservationStatus(id int, status string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	stmt := `insert into room_restrictions (start_date, end_date, room_id, reservation_id,
-			created_at, updated_at, restriction_id)
-			values ($1, $2, $3, $4, $5, $6, $7)`
-
-	_, err := m.DB.ExecContext(
-		ctx,
-		stmt,
-		r.StartDate,
-		r.EndDate,
-		r.RoomID,
-		r.ReservationID,
-		time.Now(),
-		time.Now(),
-		r.RestrictionID,
-	)
+	stmt := `update reservations set status = $1, updated_at = $2 where id = $3`
 
+	_, err := m.DB.ExecContext(ctx, stmt, status, m.App.Clock.Now(), id)
 	if err != nil {
 		return err
 	}
@@ -71,101 +147,1921 @@ func (m *postgresDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
 	return nil
 }
 
-// SearchAvailabilityByDatesByRoomID returns true if availability exists for roomID and false otherwise
-func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
-	var numRows int
+// reservationColumns are the columns scanned by scanReservation, in order. The reservations table is aliased r
+// and joined with the rooms table aliased rm
+const reservationColumns = `r.id, r.code, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date,
+	r.room_id, r.guests, r.status, r.promo_code_id, r.total_price, r.price_details, r.cancellation_policy,
+	r.cancellation_summary, r.refund_amount, r.cancelled_at, r.user_id, r.expires_at, r.created_at, r.updated_at, rm.room_name`
+
+// scanReservation scans a row selected with reservationColumns into a reservation
+func scanReservation(row interface{ Scan(dest ...any) error }) (models.Reservation, error) {
+	var res models.Reservation
+	var promoCodeID, userID sql.NullInt64
+	var cancelledAt, expiresAt sql.NullTime
+	var priceDetails, cancellationPolicy string
+
+	err := row.Scan(
+		&res.ID,
+		&res.Code,
+		&res.FirstName,
+		&res.LastName,
+		&res.Email,
+		&res.Phone,
+		&res.StartDate,
+		&res.EndDate,
+		&res.RoomID,
+		&res.Guests,
+		&res.Status,
+		&promoCodeID,
+		&res.Price.Total,
+		&priceDetails,
+		&cancellationPolicy,
+		&res.CancellationSummary,
+		&res.RefundAmount,
+		&cancelledAt,
+		&userID,
+		&expiresAt,
+		&res.CreatedAt,
+		&res.UpdatedAt,
+		&res.Room.RoomName,
+	)
+	if err != nil {
+		return res, err
+	}
+
+	res.PromoCodeID = int(promoCodeID.Int64)
+	res.UserID = int(userID.Int64)
+	res.CancelledAt = cancelledAt.Time
+	res.ExpiresAt = expiresAt.Time
+	res.Room.ID = res.RoomID
+
+	// Reservations made before the price breakdown and the cancellation policy were stored only have a total
+	if priceDetails != "" {
+		if err = json.Unmarshal([]byte(priceDetails), &res.Price); err != nil {
+			return res, err
+		}
+	}
+
+	if cancellationPolicy != "" {
+		if err = json.Unmarshal([]byte(cancellationPolicy), &res.CancellationPolicy); err != nil {
+			return res, err
+		}
+	}
+
+	return res, nil
+}
 
+// AllReservations returns all reservations, the most recent arrivals first
+func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	var reservations []models.Reservation
+
 	query := `
-	select
-		count(id)
-	from
-		room_restrictions
-	where
-		room_id = $1
-		and $2 < end_date and $3 > start_date;
+		select ` + reservationColumns + `
+		from reservations r
+		left join rooms rm on (r.room_id = rm.id)
+		order by r.start_date desc, r.id desc
 	`
 
-	row := m.DB.QueryRowContext(ctx, query, roomID, start, end)
-	err := row.Scan(&numRows)
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		res, err := scanReservation(rows)
+		if err != nil {
+			return reservations, err
+		}
+
+		reservations = append(reservations, res)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+// GetReservationByID returns a reservation by ID
+func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		select ` + reservationColumns + `
+		from reservations r
+		left join rooms rm on (r.room_id = rm.id)
+		where r.id = $1
+	`
+
+	return scanReservation(m.DB.QueryRowContext(ctx, query, id))
+}
+
+// GetReservationByCode returns a reservation by its confirmation code, ignoring the case
+func (m *postgresDBRepo) GetReservationByCode(code string) (models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		select ` + reservationColumns + `
+		from reservations r
+		left join rooms rm on (r.room_id = rm.id)
+		where r.code = $1
+	`
+
+	return scanReservation(m.DB.QueryRowContext(ctx, query, strings.ToUpper(code)))
+}
+
+// GetReservationsByUserID returns the reservations linked to the account of a guest, the most recent arrivals first
+func (m *postgresDBRepo) GetReservationsByUserID(userID int) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := `
+		select ` + reservationColumns + `
+		from reservations r
+		left join rooms rm on (r.room_id = rm.id)
+		where r.user_id = $1
+		order by r.start_date desc, r.id desc
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		res, err := scanReservation(rows)
+		if err != nil {
+			return reservations, err
+		}
+
+		reservations = append(reservations, res)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+// LinkReservationsByEmail links to a user the reservations made with its email, ignoring the case, that are not
+// linked to an account yet. It returns how many were linked
+func (m *postgresDBRepo) LinkReservationsByEmail(userID int, email string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update reservations set user_id = $1, updated_at = $2
+			where user_id is null and lower(email) = lower($3)`
+
+	result, err := m.DB.ExecContext(ctx, stmt, userID, m.App.Clock.Now(), email)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
+
+// CancelReservation marks a reservation as cancelled with the amount refunded to the guest and frees its room. It tells
+// if it did: a reservation that is already cancelled is left as it is
+func (m *postgresDBRepo) CancelReservation(id int, refundAmount int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return false, err
 	}
+	defer tx.Rollback()
 
-	if numRows == 0 {
-		return true, nil
+	stmt := `update reservations set status = $1, refund_amount = $2, cancelled_at = $3, updated_at = $3
+			where id = $4 and status <> $1`
+
+	result, err := tx.ExecContext(ctx, stmt, models.ReservationCancelled, refundAmount, m.App.Clock.Now(), id)
+	if err != nil {
+		return false, err
 	}
 
-	return false, nil
+	n, err := result.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from room_restrictions where reservation_id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+
+	return true, nil
 }
 
-// SearchAvailabilityForAllRooms returns a slice of available rooms if any for given data range
-func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
+// ExpirePendingReservations cancels the pending reservations whose hold expired before <before>, frees their rooms
+// and returns them
+func (m *postgresDBRepo) ExpirePendingReservations(before time.Time) ([]models.Reservation, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	var rooms []models.Room
+	var expired []models.Reservation
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return expired, err
+	}
+	defer tx.Rollback()
+
+	stmt := `update reservations set status = $1, cancelled_at = $2, updated_at = $2
+			where status = $3 and expires_at < $4
+			returning id`
+
+	rows, err := tx.QueryContext(ctx, stmt, models.ReservationCancelled, m.App.Clock.Now(), models.ReservationPending, before)
+	if err != nil {
+		return expired, err
+	}
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return expired, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return expired, err
+	}
+
+	for _, id := range ids {
+		_, err = tx.ExecContext(ctx, `delete from room_restrictions where reservation_id = $1`, id)
+		if err != nil {
+			return expired, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return expired, err
+	}
+
+	for _, id := range ids {
+		res, err := m.GetReservationByID(id)
+		if err != nil {
+			return expired, err
+		}
+		expired = append(expired, res)
+	}
+
+	return expired, nil
+}
+
+// InsertRoomRestriction inserts a room restriction into the database
+func (m *postgresDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, insertRoomRestriction, roomRestrictionArgs(r, m.App.Clock.Now())...)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// insertRoomRestriction is the statement that inserts the room restriction of roomRestrictionArgs
+const insertRoomRestriction = `insert into room_restrictions (start_date, end_date, room_id, reservation_id,
+	created_at, updated_at, restriction_id, ical_import_id, external_uid)
+	values ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+// roomRestrictionArgs returns the arguments of insertRoomRestriction for <r>, created at <now>. Blocks have no
+// reservation and restrictions made here have no calendar import
+func roomRestrictionArgs(r models.RoomRestriction, now time.Time) []any {
+	var reservationID, icalImportID sql.NullInt64
+	if r.ReservationID > 0 {
+		reservationID = sql.NullInt64{Int64: int64(r.ReservationID), Valid: true}
+	}
+	if r.ICalImportID > 0 {
+		icalImportID = sql.NullInt64{Int64: int64(r.ICalImportID), Valid: true}
+	}
+
+	return []any{
+		r.StartDate,
+		r.EndDate,
+		r.RoomID,
+		reservationID,
+		now,
+		now,
+		r.RestrictionID,
+		icalImportID,
+		r.ExternalUID,
+	}
+}
+
+// GetRoomRestrictionsByRoomID returns all restrictions of roomID, with their reservation and type, by arrival
+func (m *postgresDBRepo) GetRoomRestrictionsByRoomID(roomID int) ([]models.RoomRestriction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var restrictions []models.RoomRestriction
 
 	query := `
-		select 
-			r.id, r.room_name
+		select
+			rr.id, rr.start_date, rr.end_date, rr.room_id, coalesce(rr.reservation_id, 0), rr.restriction_id,
+			rr.created_at, rr.updated_at, coalesce(r.code, ''), coalesce(r.first_name, ''), coalesce(r.last_name, ''),
+			rs.restriction_name
 		from
-			rooms r
+			room_restrictions rr
+			left join reservations r on (rr.reservation_id = r.id)
+			left join restrictions rs on (rr.restriction_id = rs.id)
 		where
-			r.id not in
-				(select rr.room_id from room_restrictions rr where $1 < rr.end_date and $2 > rr.start_date)
+			rr.room_id = $1
+		order by
+			rr.start_date, rr.id
 	`
-	rows, err := m.DB.QueryContext(ctx, query, start, end)
+
+	rows, err := m.DB.QueryContext(ctx, query, roomID)
 	if err != nil {
-		return rooms, err
+		return restrictions, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
-		var room models.Room
+		var rr models.RoomRestriction
 
 		err := rows.Scan(
-			&room.ID,
-			&room.RoomName,
+			&rr.ID,
+			&rr.StartDate,
+			&rr.EndDate,
+			&rr.RoomID,
+			&rr.ReservationID,
+			&rr.RestrictionID,
+			&rr.CreatedAt,
+			&rr.UpdatedAt,
+			&rr.Reservation.Code,
+			&rr.Reservation.FirstName,
+			&rr.Reservation.LastName,
+			&rr.Restriction.RestrictionName,
 		)
 		if err != nil {
-			return rooms, err
+			return restrictions, err
 		}
 
-		rooms = append(rooms, room)
+		rr.Reservation.ID = rr.ReservationID
+		rr.Restriction.ID = rr.RestrictionID
+		restrictions = append(restrictions, rr)
 	}
 
 	if err = rows.Err(); err != nil {
-		return rooms, err
+		return restrictions, err
 	}
 
-	return rooms, nil
-
+	return restrictions, nil
 }
 
-// GetRoomByID gets a room by ID
-func (m *postgresDBRepo) GetRoomByID(id int) (models.Room, error) {
+// GetRoomRestrictionsByICalImportID returns the restrictions imported by a calendar import
+func (m *postgresDBRepo) GetRoomRestrictionsByICalImportID(importID int) ([]models.RoomRestriction, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	var room models.Room
+	var restrictions []models.RoomRestriction
 
 	query := `
-		select id, room_name, created_at, updated_at from rooms where id = $1
+		select id, start_date, end_date, room_id, restriction_id, ical_import_id, external_uid, created_at, updated_at
+		from room_restrictions where ical_import_id = $1 order by start_date
 	`
 
-	row := m.DB.QueryRowContext(ctx, query, id)
-	err := row.Scan(
-		&room.ID,
-		&room.RoomName,
-		&room.CreatedAt,
-		&room.UpdatedAt,
-	)
-
+	rows, err := m.DB.QueryContext(ctx, query, importID)
 	if err != nil {
-		return room, err
+		return restrictions, err
 	}
+	defer rows.Close()
 
-	return room, nil
+	for rows.Next() {
+		var rr models.RoomRestriction
+
+		err := rows.Scan(
+			&rr.ID,
+			&rr.StartDate,
+			&rr.EndDate,
+			&rr.RoomID,
+			&rr.RestrictionID,
+			&rr.ICalImportID,
+			&rr.ExternalUID,
+			&rr.CreatedAt,
+			&rr.UpdatedAt,
+		)
+		if err != nil {
+			return restrictions, err
+		}
+
+		restrictions = append(restrictions, rr)
+	}
+
+	if err = rows.Err(); err != nil {
+		return restrictions, err
+	}
+
+	return restrictions, nil
+}
+
+// SyncRoomRestrictions inserts, updates the dates of and deletes room restrictions, all or none of them
+func (m *postgresDBRepo) SyncRoomRestrictions(insert, update []models.RoomRestriction, remove []int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, r := range insert {
+		_, err = tx.ExecContext(ctx, insertRoomRestriction, roomRestrictionArgs(r, m.App.Clock.Now())...)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, r := range update {
+		stmt := `update room_restrictions set start_date = $1, end_date = $2, updated_at = $3 where id = $4`
+
+		_, err = tx.ExecContext(ctx, stmt, r.StartDate, r.EndDate, m.App.Clock.Now(), r.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, id := range remove {
+		_, err = tx.ExecContext(ctx, `delete from room_restrictions where id = $1`, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SearchAvailabilityByDatesByRoomID returns true if availability exists for roomID and false otherwise
+func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
+	var numRows int
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+	select
+		count(id)
+	from
+		room_restrictions
+	where
+		room_id = $1
+		and $2 < end_date and $3 > start_date;
+	`
+
+	row := m.DB.QueryRowContext(ctx, query, roomID, start, end)
+	err := row.Scan(&numRows)
+	if err != nil {
+		return false, err
+	}
+
+	if numRows == 0 {
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// SearchAvailabilityForAllRooms returns a slice of available rooms if any for given data range
+func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rooms []models.Room
+
+	query := `
+		select 
+			r.id, r.room_name, r.base_price
+		from
+			rooms r
+		where
+			r.id not in
+				(select rr.room_id from room_restrictions rr where $1 < rr.end_date and $2 > rr.start_date)
+	`
+	rows, err := m.DB.QueryContext(ctx, query, start, end)
+	if err != nil {
+		return rooms, err
+	}
+
+	for rows.Next() {
+		var room models.Room
+
+		err := rows.Scan(
+			&room.ID,
+			&room.RoomName,
+			&room.BasePrice,
+		)
+		if err != nil {
+			return rooms, err
+		}
+
+		rooms = append(rooms, room)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rooms, err
+	}
+
+	return rooms, nil
+
+}
+
+// GetRoomByID gets a room by ID
+func (m *postgresDBRepo) GetRoomByID(id int) (models.Room, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var room models.Room
+
+	query := `
+		select id, room_name, base_price, ical_token, created_at, updated_at from rooms where id = $1
+	`
+
+	row := m.DB.QueryRowContext(ctx, query, id)
+	err := row.Scan(
+		&room.ID,
+		&room.RoomName,
+		&room.BasePrice,
+		&room.ICalToken,
+		&room.CreatedAt,
+		&room.UpdatedAt,
+	)
+
+	if err != nil {
+		return room, err
+	}
+
+	return room, nil
+}
+
+// GetRatesByRoomID returns the rates of roomID that overlap with the given date range
+func (m *postgresDBRepo) GetRatesByRoomID(roomID int, start, end time.Time) ([]models.RoomRate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rates []models.RoomRate
+
+	query := `
+		select
+			id, room_id, rate_name, start_date, end_date, weekdays, price, priority, created_at, updated_at
+		from
+			room_rates
+		where
+			room_id = $1
+			and start_date < $3 and end_date >= $2
+		order by
+			priority desc, start_date
+	`
+	rows, err := m.DB.QueryContext(ctx, query, roomID, start, end)
+	if err != nil {
+		return rates, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rate models.RoomRate
+
+		err := rows.Scan(
+			&rate.ID,
+			&rate.RoomID,
+			&rate.RateName,
+			&rate.StartDate,
+			&rate.EndDate,
+			&rate.Weekdays,
+			&rate.Price,
+			&rate.Priority,
+			&rate.CreatedAt,
+			&rate.UpdatedAt,
+		)
+		if err != nil {
+			return rates, err
+		}
+
+		rates = append(rates, rate)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rates, err
+	}
+
+	return rates, nil
+}
+
+// GetStayRulesByRoomID returns the stay rules that apply to stays in roomID arriving on the given date.
+// Rules that apply to every room are always included
+func (m *postgresDBRepo) GetStayRulesByRoomID(roomID int, arrival time.Time) ([]models.StayRule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rules []models.StayRule
+
+	query := `
+		select
+			id, room_id, start_date, end_date, min_nights, max_nights, min_advance_days, max_advance_days,
+			closed_to_arrival, closed_to_departure, created_at, updated_at
+		from
+			stay_rules
+		where
+			(room_id = $1 or room_id is null)
+			and start_date <= $2 and end_date >= $2
+	`
+	rows, err := m.DB.QueryContext(ctx, query, roomID, arrival)
+	if err != nil {
+		return rules, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rule models.StayRule
+		var ruleRoomID sql.NullInt64
+
+		err := rows.Scan(
+			&rule.ID,
+			&ruleRoomID,
+			&rule.StartDate,
+			&rule.EndDate,
+			&rule.MinNights,
+			&rule.MaxNights,
+			&rule.MinAdvanceDays,
+			&rule.MaxAdvanceDays,
+			&rule.ClosedToArrival,
+			&rule.ClosedToDeparture,
+			&rule.CreatedAt,
+			&rule.UpdatedAt,
+		)
+		if err != nil {
+			return rules, err
+		}
+
+		rule.RoomID = int(ruleRoomID.Int64)
+		rules = append(rules, rule)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rules, err
+	}
+
+	return rules, nil
+}
+
+// GetFeeRulesByRoomID returns the tax and fee rules that apply to roomID, including those that apply to every room
+func (m *postgresDBRepo) GetFeeRulesByRoomID(roomID int) ([]models.FeeRule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rules []models.FeeRule
+
+	query := `
+		select
+			id, name, category, kind, amount, room_id, created_at, updated_at
+		from
+			fee_rules
+		where
+			room_id = $1 or room_id is null
+		order by
+			id
+	`
+	rows, err := m.DB.QueryContext(ctx, query, roomID)
+	if err != nil {
+		return rules, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rule models.FeeRule
+		var ruleRoomID sql.NullInt64
+
+		err := rows.Scan(
+			&rule.ID,
+			&rule.Name,
+			&rule.Category,
+			&rule.Kind,
+			&rule.Amount,
+			&ruleRoomID,
+			&rule.CreatedAt,
+			&rule.UpdatedAt,
+		)
+		if err != nil {
+			return rules, err
+		}
+
+		rule.RoomID = int(ruleRoomID.Int64)
+		rules = append(rules, rule)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rules, err
+	}
+
+	return rules, nil
+}
+
+// GetCancellationPoliciesByRoomID returns the cancellation policies that apply to roomID, including those that
+// apply to every room
+func (m *postgresDBRepo) GetCancellationPoliciesByRoomID(roomID int) ([]models.CancellationPolicy, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var policies []models.CancellationPolicy
+
+	query := `
+		select
+			id, name, free_until_days, penalty_percent, non_refundable, room_id, rate_name, created_at, updated_at
+		from
+			cancellation_policies
+		where
+			room_id = $1 or room_id is null
+		order by
+			id
+	`
+	rows, err := m.DB.QueryContext(ctx, query, roomID)
+	if err != nil {
+		return policies, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var policy models.CancellationPolicy
+		var policyRoomID sql.NullInt64
+
+		err := rows.Scan(
+			&policy.ID,
+			&policy.Name,
+			&policy.FreeUntilDays,
+			&policy.PenaltyPercent,
+			&policy.NonRefundable,
+			&policyRoomID,
+			&policy.RateName,
+			&policy.CreatedAt,
+			&policy.UpdatedAt,
+		)
+		if err != nil {
+			return policies, err
+		}
+
+		policy.RoomID = int(policyRoomID.Int64)
+		policies = append(policies, policy)
+	}
+
+	if err = rows.Err(); err != nil {
+		return policies, err
+	}
+
+	return policies, nil
+}
+
+// AllRooms returns all rooms
+func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rooms []models.Room
+
+	query := `select id, room_name, base_price, ical_token, created_at, updated_at from rooms order by room_name`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return rooms, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var room models.Room
+
+		err := rows.Scan(
+			&room.ID,
+			&room.RoomName,
+			&room.BasePrice,
+			&room.ICalToken,
+			&room.CreatedAt,
+			&room.UpdatedAt,
+		)
+		if err != nil {
+			return rooms, err
+		}
+
+		rooms = append(rooms, room)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rooms, err
+	}
+
+	return rooms, nil
+}
+
+// userColumns are the columns scanned by scanUser, in order
+const userColumns = `id, first_name, last_name, email, password, access_level, email_verified_at, verification_hash,
+	created_at, updated_at`
+
+// scanUser scans a row selected with userColumns into a user
+func scanUser(row interface{ Scan(dest ...any) error }) (models.User, error) {
+	var u models.User
+	var emailVerifiedAt sql.NullTime
+
+	err := row.Scan(
+		&u.ID,
+		&u.FirstName,
+		&u.LastName,
+		&u.Email,
+		&u.Password,
+		&u.AccessLevel,
+		&emailVerifiedAt,
+		&u.VerificationHash,
+		&u.CreatedAt,
+		&u.UpdatedAt,
+	)
+	u.EmailVerifiedAt = emailVerifiedAt.Time
+
+	return u, err
+}
+
+// GetUserByID returns a user by ID
+func (m *postgresDBRepo) GetUserByID(id int) (models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select ` + userColumns + ` from users where id = $1`
+
+	return scanUser(m.DB.QueryRowContext(ctx, query, id))
+}
+
+// GetUserByEmail returns a user by email, ignoring the case
+func (m *postgresDBRepo) GetUserByEmail(email string) (models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `select ` + userColumns + ` from users where lower(email) = lower($1)`
+
+	return scanUser(m.DB.QueryRowContext(ctx, query, email))
+}
+
+// InsertUser inserts a user with the bcrypt hash of its password and returns its ID
+func (m *postgresDBRepo) InsertUser(u models.User, password string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+
+	var emailVerifiedAt sql.NullTime
+	if !u.EmailVerifiedAt.IsZero() {
+		emailVerifiedAt = sql.NullTime{Time: u.EmailVerifiedAt, Valid: true}
+	}
+
+	var newID int
+
+	stmt := `insert into users (first_name, last_name, email, password, access_level, email_verified_at,
+			verification_hash, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+
+	err = m.DB.QueryRowContext(
+		ctx,
+		stmt,
+		u.FirstName,
+		u.LastName,
+		u.Email,
+		string(hashedPassword),
+		u.AccessLevel,
+		emailVerifiedAt,
+		u.VerificationHash,
+		m.App.Clock.Now(),
+		m.App.Clock.Now(),
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// VerifyUserEmail marks as verified the email of the user with the verification hash, which cannot be used again.
+// It returns sql.ErrNoRows when no user has the hash
+func (m *postgresDBRepo) VerifyUserEmail(verificationHash string) (models.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if verificationHash == "" {
+		return models.User{}, sql.ErrNoRows
+	}
+
+	query := `update users set email_verified_at = $1, verification_hash = '', updated_at = $1
+			where verification_hash = $2
+			returning ` + userColumns
+
+	return scanUser(m.DB.QueryRowContext(ctx, query, m.App.Clock.Now(), verificationHash))
+}
+
+// HasAdmin checks if a user is a member of the staff
+func (m *postgresDBRepo) HasAdmin() (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var exists bool
+
+	query := `select exists(select 1 from users where access_level = $1)`
+
+	err := m.DB.QueryRowContext(ctx, query, models.AccessAdmin).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// Authenticate authenticates a user and returns its ID and hashed password
+func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int
+	var hashedPassword string
+
+	row := m.DB.QueryRowContext(ctx, "select id, password from users where lower(email) = lower($1)", email)
+	err := row.Scan(&id, &hashedPassword)
+	if err != nil {
+		return id, "", err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(testPassword))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return 0, "", errors.New("incorrect password")
+	} else if err != nil {
+		return 0, "", err
+	}
+
+	return id, hashedPassword, nil
+}
+
+// promoCodeColumns are the columns scanned by scanPromoCode, in order
+const promoCodeColumns = `id, code, discount_type, amount, valid_from, valid_until, min_nights, max_uses,
+	times_used, room_id, created_at, updated_at`
+
+// scanPromoCode scans a row selected with promoCodeColumns into a promo code
+func scanPromoCode(row interface{ Scan(dest ...any) error }) (models.PromoCode, error) {
+	var p models.PromoCode
+	var roomID sql.NullInt64
+
+	err := row.Scan(
+		&p.ID,
+		&p.Code,
+		&p.DiscountType,
+		&p.Amount,
+		&p.ValidFrom,
+		&p.ValidUntil,
+		&p.MinNights,
+		&p.MaxUses,
+		&p.TimesUsed,
+		&roomID,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	p.RoomID = int(roomID.Int64)
+
+	return p, err
+}
+
+// promoCodeRoomID converts the room of a promo code to a nullable column, where 0 means every room
+func promoCodeRoomID(p models.PromoCode) sql.NullInt64 {
+	if p.RoomID == 0 {
+		return sql.NullInt64{}
+	}
+
+	return sql.NullInt64{Int64: int64(p.RoomID), Valid: true}
+}
+
+// AllPromoCodes returns all promo codes
+func (m *postgresDBRepo) AllPromoCodes() ([]models.PromoCode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var promos []models.PromoCode
+
+	rows, err := m.DB.QueryContext(ctx, "select "+promoCodeColumns+" from promo_codes order by valid_until desc, code")
+	if err != nil {
+		return promos, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanPromoCode(rows)
+		if err != nil {
+			return promos, err
+		}
+
+		promos = append(promos, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return promos, err
+	}
+
+	return promos, nil
+}
+
+// GetPromoCodeByID returns a promo code by ID
+func (m *postgresDBRepo) GetPromoCodeByID(id int) (models.PromoCode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, "select "+promoCodeColumns+" from promo_codes where id = $1", id)
+
+	return scanPromoCode(row)
+}
+
+// GetPromoCodeByCode returns a promo code by its code, ignoring the case
+func (m *postgresDBRepo) GetPromoCodeByCode(code string) (models.PromoCode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, "select "+promoCodeColumns+" from promo_codes where code = $1", strings.ToUpper(code))
+
+	return scanPromoCode(row)
+}
+
+// InsertPromoCode inserts a promo code into the database. Codes are stored in upper case
+func (m *postgresDBRepo) InsertPromoCode(p models.PromoCode) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newID int
+
+	stmt := `insert into promo_codes (code, discount_type, amount, valid_from, valid_until, min_nights,
+			max_uses, times_used, room_id, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, 0, $8, $9, $10) returning id`
+
+	err := m.DB.QueryRowContext(
+		ctx,
+		stmt,
+		strings.ToUpper(p.Code),
+		p.DiscountType,
+		p.Amount,
+		p.ValidFrom,
+		p.ValidUntil,
+		p.MinNights,
+		p.MaxUses,
+		promoCodeRoomID(p),
+		m.App.Clock.Now(),
+		m.App.Clock.Now(),
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// UpdatePromoCode updates a promo code. The number of times it was used is kept
+func (m *postgresDBRepo) UpdatePromoCode(p models.PromoCode) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update promo_codes set code = $1, discount_type = $2, amount = $3, valid_from = $4,
+			valid_until = $5, min_nights = $6, max_uses = $7, room_id = $8, updated_at = $9
+			where id = $10`
+
+	_, err := m.DB.ExecContext(
+		ctx,
+		stmt,
+		strings.ToUpper(p.Code),
+		p.DiscountType,
+		p.Amount,
+		p.ValidFrom,
+		p.ValidUntil,
+		p.MinNights,
+		p.MaxUses,
+		promoCodeRoomID(p),
+		m.App.Clock.Now(),
+		p.ID,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeletePromoCode deletes a promo code. Reservations that used it keep their discount
+func (m *postgresDBRepo) DeletePromoCode(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, "delete from promo_codes where id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// InsertPayment inserts a payment of a reservation into the database
+func (m *postgresDBRepo) InsertPayment(p models.Payment) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newID int
+
+	stmt := `insert into payments (reservation_id, provider_ref, amount, currency, status, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7) returning id`
+
+	err := m.DB.QueryRowContext(
+		ctx,
+		stmt,
+		p.ReservationID,
+		p.ProviderRef,
+		p.Amount,
+		p.Currency,
+		p.Status,
+		m.App.Clock.Now(),
+		m.App.Clock.Now(),
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// UpdatePaymentStatus updates the status of a payment
+func (m *postgresDBRepo) UpdatePaymentStatus(id int, status string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update payments set status = $1, updated_at = $2 where id = $3`
+
+	_, err := m.DB.ExecContext(ctx, stmt, status, m.App.Clock.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdatePaymentRefund records that <refunded> of a payment was given back to the guest, with the status of the payment
+// after the refund. The refunded amount never decreases, so a refund that is notified twice is only counted once
+func (m *postgresDBRepo) UpdatePaymentRefund(id int, refunded int, status string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update payments set refunded_amount = greatest(refunded_amount, $1), status = $2, updated_at = $3
+			where id = $4`
+
+	_, err := m.DB.ExecContext(ctx, stmt, refunded, status, m.App.Clock.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ConfirmReservationPayment confirms the reservation <reservationID> and marks its payment <paymentID> as captured,
+// in the same transaction, and tells if it did. Nothing changes when the reservation is no longer pending, or when its
+// hold expired before <before>: its room may have been freed and booked again
+func (m *postgresDBRepo) ConfirmReservationPayment(paymentID, reservationID int, before time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	stmt := `update reservations set status = $1, updated_at = $2
+			where id = $3 and status = $4 and (expires_at is null or expires_at >= $5)`
+
+	result, err := tx.ExecContext(ctx, stmt, models.ReservationConfirmed, m.App.Clock.Now(), reservationID, models.ReservationPending, before)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+
+	stmt = `update payments set status = $1, updated_at = $2 where id = $3`
+
+	_, err = tx.ExecContext(ctx, stmt, models.PaymentCaptured, m.App.Clock.Now(), paymentID)
+	if err != nil {
+		return false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// GetPaymentByProviderRef returns a payment by its reference at the payment provider
+func (m *postgresDBRepo) GetPaymentByProviderRef(ref string) (models.Payment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var p models.Payment
+
+	query := `
+		select id, reservation_id, provider_ref, amount, refunded_amount, currency, status, created_at, updated_at
+		from payments where provider_ref = $1
+	`
+
+	row := m.DB.QueryRowContext(ctx, query, ref)
+	err := row.Scan(
+		&p.ID,
+		&p.ReservationID,
+		&p.ProviderRef,
+		&p.Amount,
+		&p.RefundedAmount,
+		&p.Currency,
+		&p.Status,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+
+	if err != nil {
+		return p, err
+	}
+
+	return p, nil
+}
+
+// GetPaymentsByReservationID returns the payments of a reservation, the oldest first
+func (m *postgresDBRepo) GetPaymentsByReservationID(reservationID int) ([]models.Payment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var payments []models.Payment
+
+	query := `
+		select id, reservation_id, provider_ref, amount, refunded_amount, currency, status, created_at, updated_at
+		from payments where reservation_id = $1 order by id
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, reservationID)
+	if err != nil {
+		return payments, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.Payment
+
+		err := rows.Scan(
+			&p.ID,
+			&p.ReservationID,
+			&p.ProviderRef,
+			&p.Amount,
+			&p.RefundedAmount,
+			&p.Currency,
+			&p.Status,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		)
+		if err != nil {
+			return payments, err
+		}
+
+		payments = append(payments, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return payments, err
+	}
+
+	return payments, nil
+}
+
+// GetInvoiceByReservationID returns the invoice of a reservation
+func (m *postgresDBRepo) GetInvoiceByReservationID(reservationID int) (models.Invoice, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var inv models.Invoice
+
+	query := `select id, number, reservation_id, created_at, updated_at from invoices where reservation_id = $1`
+
+	err := m.DB.QueryRowContext(ctx, query, reservationID).Scan(
+		&inv.ID,
+		&inv.Number,
+		&inv.ReservationID,
+		&inv.CreatedAt,
+		&inv.UpdatedAt,
+	)
+
+	return inv, err
+}
+
+// InsertInvoice issues the invoice of a reservation with the next number of the invoice number sequence. When the
+// reservation already has an invoice, e.g. issued by a concurrent download, that invoice is returned instead
+func (m *postgresDBRepo) InsertInvoice(reservationID int) (models.Invoice, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	inv := models.Invoice{
+		ReservationID: reservationID,
+		CreatedAt:     m.App.Clock.Now(),
+		UpdatedAt:     m.App.Clock.Now(),
+	}
+
+	stmt := `insert into invoices (reservation_id, created_at, updated_at) values ($1, $2, $3)
+			on conflict (reservation_id) do nothing
+			returning id, number`
+
+	err := m.DB.QueryRowContext(ctx, stmt, reservationID, inv.CreatedAt, inv.UpdatedAt).Scan(&inv.ID, &inv.Number)
+	if err == sql.ErrNoRows {
+		return m.GetInvoiceByReservationID(reservationID)
+	}
+
+	return inv, err
+}
+
+// AllICalImports returns all calendar imports
+func (m *postgresDBRepo) AllICalImports() ([]models.ICalImport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var imports []models.ICalImport
+
+	rows, err := m.DB.QueryContext(ctx, "select "+icalImportColumns+" from ical_imports order by room_id, id")
+	if err != nil {
+		return imports, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		imp, err := scanICalImport(rows)
+		if err != nil {
+			return imports, err
+		}
+
+		imports = append(imports, imp)
+	}
+
+	if err = rows.Err(); err != nil {
+		return imports, err
+	}
+
+	return imports, nil
+}
+
+// icalImportColumns are the columns scanned by scanICalImport, in order
+const icalImportColumns = `id, room_id, url, last_synced_at, last_error, warnings, created_at, updated_at`
+
+// scanICalImport scans a row selected with icalImportColumns into a calendar import
+func scanICalImport(row interface{ Scan(dest ...any) error }) (models.ICalImport, error) {
+	var imp models.ICalImport
+	var lastSyncedAt sql.NullTime
+
+	err := row.Scan(
+		&imp.ID,
+		&imp.RoomID,
+		&imp.URL,
+		&lastSyncedAt,
+		&imp.LastError,
+		&imp.Warnings,
+		&imp.CreatedAt,
+		&imp.UpdatedAt,
+	)
+	imp.LastSyncedAt = lastSyncedAt.Time
+
+	return imp, err
+}
+
+// GetICalImportByID returns a calendar import by ID
+func (m *postgresDBRepo) GetICalImportByID(id int) (models.ICalImport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, "select "+icalImportColumns+" from ical_imports where id = $1", id)
+
+	return scanICalImport(row)
+}
+
+// InsertICalImport inserts a calendar import into the database
+func (m *postgresDBRepo) InsertICalImport(imp models.ICalImport) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newID int
+
+	stmt := `insert into ical_imports (room_id, url, created_at, updated_at) values ($1, $2, $3, $4) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt, imp.RoomID, imp.URL, m.App.Clock.Now(), m.App.Clock.Now()).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// DeleteICalImport deletes a calendar import, together with the restrictions it imported
+func (m *postgresDBRepo) DeleteICalImport(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `delete from ical_imports where id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateICalImportStatus records the time, the error and the warnings, if any, of the last synchronisation of a
+// calendar import
+func (m *postgresDBRepo) UpdateICalImportStatus(id int, lastError, warnings string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stmt := `update ical_imports set last_synced_at = $1, last_error = $2, warnings = $3, updated_at = $1 where id = $4`
+
+	_, err := m.DB.ExecContext(ctx, stmt, m.App.Clock.Now(), lastError, warnings, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// apiKeyColumns are the columns scanned by scanAPIKey, in order
+const apiKeyColumns = `id, name, prefix, hash, scopes, rate_limit, expires_at, last_used_at, created_at, updated_at`
+
+// scanAPIKey scans a row selected with apiKeyColumns into an API key
+func scanAPIKey(row interface{ Scan(dest ...any) error }) (models.APIKey, error) {
+	var k models.APIKey
+	var expiresAt, lastUsedAt sql.NullTime
+
+	err := row.Scan(
+		&k.ID,
+		&k.Name,
+		&k.Prefix,
+		&k.Hash,
+		&k.Scopes,
+		&k.RateLimit,
+		&expiresAt,
+		&lastUsedAt,
+		&k.CreatedAt,
+		&k.UpdatedAt,
+	)
+	k.ExpiresAt = expiresAt.Time
+	k.LastUsedAt = lastUsedAt.Time
+
+	return k, err
+}
+
+// AllAPIKeys returns all API keys
+func (m *postgresDBRepo) AllAPIKeys() ([]models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var keys []models.APIKey
+
+	rows, err := m.DB.QueryContext(ctx, "select "+apiKeyColumns+" from api_keys order by name, id")
+	if err != nil {
+		return keys, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return keys, err
+		}
+
+		keys = append(keys, k)
+	}
+
+	if err = rows.Err(); err != nil {
+		return keys, err
+	}
+
+	return keys, nil
+}
+
+// GetAPIKeyByID returns an API key by ID
+func (m *postgresDBRepo) GetAPIKeyByID(id int) (models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, "select "+apiKeyColumns+" from api_keys where id = $1", id)
+
+	return scanAPIKey(row)
+}
+
+// GetAPIKeyByPrefix returns the API key identified by prefix
+func (m *postgresDBRepo) GetAPIKeyByPrefix(prefix string) (models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, "select "+apiKeyColumns+" from api_keys where prefix = $1", prefix)
+
+	return scanAPIKey(row)
+}
+
+// InsertAPIKey inserts an API key into the database
+func (m *postgresDBRepo) InsertAPIKey(k models.APIKey) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var expiresAt sql.NullTime
+	if !k.ExpiresAt.IsZero() {
+		expiresAt = sql.NullTime{Time: k.ExpiresAt, Valid: true}
+	}
+
+	var newID int
+
+	stmt := `insert into api_keys (name, prefix, hash, scopes, rate_limit, expires_at, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		k.Name,
+		k.Prefix,
+		k.Hash,
+		k.Scopes,
+		k.RateLimit,
+		expiresAt,
+		m.App.Clock.Now(),
+		m.App.Clock.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// DeleteAPIKey deletes an API key, together with its usage log
+func (m *postgresDBRepo) DeleteAPIKey(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `delete from api_keys where id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// InsertAPIKeyUsage logs a request made with an API key and records when the key was last used
+func (m *postgresDBRepo) InsertAPIKeyUsage(u models.APIKeyUsage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := m.App.Clock.Now()
+
+	stmt := `insert into api_key_usages (api_key_id, method, path, status, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6)`
+
+	_, err = tx.ExecContext(ctx, stmt, u.APIKeyID, u.Method, u.Path, u.Status, now, now)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `update api_keys set last_used_at = $1 where id = $2`, now, u.APIKeyID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetAPIKeyUsages returns the latest requests made with the API key keyID, at most limit of them, the newest first
+func (m *postgresDBRepo) GetAPIKeyUsages(keyID, limit int) ([]models.APIKeyUsage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var usages []models.APIKeyUsage
+
+	query := `
+		select id, api_key_id, method, path, status, created_at, updated_at
+		from api_key_usages
+		where api_key_id = $1
+		order by created_at desc, id desc
+		limit $2
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, keyID, limit)
+	if err != nil {
+		return usages, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u models.APIKeyUsage
+		err := rows.Scan(
+			&u.ID,
+			&u.APIKeyID,
+			&u.Method,
+			&u.Path,
+			&u.Status,
+			&u.CreatedAt,
+			&u.UpdatedAt,
+		)
+		if err != nil {
+			return usages, err
+		}
+
+		usages = append(usages, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return usages, err
+	}
+
+	return usages, nil
+}
+
+// webhookEndpointColumns are the columns scanned by scanWebhookEndpoint, in order
+const webhookEndpointColumns = `id, url, secret, events, created_at, updated_at`
+
+// scanWebhookEndpoint scans a row selected with webhookEndpointColumns into a webhook endpoint
+func scanWebhookEndpoint(row interface{ Scan(dest ...any) error }) (models.WebhookEndpoint, error) {
+	var e models.WebhookEndpoint
+
+	err := row.Scan(
+		&e.ID,
+		&e.URL,
+		&e.Secret,
+		&e.Events,
+		&e.CreatedAt,
+		&e.UpdatedAt,
+	)
+
+	return e, err
+}
+
+// AllWebhookEndpoints returns all webhook endpoints
+func (m *postgresDBRepo) AllWebhookEndpoints() ([]models.WebhookEndpoint, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var endpoints []models.WebhookEndpoint
+
+	rows, err := m.DB.QueryContext(ctx, "select "+webhookEndpointColumns+" from webhook_endpoints order by id")
+	if err != nil {
+		return endpoints, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanWebhookEndpoint(rows)
+		if err != nil {
+			return endpoints, err
+		}
+
+		endpoints = append(endpoints, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return endpoints, err
+	}
+
+	return endpoints, nil
+}
+
+// GetWebhookEndpointByID returns a webhook endpoint by ID
+func (m *postgresDBRepo) GetWebhookEndpointByID(id int) (models.WebhookEndpoint, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, "select "+webhookEndpointColumns+" from webhook_endpoints where id = $1", id)
+
+	return scanWebhookEndpoint(row)
+}
+
+// InsertWebhookEndpoint inserts a webhook endpoint into the database
+func (m *postgresDBRepo) InsertWebhookEndpoint(e models.WebhookEndpoint) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newID int
+
+	stmt := `insert into webhook_endpoints (url, secret, events, created_at, updated_at) values ($1, $2, $3, $4, $5) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt, e.URL, e.Secret, e.Events, m.App.Clock.Now(), m.App.Clock.Now()).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// DeleteWebhookEndpoint deletes a webhook endpoint, together with its deliveries
+func (m *postgresDBRepo) DeleteWebhookEndpoint(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `delete from webhook_endpoints where id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// InsertWebhookDelivery inserts a delivery of an event to a webhook endpoint into the database
+func (m *postgresDBRepo) InsertWebhookDelivery(d models.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newID int
+
+	stmt := `insert into webhook_deliveries (endpoint_id, event, payload, status, next_attempt_at, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		d.EndpointID,
+		d.Event,
+		d.Payload,
+		d.Status,
+		d.NextAttemptAt,
+		m.App.Clock.Now(),
+		m.App.Clock.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// webhookDeliveryColumns are the columns scanned by scanWebhookDelivery, in order. They join webhook_endpoints as e
+const webhookDeliveryColumns = `d.id, d.endpoint_id, d.event, d.payload, d.status, d.attempts, d.next_attempt_at,
+	d.last_status_code, d.last_error, d.delivered_at, d.created_at, d.updated_at, e.id, e.url, e.secret, e.events`
+
+// scanWebhookDelivery scans a row selected with webhookDeliveryColumns into a webhook delivery
+func scanWebhookDelivery(row interface{ Scan(dest ...any) error }) (models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var deliveredAt sql.NullTime
+
+	err := row.Scan(
+		&d.ID,
+		&d.EndpointID,
+		&d.Event,
+		&d.Payload,
+		&d.Status,
+		&d.Attempts,
+		&d.NextAttemptAt,
+		&d.LastStatusCode,
+		&d.LastError,
+		&deliveredAt,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+		&d.Endpoint.ID,
+		&d.Endpoint.URL,
+		&d.Endpoint.Secret,
+		&d.Endpoint.Events,
+	)
+	d.DeliveredAt = deliveredAt.Time
+
+	return d, err
+}
+
+// queryWebhookDeliveries returns the webhook deliveries selected by <query> with <args>
+func (m *postgresDBRepo) queryWebhookDeliveries(query string, args ...any) ([]models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var deliveries []models.WebhookDelivery
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return deliveries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return deliveries, err
+		}
+
+		deliveries = append(deliveries, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return deliveries, err
+	}
+
+	return deliveries, nil
+}
+
+// GetWebhookDeliveryByID returns a webhook delivery by ID, with its endpoint
+func (m *postgresDBRepo) GetWebhookDeliveryByID(id int) (models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		select ` + webhookDeliveryColumns + `
+		from webhook_deliveries d
+		left join webhook_endpoints e on (d.endpoint_id = e.id)
+		where d.id = $1
+	`
+
+	return scanWebhookDelivery(m.DB.QueryRowContext(ctx, query, id))
+}
+
+// GetDueWebhookDeliveries returns the pending webhook deliveries whose next attempt is due at now, the oldest first,
+// at most limit of them, with their endpoint
+func (m *postgresDBRepo) GetDueWebhookDeliveries(now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	query := `
+		select ` + webhookDeliveryColumns + `
+		from webhook_deliveries d
+		left join webhook_endpoints e on (d.endpoint_id = e.id)
+		where d.status = $1 and d.next_attempt_at <= $2
+		order by d.next_attempt_at, d.id
+		limit $3
+	`
+
+	return m.queryWebhookDeliveries(query, models.DeliveryPending, now, limit)
+}
+
+// GetWebhookDeliveriesByEndpointID returns the latest deliveries to the webhook endpoint endpointID,
+// at most limit of them, the newest first
+func (m *postgresDBRepo) GetWebhookDeliveriesByEndpointID(endpointID, limit int) ([]models.WebhookDelivery, error) {
+	query := `
+		select ` + webhookDeliveryColumns + `
+		from webhook_deliveries d
+		left join webhook_endpoints e on (d.endpoint_id = e.id)
+		where d.endpoint_id = $1
+		order by d.created_at desc, d.id desc
+		limit $2
+	`
+
+	return m.queryWebhookDeliveries(query, endpointID, limit)
+}
+
+// UpdateWebhookDelivery records the outcome of an attempt of a webhook delivery
+func (m *postgresDBRepo) UpdateWebhookDelivery(d models.WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var deliveredAt sql.NullTime
+	if !d.DeliveredAt.IsZero() {
+		deliveredAt = sql.NullTime{Time: d.DeliveredAt, Valid: true}
+	}
+
+	stmt := `
+		update webhook_deliveries
+		set status = $1, attempts = $2, next_attempt_at = $3, last_status_code = $4, last_error = $5,
+			delivered_at = $6, updated_at = $7
+		where id = $8
+	`
+
+	_, err := m.DB.ExecContext(ctx, stmt,
+		d.Status,
+		d.Attempts,
+		d.NextAttemptAt,
+		d.LastStatusCode,
+		d.LastError,
+		deliveredAt,
+		m.App.Clock.Now(),
+		d.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
 }
@@ -0,0 +1,719 @@
+package dbrepo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wagnojunior/booking/internal/apikeys"
+	"github.com/wagnojunior/booking/internal/models"
+	"github.com/wagnojunior/booking/internal/repository"
+)
+
+func (m *testDBRepo) AllUsers() bool {
+	return true
+}
+
+// InsertReservation inserts a reservations into the database
+func (m *testDBRepo) InsertReservation(res models.Reservation) (int, error) {
+	// if the room id is 2, then fail; otherwise, pass
+	if res.RoomID == 2 {
+		return 0, errors.New("some error")
+	}
+
+	// Only promo code 1 can still be used
+	if res.PromoCodeID > 1 {
+		return 0, repository.ErrPromoCodeUsedUp
+	}
+
+	return 1, nil
+}
+
+// UpdateReservationStatus updates the status of a reservation
+func (m *testDBRepo) UpdateReservationStatus(id int, status string) error {
+	return nil
+}
+
+// testReservation returns the reservations of the test database: reservation 1 is confirmed and arrives in 30 days,
+// reservation 2 is cancelled. Both are linked to the account of guest 2. Reservation 3 waits for its payment until
+// TestHoldExpiry
+func (m *testDBRepo) testReservation(id int) (models.Reservation, bool) {
+	if id < 1 || id > 3 {
+		return models.Reservation{}, false
+	}
+
+	start := m.App.Clock.Now().AddDate(0, 0, 30)
+
+	res := models.Reservation{
+		ID:        id,
+		Code:      fmt.Sprintf("TESTCOD%d", id),
+		FirstName: "John",
+		LastName:  "Smith",
+		Email:     "john@smith.com",
+		StartDate: start,
+		EndDate:   start.AddDate(0, 0, 1),
+		RoomID:    1,
+		UserID:    2,
+		Guests:    1,
+		Status:    models.ReservationConfirmed,
+		Room:      models.Room{ID: 1, RoomName: "Panda Suite"},
+		Price:     models.PriceQuote{Currency: "USD", Subtotal: 12000, Total: 15200},
+		CancellationPolicy: models.CancellationPolicy{
+			Name:           "Moderate",
+			FreeUntilDays:  7,
+			PenaltyPercent: 50,
+		},
+	}
+
+	if id == 2 {
+		res.Status = models.ReservationCancelled
+		res.RefundAmount = 15200
+		res.CancelledAt = m.App.Clock.Now()
+	}
+
+	if id == 3 {
+		res.Status = models.ReservationPending
+		res.UserID = 0
+		res.ExpiresAt = TestHoldExpiry
+	}
+
+	return res, true
+}
+
+// AllReservations returns all reservations
+func (m *testDBRepo) AllReservations() ([]models.Reservation, error) {
+	first, _ := m.testReservation(1)
+	second, _ := m.testReservation(2)
+
+	return []models.Reservation{first, second}, nil
+}
+
+// GetReservationByID returns a reservation by ID
+func (m *testDBRepo) GetReservationByID(id int) (models.Reservation, error) {
+	res, ok := m.testReservation(id)
+	if !ok {
+		return res, sql.ErrNoRows
+	}
+
+	return res, nil
+}
+
+// GetReservationByCode returns a reservation by its confirmation code, ignoring the case
+func (m *testDBRepo) GetReservationByCode(code string) (models.Reservation, error) {
+	for id := 1; id <= 2; id++ {
+		res, _ := m.testReservation(id)
+		if strings.EqualFold(res.Code, code) {
+			return res, nil
+		}
+	}
+
+	return models.Reservation{}, sql.ErrNoRows
+}
+
+// CancelReservation marks a reservation as cancelled and frees its room, unless it is already cancelled
+func (m *testDBRepo) CancelReservation(id int, refundAmount int) (bool, error) {
+	res, ok := m.testReservation(id)
+
+	return ok && res.Status != models.ReservationCancelled, nil
+}
+
+// GetReservationsByUserID returns the reservations linked to the account of a guest
+func (m *testDBRepo) GetReservationsByUserID(userID int) ([]models.Reservation, error) {
+	if userID != 2 {
+		return nil, nil
+	}
+
+	return m.AllReservations()
+}
+
+// LinkReservationsByEmail links to a user the reservations made with its email. The guest jane@doe.ca made one
+// before creating the account
+func (m *testDBRepo) LinkReservationsByEmail(userID int, email string) (int, error) {
+	if strings.EqualFold(email, "jane@doe.ca") {
+		return 1, nil
+	}
+
+	return 0, nil
+}
+
+// TestHoldExpiry is when the room stops being held for the pending reservation 3 of the test database
+var TestHoldExpiry = time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// ExpirePendingReservations cancels the pending reservations whose hold expired before <before>. Only reservation 3
+// is pending
+func (m *testDBRepo) ExpirePendingReservations(before time.Time) ([]models.Reservation, error) {
+	if !TestHoldExpiry.Before(before) {
+		return nil, nil
+	}
+
+	res, _ := m.testReservation(3)
+	res.Status = models.ReservationCancelled
+	res.CancelledAt = m.App.Clock.Now()
+
+	return []models.Reservation{res}, nil
+}
+
+// InsertRoomRestriction inserts a room restriction into the database
+func (m *testDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
+	if r.RoomID == 1000 {
+		return errors.New("some error")
+	}
+
+	return nil
+}
+
+// GetRoomRestrictionsByRoomID returns all restrictions of roomID: a reservation and an owner block
+func (m *testDBRepo) GetRoomRestrictionsByRoomID(roomID int) ([]models.RoomRestriction, error) {
+	start := time.Date(2022, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	restrictions := []models.RoomRestriction{
+		{
+			ID:            1,
+			StartDate:     start,
+			EndDate:       start.AddDate(0, 0, 2),
+			RoomID:        roomID,
+			ReservationID: 1,
+			RestrictionID: 1,
+			Reservation:   models.Reservation{ID: 1, Code: "TESTCOD1", FirstName: "John", LastName: "Smith"},
+			Restriction:   models.Restriction{ID: 1, RestrictionName: "Reservation"},
+		},
+		{
+			ID:            2,
+			StartDate:     start.AddDate(0, 0, 5),
+			EndDate:       start.AddDate(0, 0, 7),
+			RoomID:        roomID,
+			RestrictionID: 2,
+			Restriction:   models.Restriction{ID: 2, RestrictionName: "Owner Block"},
+		},
+	}
+
+	return restrictions, nil
+}
+
+// GetRoomRestrictionsByICalImportID returns the restrictions imported by a calendar import
+func (m *testDBRepo) GetRoomRestrictionsByICalImportID(importID int) ([]models.RoomRestriction, error) {
+	return nil, nil
+}
+
+// SyncRoomRestrictions inserts, updates the dates of and deletes room restrictions
+func (m *testDBRepo) SyncRoomRestrictions(insert, update []models.RoomRestriction, remove []int) error {
+	return nil
+}
+
+// SearchAvailabilityByDatesByRoomID returns true if availability exists for roomID and false otherwise.
+// Only room 1 is available
+func (m *testDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
+	return roomID == 1, nil
+}
+
+// SearchAvailabilityForAllRooms returns a slice of available rooms if any for given data range
+func (m *testDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
+	rooms := []models.Room{
+		{ID: 1, RoomName: "Panda Suite", BasePrice: 12000},
+	}
+
+	return rooms, nil
+}
+
+// GetRoomByID gets a room by ID
+func (m *testDBRepo) GetRoomByID(id int) (models.Room, error) {
+	var room models.Room
+
+	if id > 2 {
+		return room, errors.New("some error")
+	}
+
+	room.ID = id
+	room.RoomName = "Panda Suite"
+	room.BasePrice = 12000
+	room.ICalToken = fmt.Sprintf("token%d", id)
+
+	return room, nil
+}
+
+// GetRatesByRoomID returns the rates of roomID that overlap with the given date range
+func (m *testDBRepo) GetRatesByRoomID(roomID int, start, end time.Time) ([]models.RoomRate, error) {
+	var rates []models.RoomRate
+
+	if roomID == 1 {
+		rates = append(rates, models.RoomRate{
+			ID:        1,
+			RoomID:    1,
+			RateName:  "Weekend",
+			StartDate: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2099, 12, 31, 0, 0, 0, 0, time.UTC),
+			Weekdays:  "5,6",
+			Price:     15000,
+			Priority:  1,
+		})
+	}
+
+	return rates, nil
+}
+
+// GetStayRulesByRoomID returns the stay rules that apply to stays in roomID arriving on the given date
+func (m *testDBRepo) GetStayRulesByRoomID(roomID int, arrival time.Time) ([]models.StayRule, error) {
+	rules := []models.StayRule{
+		{ID: 1, MaxNights: 14},
+	}
+
+	if roomID == 1 {
+		rules = append(rules, models.StayRule{ID: 2, RoomID: 1, ClosedToArrival: "0"})
+	}
+
+	return rules, nil
+}
+
+// GetFeeRulesByRoomID returns the tax and fee rules that apply to roomID
+func (m *testDBRepo) GetFeeRulesByRoomID(roomID int) ([]models.FeeRule, error) {
+	rules := []models.FeeRule{
+		{ID: 1, Name: "Cleaning fee", Category: models.CategoryFee, Kind: models.FeePerStay, Amount: 3000},
+		{ID: 2, Name: "Tourist tax", Category: models.CategoryTax, Kind: models.FeePerGuestPerNight, Amount: 200},
+	}
+
+	return rules, nil
+}
+
+// GetCancellationPoliciesByRoomID returns the cancellation policies that apply to roomID
+func (m *testDBRepo) GetCancellationPoliciesByRoomID(roomID int) ([]models.CancellationPolicy, error) {
+	policies := []models.CancellationPolicy{
+		{ID: 1, Name: "Moderate", FreeUntilDays: 7, PenaltyPercent: 50},
+	}
+
+	if roomID == 1 {
+		policies = append(policies, models.CancellationPolicy{ID: 2, Name: "Non-refundable weekend", RoomID: 1, RateName: "Weekend", NonRefundable: true})
+	}
+
+	return policies, nil
+}
+
+// AllRooms returns all rooms
+func (m *testDBRepo) AllRooms() ([]models.Room, error) {
+	rooms := []models.Room{
+		{ID: 1, RoomName: "Panda Suite", BasePrice: 12000, ICalToken: "token1"},
+		{ID: 2, RoomName: "Bamboo Dorm", BasePrice: 4500, ICalToken: "token2"},
+	}
+
+	return rooms, nil
+}
+
+// TestVerificationToken is the token of the link that verifies the email of the test user 3
+const TestVerificationToken = "verify-jane"
+
+// testUser returns the users of the test database, all with the password "password": user 1 is an admin, user 2 a
+// verified guest and user 3 a guest who has not verified the email yet
+func (m *testDBRepo) testUser(id int) (models.User, bool) {
+	created := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	switch id {
+	case 1:
+		return models.User{ID: 1, FirstName: "Admin", LastName: "User", Email: "me@here.ca",
+			AccessLevel: models.AccessAdmin, EmailVerifiedAt: created, CreatedAt: created}, true
+	case 2:
+		return models.User{ID: 2, FirstName: "John", LastName: "Smith", Email: "john@smith.com",
+			AccessLevel: models.AccessGuest, EmailVerifiedAt: created, CreatedAt: created}, true
+	case 3:
+		return models.User{ID: 3, FirstName: "Jane", LastName: "Doe", Email: "jane@doe.ca",
+			AccessLevel: models.AccessGuest, VerificationHash: apikeys.Hash(TestVerificationToken),
+			CreatedAt: created}, true
+	}
+
+	return models.User{}, false
+}
+
+// GetUserByID returns a user by ID
+func (m *testDBRepo) GetUserByID(id int) (models.User, error) {
+	u, ok := m.testUser(id)
+	if !ok {
+		return u, sql.ErrNoRows
+	}
+
+	return u, nil
+}
+
+// GetUserByEmail returns a user by email, ignoring the case
+func (m *testDBRepo) GetUserByEmail(email string) (models.User, error) {
+	for id := 1; id <= 3; id++ {
+		u, _ := m.testUser(id)
+		if strings.EqualFold(u.Email, email) {
+			return u, nil
+		}
+	}
+
+	return models.User{}, sql.ErrNoRows
+}
+
+// InsertUser inserts a user and returns its ID
+func (m *testDBRepo) InsertUser(u models.User, password string) (int, error) {
+	if u.Email == "fail@here.ca" {
+		return 0, errors.New("some error")
+	}
+
+	return 4, nil
+}
+
+// VerifyUserEmail marks as verified the email of the user with the verification hash
+func (m *testDBRepo) VerifyUserEmail(verificationHash string) (models.User, error) {
+	u, _ := m.testUser(3)
+	if verificationHash == "" || verificationHash != u.VerificationHash {
+		return models.User{}, sql.ErrNoRows
+	}
+
+	u.EmailVerifiedAt = m.App.Clock.Now()
+	u.VerificationHash = ""
+
+	return u, nil
+}
+
+// HasAdmin checks if a user is a member of the staff. User 1 is
+func (m *testDBRepo) HasAdmin() (bool, error) {
+	return true, nil
+}
+
+// Authenticate authenticates a user and returns its ID and hashed password
+func (m *testDBRepo) Authenticate(email, testPassword string) (int, string, error) {
+	u, err := m.GetUserByEmail(email)
+	if err == nil && testPassword == "password" {
+		return u.ID, "", nil
+	}
+
+	return 0, "", errors.New("some error")
+}
+
+// testPromoCode is the only promo code of the test database: 10% off, for stays of at least 2 nights
+func testPromoCode() models.PromoCode {
+	return models.PromoCode{
+		ID:           1,
+		Code:         "SPRING10",
+		DiscountType: models.DiscountPercent,
+		Amount:       10,
+		ValidFrom:    time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		ValidUntil:   time.Date(2099, 12, 31, 0, 0, 0, 0, time.UTC),
+		MinNights:    2,
+	}
+}
+
+// AllPromoCodes returns all promo codes
+func (m *testDBRepo) AllPromoCodes() ([]models.PromoCode, error) {
+	return []models.PromoCode{testPromoCode()}, nil
+}
+
+// GetPromoCodeByID returns a promo code by ID
+func (m *testDBRepo) GetPromoCodeByID(id int) (models.PromoCode, error) {
+	if id != 1 {
+		return models.PromoCode{}, sql.ErrNoRows
+	}
+
+	return testPromoCode(), nil
+}
+
+// GetPromoCodeByCode returns a promo code by its code, ignoring the case
+func (m *testDBRepo) GetPromoCodeByCode(code string) (models.PromoCode, error) {
+	if strings.ToUpper(code) != "SPRING10" {
+		return models.PromoCode{}, sql.ErrNoRows
+	}
+
+	return testPromoCode(), nil
+}
+
+// InsertPromoCode inserts a promo code into the database
+func (m *testDBRepo) InsertPromoCode(p models.PromoCode) (int, error) {
+	return 2, nil
+}
+
+// UpdatePromoCode updates a promo code
+func (m *testDBRepo) UpdatePromoCode(p models.PromoCode) error {
+	return nil
+}
+
+// DeletePromoCode deletes a promo code
+func (m *testDBRepo) DeletePromoCode(id int) error {
+	return nil
+}
+
+// InsertPayment inserts a payment of a reservation into the database
+func (m *testDBRepo) InsertPayment(p models.Payment) (int, error) {
+	return 1, nil
+}
+
+// UpdatePaymentStatus updates the status of a payment
+func (m *testDBRepo) UpdatePaymentStatus(id int, status string) error {
+	return nil
+}
+
+// UpdatePaymentRefund records how much of a payment was refunded
+func (m *testDBRepo) UpdatePaymentRefund(id int, refunded int, status string) error {
+	return nil
+}
+
+// ConfirmReservationPayment confirms a reservation that is still pending and held, and marks its payment as captured
+func (m *testDBRepo) ConfirmReservationPayment(paymentID, reservationID int, before time.Time) (bool, error) {
+	res, ok := m.testReservation(reservationID)
+
+	return ok && res.Status == models.ReservationPending && !res.ExpiresAt.Before(before), nil
+}
+
+// GetPaymentByProviderRef returns a payment by its reference at the payment provider. Payment fake_1 is the one of
+// reservation 1 and fake_3 the one of reservation 3
+func (m *testDBRepo) GetPaymentByProviderRef(ref string) (models.Payment, error) {
+	var id int
+	if _, err := fmt.Sscanf(ref, "fake_%d", &id); err != nil || (id != 1 && id != 3) {
+		return models.Payment{}, sql.ErrNoRows
+	}
+
+	payment := models.Payment{
+		ID:            id,
+		ReservationID: id,
+		ProviderRef:   ref,
+		Amount:        15200,
+		Currency:      "USD",
+		Status:        models.PaymentAuthorised,
+	}
+
+	return payment, nil
+}
+
+// GetPaymentsByReservationID returns the payments of a reservation
+func (m *testDBRepo) GetPaymentsByReservationID(reservationID int) ([]models.Payment, error) {
+	if reservationID != 1 {
+		return nil, nil
+	}
+
+	payment := models.Payment{
+		ID:            1,
+		ReservationID: 1,
+		ProviderRef:   "fake_1",
+		Amount:        15200,
+		Currency:      "USD",
+		Status:        models.PaymentCaptured,
+	}
+
+	return []models.Payment{payment}, nil
+}
+
+// GetInvoiceByReservationID returns the invoice of a reservation. Only reservation 1 has one
+func (m *testDBRepo) GetInvoiceByReservationID(reservationID int) (models.Invoice, error) {
+	if reservationID != 1 {
+		return models.Invoice{}, sql.ErrNoRows
+	}
+
+	return models.Invoice{ID: 1, Number: 1, ReservationID: 1, CreatedAt: m.App.Clock.Now()}, nil
+}
+
+// InsertInvoice issues the invoice of a reservation, or returns the one it already has
+func (m *testDBRepo) InsertInvoice(reservationID int) (models.Invoice, error) {
+	if reservationID == 1 {
+		return m.GetInvoiceByReservationID(reservationID)
+	}
+
+	return models.Invoice{ID: 2, Number: 2, ReservationID: reservationID, CreatedAt: m.App.Clock.Now()}, nil
+}
+
+// testICalImport is the only calendar import of the test database
+func testICalImport() models.ICalImport {
+	return models.ICalImport{ID: 1, RoomID: 1, URL: "file:///calendar.ics"}
+}
+
+// AllICalImports returns all calendar imports
+func (m *testDBRepo) AllICalImports() ([]models.ICalImport, error) {
+	return []models.ICalImport{testICalImport()}, nil
+}
+
+// GetICalImportByID returns a calendar import by ID
+func (m *testDBRepo) GetICalImportByID(id int) (models.ICalImport, error) {
+	if id != 1 {
+		return models.ICalImport{}, sql.ErrNoRows
+	}
+
+	return testICalImport(), nil
+}
+
+// InsertICalImport inserts a calendar import into the database
+func (m *testDBRepo) InsertICalImport(imp models.ICalImport) (int, error) {
+	return 2, nil
+}
+
+// DeleteICalImport deletes a calendar import
+func (m *testDBRepo) DeleteICalImport(id int) error {
+	return nil
+}
+
+// UpdateICalImportStatus records the last synchronisation of a calendar import
+func (m *testDBRepo) UpdateICalImportStatus(id int, lastError, warnings string) error {
+	return nil
+}
+
+// testAPIKeys are the API keys of the test database, by prefix. The secret of every key is "secret", e.g. bk_full0001_secret.
+// full0001 has every scope, read0001 can only read the availability, slow0001 allows one request per minute
+// and expd0001 has expired
+func (m *testDBRepo) testAPIKeys() map[string]models.APIKey {
+	keys := map[string]models.APIKey{
+		"full0001": {ID: 1, Name: "Full access", Scopes: models.Scopes(strings.Join(models.AllScopes, ","))},
+		"read0001": {ID: 2, Name: "Read only", Scopes: models.ScopeReadAvailability},
+		"slow0001": {ID: 3, Name: "Slow", Scopes: models.ScopeReadAvailability, RateLimit: 1},
+		"expd0001": {ID: 4, Name: "Expired", Scopes: models.ScopeReadAvailability, ExpiresAt: m.App.Clock.Now().AddDate(0, 0, -1)},
+		"book0001": {ID: 5, Name: "Paying partner", Scopes: models.ScopeCreateReservation},
+	}
+
+	for prefix, k := range keys {
+		k.Prefix = prefix
+		k.Hash = apikeys.Hash("bk_" + prefix + "_secret")
+		keys[prefix] = k
+	}
+
+	return keys
+}
+
+// AllAPIKeys returns all API keys
+func (m *testDBRepo) AllAPIKeys() ([]models.APIKey, error) {
+	var keys []models.APIKey
+	for _, k := range m.testAPIKeys() {
+		keys = append(keys, k)
+	}
+
+	return keys, nil
+}
+
+// GetAPIKeyByID returns an API key by ID
+func (m *testDBRepo) GetAPIKeyByID(id int) (models.APIKey, error) {
+	for _, k := range m.testAPIKeys() {
+		if k.ID == id {
+			return k, nil
+		}
+	}
+
+	return models.APIKey{}, sql.ErrNoRows
+}
+
+// GetAPIKeyByPrefix returns the API key identified by prefix
+func (m *testDBRepo) GetAPIKeyByPrefix(prefix string) (models.APIKey, error) {
+	k, ok := m.testAPIKeys()[prefix]
+	if !ok {
+		return models.APIKey{}, sql.ErrNoRows
+	}
+
+	return k, nil
+}
+
+// InsertAPIKey inserts an API key into the database
+func (m *testDBRepo) InsertAPIKey(k models.APIKey) (int, error) {
+	return 5, nil
+}
+
+// DeleteAPIKey deletes an API key
+func (m *testDBRepo) DeleteAPIKey(id int) error {
+	return nil
+}
+
+// InsertAPIKeyUsage logs a request made with an API key
+func (m *testDBRepo) InsertAPIKeyUsage(u models.APIKeyUsage) error {
+	return nil
+}
+
+// GetAPIKeyUsages returns the latest requests made with an API key
+func (m *testDBRepo) GetAPIKeyUsages(keyID, limit int) ([]models.APIKeyUsage, error) {
+	usages := []models.APIKeyUsage{
+		{ID: 1, APIKeyID: keyID, Method: "GET", Path: "/api/v1/rooms", Status: 200, CreatedAt: m.App.Clock.Now()},
+	}
+
+	return usages, nil
+}
+
+// testWebhookEndpoints returns the webhook endpoints of the test database: endpoint 1 subscribes to the reservation
+// events and is down, endpoint 2 subscribes to the blocks
+func testWebhookEndpoints() []models.WebhookEndpoint {
+	return []models.WebhookEndpoint{
+		{
+			ID:     1,
+			URL:    "http://127.0.0.1:1/webhooks/reservations",
+			Secret: "whsec_secret",
+			Events: models.Events(models.EventReservationCreated + "," + models.EventReservationCancelled),
+		},
+		{
+			ID:     2,
+			URL:    "https://example.com/webhooks/blocks",
+			Secret: "whsec_secret",
+			Events: models.Events(models.EventBlockCreated),
+		},
+	}
+}
+
+// AllWebhookEndpoints returns all webhook endpoints
+func (m *testDBRepo) AllWebhookEndpoints() ([]models.WebhookEndpoint, error) {
+	return testWebhookEndpoints(), nil
+}
+
+// GetWebhookEndpointByID returns a webhook endpoint by ID
+func (m *testDBRepo) GetWebhookEndpointByID(id int) (models.WebhookEndpoint, error) {
+	for _, e := range testWebhookEndpoints() {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+
+	return models.WebhookEndpoint{}, sql.ErrNoRows
+}
+
+// InsertWebhookEndpoint inserts a webhook endpoint into the database
+func (m *testDBRepo) InsertWebhookEndpoint(e models.WebhookEndpoint) (int, error) {
+	return 3, nil
+}
+
+// DeleteWebhookEndpoint deletes a webhook endpoint, together with its deliveries
+func (m *testDBRepo) DeleteWebhookEndpoint(id int) error {
+	return nil
+}
+
+// InsertWebhookDelivery inserts a delivery of an event to a webhook endpoint into the database
+func (m *testDBRepo) InsertWebhookDelivery(d models.WebhookDelivery) (int, error) {
+	return 2, nil
+}
+
+// testWebhookDelivery is the only webhook delivery of the test database, which failed once
+func (m *testDBRepo) testWebhookDelivery() models.WebhookDelivery {
+	endpoint := testWebhookEndpoints()[0]
+
+	return models.WebhookDelivery{
+		ID:             1,
+		EndpointID:     endpoint.ID,
+		Event:          models.EventReservationCreated,
+		Payload:        `{"event":"reservation.created"}`,
+		Status:         models.DeliveryPending,
+		Attempts:       1,
+		NextAttemptAt:  m.App.Clock.Now().Add(time.Hour),
+		LastStatusCode: 500,
+		LastError:      "endpoint answered 500 Internal Server Error",
+		CreatedAt:      m.App.Clock.Now(),
+		Endpoint:       endpoint,
+	}
+}
+
+// GetWebhookDeliveryByID returns a webhook delivery by ID, with its endpoint
+func (m *testDBRepo) GetWebhookDeliveryByID(id int) (models.WebhookDelivery, error) {
+	if id != 1 {
+		return models.WebhookDelivery{}, sql.ErrNoRows
+	}
+
+	return m.testWebhookDelivery(), nil
+}
+
+// GetDueWebhookDeliveries returns the pending webhook deliveries whose next attempt is due at now
+func (m *testDBRepo) GetDueWebhookDeliveries(now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	return nil, nil
+}
+
+// GetWebhookDeliveriesByEndpointID returns the latest deliveries to a webhook endpoint
+func (m *testDBRepo) GetWebhookDeliveriesByEndpointID(endpointID, limit int) ([]models.WebhookDelivery, error) {
+	if endpointID != 1 {
+		return nil, nil
+	}
+
+	return []models.WebhookDelivery{m.testWebhookDelivery()}, nil
+}
+
+// UpdateWebhookDelivery records the outcome of an attempt of a webhook delivery
+func (m *testDBRepo) UpdateWebhookDelivery(d models.WebhookDelivery) error {
+	return nil
+}
@@ -1,17 +1,85 @@
 package repository
 
 import (
+	"errors"
 	"time"
 
 	"github.com/wagnojunior/booking/internal/models"
 )
 
+// ErrPromoCodeUsedUp is returned by InsertReservation when the promo code of the reservation reached its usage limit
+var ErrPromoCodeUsedUp = errors.New("promo code has reached its usage limit")
+
 type DatabaseRepo interface {
 	AllUsers() bool
 
 	InsertReservation(res models.Reservation) (int, error)
+	UpdateReservationStatus(id int, status string) error
+	AllReservations() ([]models.Reservation, error)
+	GetReservationByID(id int) (models.Reservation, error)
+	GetReservationByCode(code string) (models.Reservation, error)
+	CancelReservation(id int, refundAmount int) (bool, error)
+	ExpirePendingReservations(before time.Time) ([]models.Reservation, error)
+	GetReservationsByUserID(userID int) ([]models.Reservation, error)
+	LinkReservationsByEmail(userID int, email string) (int, error)
 	InsertRoomRestriction(r models.RoomRestriction) error
+	GetRoomRestrictionsByRoomID(roomID int) ([]models.RoomRestriction, error)
+	GetRoomRestrictionsByICalImportID(importID int) ([]models.RoomRestriction, error)
+	SyncRoomRestrictions(insert, update []models.RoomRestriction, remove []int) error
 	SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error)
 	SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error)
 	GetRoomByID(id int) (models.Room, error)
+	GetRatesByRoomID(roomID int, start, end time.Time) ([]models.RoomRate, error)
+	GetStayRulesByRoomID(roomID int, arrival time.Time) ([]models.StayRule, error)
+	GetFeeRulesByRoomID(roomID int) ([]models.FeeRule, error)
+	GetCancellationPoliciesByRoomID(roomID int) ([]models.CancellationPolicy, error)
+	AllRooms() ([]models.Room, error)
+
+	GetUserByID(id int) (models.User, error)
+	GetUserByEmail(email string) (models.User, error)
+	InsertUser(u models.User, password string) (int, error)
+	VerifyUserEmail(verificationHash string) (models.User, error)
+	HasAdmin() (bool, error)
+	Authenticate(email, testPassword string) (int, string, error)
+
+	AllPromoCodes() ([]models.PromoCode, error)
+	GetPromoCodeByID(id int) (models.PromoCode, error)
+	GetPromoCodeByCode(code string) (models.PromoCode, error)
+	InsertPromoCode(p models.PromoCode) (int, error)
+	UpdatePromoCode(p models.PromoCode) error
+	DeletePromoCode(id int) error
+
+	InsertPayment(p models.Payment) (int, error)
+	UpdatePaymentStatus(id int, status string) error
+	UpdatePaymentRefund(id int, refunded int, status string) error
+	ConfirmReservationPayment(paymentID, reservationID int, before time.Time) (bool, error)
+	GetPaymentByProviderRef(ref string) (models.Payment, error)
+	GetPaymentsByReservationID(reservationID int) ([]models.Payment, error)
+
+	GetInvoiceByReservationID(reservationID int) (models.Invoice, error)
+	InsertInvoice(reservationID int) (models.Invoice, error)
+
+	AllICalImports() ([]models.ICalImport, error)
+	GetICalImportByID(id int) (models.ICalImport, error)
+	InsertICalImport(imp models.ICalImport) (int, error)
+	DeleteICalImport(id int) error
+	UpdateICalImportStatus(id int, lastError, warnings string) error
+
+	AllAPIKeys() ([]models.APIKey, error)
+	GetAPIKeyByID(id int) (models.APIKey, error)
+	GetAPIKeyByPrefix(prefix string) (models.APIKey, error)
+	InsertAPIKey(k models.APIKey) (int, error)
+	DeleteAPIKey(id int) error
+	InsertAPIKeyUsage(u models.APIKeyUsage) error
+	GetAPIKeyUsages(keyID, limit int) ([]models.APIKeyUsage, error)
+
+	AllWebhookEndpoints() ([]models.WebhookEndpoint, error)
+	GetWebhookEndpointByID(id int) (models.WebhookEndpoint, error)
+	InsertWebhookEndpoint(e models.WebhookEndpoint) (int, error)
+	DeleteWebhookEndpoint(id int) error
+	InsertWebhookDelivery(d models.WebhookDelivery) (int, error)
+	GetWebhookDeliveryByID(id int) (models.WebhookDelivery, error)
+	GetDueWebhookDeliveries(now time.Time, limit int) ([]models.WebhookDelivery, error)
+	GetWebhookDeliveriesByEndpointID(endpointID, limit int) ([]models.WebhookDelivery, error)
+	UpdateWebhookDelivery(d models.WebhookDelivery) error
 }
@@ -0,0 +1,119 @@
+package stayrules
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/wagnojunior/booking/internal/i18n"
+	"github.com/wagnojunior/booking/internal/models"
+)
+
+// nightCount and dayCount are the arguments of a violation that are written as a number of nights or days
+type (
+	nightCount int
+	dayCount   int
+)
+
+// Violation is a broken stay rule: the key of its explanation in the catalogue, with the arguments it is formatted
+// with, like the form errors
+type Violation struct {
+	Key  string
+	Args []interface{}
+}
+
+// Message returns the explanation of the violation in <locale>. The dates, weekdays and counts of the arguments are
+// written the way they are in the locale
+func (v Violation) Message(locale string) string {
+	args := make([]interface{}, len(v.Args))
+	for i, arg := range v.Args {
+		switch a := arg.(type) {
+		case time.Time:
+			args[i] = i18n.FormatDate(locale, a)
+		case time.Weekday:
+			args[i] = i18n.T(locale, fmt.Sprintf("weekday.%d", a))
+		case nightCount:
+			args[i] = i18n.Plural(locale, "nights", int(a))
+		case dayCount:
+			args[i] = i18n.Plural(locale, "days", int(a))
+		default:
+			args[i] = a
+		}
+	}
+
+	return i18n.T(locale, v.Key, args...)
+}
+
+// Messages returns the explanations of <violations> in <locale>
+func Messages(locale string, violations []Violation) []string {
+	messages := make([]string, 0, len(violations))
+	for _, v := range violations {
+		messages = append(messages, v.Message(locale))
+	}
+
+	return messages
+}
+
+// Check returns a violation for every rule that the stay of the reservation <res> breaks.
+// <rules> are the stay rules that apply to the arrival date of the reservation and <today> is the booking date.
+// An empty slice means that the stay is allowed
+func Check(res models.Reservation, rules []models.StayRule, today time.Time) []Violation {
+	var violations []Violation
+
+	// add appends the violation <key> to the violations, unless it is already there
+	add := func(key string, args ...interface{}) {
+		for _, v := range violations {
+			if v.Key == key && reflect.DeepEqual(v.Args, args) {
+				return
+			}
+		}
+		violations = append(violations, Violation{Key: key, Args: args})
+	}
+
+	nights := Nights(res.StartDate, res.EndDate)
+	advance := Nights(today, res.StartDate)
+
+	if nights < 1 {
+		add("stay.departure_before_arrival")
+	}
+
+	if advance < 0 {
+		add("stay.arrival_in_past")
+	}
+
+	for _, rule := range rules {
+		if rule.MinNights > 0 && nights < rule.MinNights {
+			add("stay.min_nights", res.StartDate, nightCount(rule.MinNights))
+		}
+
+		if rule.MaxNights > 0 && nights > rule.MaxNights {
+			add("stay.max_nights", res.StartDate, nightCount(rule.MaxNights))
+		}
+
+		if rule.MinAdvanceDays > 0 && advance < rule.MinAdvanceDays {
+			add("stay.min_advance", res.StartDate, dayCount(rule.MinAdvanceDays))
+		}
+
+		if rule.MaxAdvanceDays > 0 && advance > rule.MaxAdvanceDays {
+			add("stay.max_advance", dayCount(rule.MaxAdvanceDays))
+		}
+
+		if rule.ClosedToArrival.Contains(res.StartDate.Weekday()) {
+			add("stay.closed_to_arrival", res.StartDate.Weekday())
+		}
+
+		if rule.ClosedToDeparture.Contains(res.EndDate.Weekday()) {
+			add("stay.closed_to_departure", res.EndDate.Weekday())
+		}
+	}
+
+	return violations
+}
+
+// Nights returns the number of nights between the dates <start> and <end>, ignoring the time of the day
+func Nights(start, end time.Time) int {
+	s := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	e := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC)
+
+	return int(e.Sub(s).Hours() / 24)
+}
@@ -0,0 +1,85 @@
+package stayrules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wagnojunior/booking/internal/models"
+)
+
+func date(s string) time.Time {
+	d, _ := time.Parse("2006-01-02", s)
+	return d
+}
+
+// 2022-03-01 is a Tuesday
+var checkTests = []struct {
+	name               string
+	start              string
+	end                string
+	rules              []models.StayRule
+	expectedViolations int
+	expectedKey        string
+}{
+	{"valid stay", "2022-03-10", "2022-03-12", nil, 0, ""},
+	{"zero nights", "2022-03-10", "2022-03-10", nil, 1, "stay.departure_before_arrival"},
+	{"end before start", "2022-03-10", "2022-03-08", nil, 1, "stay.departure_before_arrival"},
+	{"arrival in the past", "2022-02-27", "2022-03-02", nil, 1, "stay.arrival_in_past"},
+	{"minimum nights", "2022-03-10", "2022-03-11", []models.StayRule{{MinNights: 2}}, 1, "stay.min_nights"},
+	{"maximum nights", "2022-03-10", "2022-03-20", []models.StayRule{{MaxNights: 7}}, 1, "stay.max_nights"},
+	{"lead time", "2022-03-02", "2022-03-04", []models.StayRule{{MinAdvanceDays: 3}}, 1, "stay.min_advance"},
+	{"booking horizon", "2023-03-02", "2023-03-04", []models.StayRule{{MaxAdvanceDays: 365}}, 1, "stay.max_advance"},
+	{"closed to arrival", "2022-03-06", "2022-03-08", []models.StayRule{{ClosedToArrival: "0"}}, 1, "stay.closed_to_arrival"},
+	{"closed to departure", "2022-03-04", "2022-03-06", []models.StayRule{{ClosedToDeparture: "0,6"}}, 1, "stay.closed_to_departure"},
+	{"strictest rule applies once", "2022-03-10", "2022-03-11", []models.StayRule{{MinNights: 2}, {MinNights: 2}}, 1, "stay.min_nights"},
+	{"several violations", "2022-03-10", "2022-03-11", []models.StayRule{{MinNights: 2, MinAdvanceDays: 14}}, 2, "stay.min_nights"},
+}
+
+func TestCheck(t *testing.T) {
+	today := date("2022-03-01")
+
+	for _, e := range checkTests {
+		res := models.Reservation{
+			StartDate: date(e.start),
+			EndDate:   date(e.end),
+		}
+
+		violations := Check(res, e.rules, today)
+		if len(violations) != e.expectedViolations {
+			t.Errorf("For %s, expected %d violations but got %d: %v", e.name, e.expectedViolations, len(violations), violations)
+		}
+
+		if e.expectedKey != "" && (len(violations) == 0 || violations[0].Key != e.expectedKey) {
+			t.Errorf("For %s, expected the violation %s but got %v", e.name, e.expectedKey, violations)
+		}
+	}
+}
+
+func TestViolation_Message(t *testing.T) {
+	var tests = []struct {
+		name      string
+		violation Violation
+		locale    string
+		expected  string
+	}{
+		{"nights", Violation{"stay.min_nights", []interface{}{date("2022-03-10"), nightCount(2)}}, "en", "Stays arriving on Mar 10, 2022 must be at least 2 nights long"},
+		{"one day", Violation{"stay.max_advance", []interface{}{dayCount(1)}}, "en", "Stays can be booked at most 1 day in advance"},
+		{"weekday", Violation{"stay.closed_to_arrival", []interface{}{time.Sunday}}, "pt", "Não é possível chegar neste dia da semana (domingo)"},
+		{"date and nights", Violation{"stay.min_nights", []interface{}{date("2022-03-10"), nightCount(2)}}, "ja", "2022年3月10日チェックインの宿泊は2泊以上必要です"},
+	}
+
+	for _, e := range tests {
+		if msg := e.violation.Message(e.locale); msg != e.expected {
+			t.Errorf("For %s, expected %q but got %q", e.name, e.expected, msg)
+		}
+	}
+}
+
+func TestNights(t *testing.T) {
+	start := time.Date(2022, 3, 1, 23, 0, 0, 0, time.UTC)
+	end := time.Date(2022, 3, 3, 1, 0, 0, 0, time.UTC)
+
+	if n := Nights(start, end); n != 2 {
+		t.Errorf("expected 2 nights but got %d", n)
+	}
+}
@@ -0,0 +1,107 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// MaxAttempts is how many times a delivery is tried before it is given up
+const MaxAttempts = 8
+
+// Headers of a delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// NewSecret returns a random secret with which the deliveries to an endpoint are signed
+func NewSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature of the <body> of a delivery sent at the Unix time <timestamp>, that is the hex encoded
+// HMAC-SHA256 of "<timestamp>.<body>" with the key <secret>. Signing the timestamp lets the receiver refuse replays
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks in constant time that <signature> is the signature of <body> sent at <timestamp>
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Backoff returns how long to wait before the next try of a delivery that failed <attempts> times:
+// 30 seconds after the first failure, then twice as long after every other failure, at most 6 hours
+func Backoff(attempts int) time.Duration {
+	wait := 30 * time.Second
+	for i := 1; i < attempts && wait < 6*time.Hour; i++ {
+		wait *= 2
+	}
+
+	if wait > 6*time.Hour {
+		wait = 6 * time.Hour
+	}
+
+	return wait
+}
+
+// Request is a delivery of an event to an endpoint
+type Request struct {
+	URL        string
+	Secret     string
+	Event      string
+	DeliveryID int
+	Payload    []byte // The JSON body
+}
+
+// Send posts the delivery <req> with <client> at <now>. It returns the status code of the response, and an error
+// when the endpoint could not be reached or did not answer with a 2xx status
+func Send(client *http.Client, req Request, now time.Time) (int, error) {
+	timestamp := now.Unix()
+
+	httpReq, err := http.NewRequest("POST", req.URL, bytes.NewReader(req.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("User-Agent", "booking-webhooks/1.0")
+	httpReq.Header.Set(HeaderEvent, req.Event)
+	httpReq.Header.Set(HeaderDelivery, strconv.Itoa(req.DeliveryID))
+	httpReq.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	httpReq.Header.Set(HeaderSignature, Sign(req.Secret, timestamp, req.Payload))
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// The body is not needed, but reading it lets the connection be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,87 @@
+package webhooks
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"reservation.created"}`)
+
+	signature := Sign("secret", 1646128800, body)
+	if !Verify("secret", 1646128800, body, signature) {
+		t.Error("expected the signature to verify")
+	}
+
+	if Verify("other", 1646128800, body, signature) || Verify("secret", 1646128801, body, signature) {
+		t.Error("expected another secret or timestamp not to verify")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	expected := map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		3:  2 * time.Minute,
+		7:  32 * time.Minute,
+		20: 6 * time.Hour,
+	}
+
+	for attempts, wait := range expected {
+		if b := Backoff(attempts); b != wait {
+			t.Errorf("after %d attempts, expected to wait %s but got %s", attempts, wait, b)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	status := http.StatusNoContent
+
+	// A local receiver that checks the signature, as the receivers of the deliveries should
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+
+		if !Verify("secret", timestamp, body, r.Header.Get(HeaderSignature)) || r.Header.Get(HeaderEvent) != "block.created" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	req := Request{
+		URL:        receiver.URL,
+		Secret:     "secret",
+		Event:      "block.created",
+		DeliveryID: 1,
+		Payload:    []byte(`{"event":"block.created"}`),
+	}
+
+	code, err := Send(receiver.Client(), req, now)
+	if err != nil || code != http.StatusNoContent {
+		t.Errorf("expected the delivery to succeed but got %d: %v", code, err)
+	}
+
+	req.Secret = "wrong"
+	if code, err := Send(receiver.Client(), req, now); err == nil || code != http.StatusUnauthorized {
+		t.Errorf("expected a refused delivery but got %d: %v", code, err)
+	}
+
+	req.Secret = "secret"
+	status = http.StatusInternalServerError
+	if _, err := Send(receiver.Client(), req, now); err == nil {
+		t.Error("expected an error for a 500 response")
+	}
+
+	receiver.Close()
+	if code, err := Send(receiver.Client(), req, now); err == nil || code != 0 {
+		t.Errorf("expected an error for an unreachable endpoint but got %d", code)
+	}
+}
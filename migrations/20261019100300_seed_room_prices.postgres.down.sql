@@ -0,0 +1,2 @@
+delete from room_rates;
+update rooms set base_price = 0;
\ No newline at end of file
@@ -0,0 +1,6 @@
+UPDATE public.rooms SET base_price = 12000 WHERE room_name = 'Panda Suite';
+UPDATE public.rooms SET base_price = 4500 WHERE room_name = 'Bamboo Dorm';
+INSERT INTO public.room_rates (room_id,rate_name,start_date,end_date,weekdays,price,priority,created_at,updated_at)
+	SELECT id,'Weekend','2022-01-01','2099-12-31','5,6',15000,1,'2022-12-06 00:00:00.000','2022-12-06 00:00:00.000' FROM public.rooms WHERE room_name = 'Panda Suite';
+INSERT INTO public.room_rates (room_id,rate_name,start_date,end_date,weekdays,price,priority,created_at,updated_at)
+	SELECT id,'Weekend','2022-01-01','2099-12-31','5,6',5500,1,'2022-12-06 00:00:00.000','2022-12-06 00:00:00.000' FROM public.rooms WHERE room_name = 'Bamboo Dorm';
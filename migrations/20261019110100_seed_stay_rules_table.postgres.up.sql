@@ -0,0 +1,4 @@
+INSERT INTO public.stay_rules (room_id,start_date,end_date,min_nights,max_nights,min_advance_days,max_advance_days,closed_to_arrival,closed_to_departure,created_at,updated_at) VALUES
+	 (NULL,'2022-01-01','2099-12-31',1,30,0,365,'','','2022-12-06 00:00:00.000','2022-12-06 00:00:00.000');
+INSERT INTO public.stay_rules (room_id,start_date,end_date,min_nights,max_nights,min_advance_days,max_advance_days,closed_to_arrival,closed_to_departure,created_at,updated_at)
+	SELECT id,'2022-01-01','2099-12-31',2,0,0,0,'','','2022-12-06 00:00:00.000','2022-12-06 00:00:00.000' FROM public.rooms WHERE room_name = 'Panda Suite';
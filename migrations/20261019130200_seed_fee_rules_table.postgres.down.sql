@@ -0,0 +1 @@
+delete from fee_rules;
\ No newline at end of file
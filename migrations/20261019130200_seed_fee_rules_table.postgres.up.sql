@@ -0,0 +1,4 @@
+INSERT INTO public.fee_rules ("name",category,kind,amount,room_id,created_at,updated_at) VALUES
+	 ('Cleaning fee','fee','per_stay',3000,NULL,'2022-12-06 00:00:00.000','2022-12-06 00:00:00.000'),
+	 ('Tourist tax','tax','per_guest_per_night',200,NULL,'2022-12-06 00:00:00.000','2022-12-06 00:00:00.000'),
+	 ('VAT','tax','percent',1000,NULL,'2022-12-06 00:00:00.000','2022-12-06 00:00:00.000');
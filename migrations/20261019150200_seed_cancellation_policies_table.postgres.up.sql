@@ -0,0 +1,4 @@
+INSERT INTO public.cancellation_policies ("name",free_until_days,penalty_percent,non_refundable,room_id,rate_name,created_at,updated_at) VALUES
+	 ('Moderate',7,50,false,NULL,'','2022-12-06 00:00:00.000','2022-12-06 00:00:00.000');
+INSERT INTO public.cancellation_policies ("name",free_until_days,penalty_percent,non_refundable,room_id,rate_name,created_at,updated_at)
+	SELECT 'Non-refundable weekend',0,100,true,id,'Weekend','2022-12-06 00:00:00.000','2022-12-06 00:00:00.000' FROM public.rooms WHERE room_name = 'Panda Suite';
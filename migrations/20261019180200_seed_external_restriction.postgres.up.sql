@@ -0,0 +1,2 @@
+INSERT INTO public.restrictions (restriction_name,created_at,updated_at) VALUES
+	 ('External','2022-12-06 00:00:00.000','2022-12-06 00:00:00.000');
@@ -0,0 +1 @@
+-- The admin with the published password is not restored. The first admin is created at startup instead
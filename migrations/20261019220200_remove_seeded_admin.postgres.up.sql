@@ -0,0 +1 @@
+delete from users where email = 'admin@admin.com' and "password" = '$2a$12$zg0sfAnyQH9Bh9NF9qFHH.MuQOHPrX0MAKzjE10F6XdhyCCSJOrWq';
@@ -106,4 +106,16 @@ function prompt() {
         error: error,
         custom: custom,
     }
-}
\ No newline at end of file
+}
+
+// The forms with a data-confirm attribute ask for a confirmation before they are submitted. The Content-Security-Policy
+// blocks the inline event handlers, such as onsubmit, so they are listened to here
+document.addEventListener('DOMContentLoaded', function() {
+    document.querySelectorAll('form[data-confirm]').forEach(function(form) {
+        form.addEventListener('submit', function(event) {
+            if (!confirm(form.dataset.confirm)) {
+                event.preventDefault();
+            }
+        });
+    });
+});